@@ -0,0 +1,151 @@
+package calendar
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"backend/models"
+)
+
+// Calendriers inventés : N mois de longueur fixe, jours de semaine nommés,
+// plusieurs ères. Toutes les dates d'un projet se ramènent à un "jour absolu"
+// (int64) commun à tous ses calendriers : c'est ce jour qui est stocké et qui
+// sert au tri chronologique et aux conversions.
+//
+// Pour un calendrier, le jour absolu du 1er jour du 1er mois de l'année
+// absolue 1 vaut EpochOffset. L'an 1 de l'ère i correspond à l'année absolue
+// Eras[i].StartYear. Pas d'années bissextiles.
+
+// Validate vérifie la définition d'un calendrier.
+func Validate(c *models.Calendar) error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return errors.New("name requis")
+	}
+	if len(c.Months) == 0 {
+		return errors.New("a calendar needs at least one month")
+	}
+	for i, m := range c.Months {
+		if strings.TrimSpace(m.Name) == "" {
+			return fmt.Errorf("month %d: name requis", i+1)
+		}
+		if m.Days < 1 {
+			return fmt.Errorf("month %d: days must be >= 1", i+1)
+		}
+	}
+	for i, wd := range c.Weekdays {
+		if strings.TrimSpace(wd) == "" {
+			return fmt.Errorf("weekday %d: name requis", i+1)
+		}
+	}
+	for i, e := range c.Eras {
+		if strings.TrimSpace(e.Name) == "" {
+			return fmt.Errorf("era %d: name requis", i+1)
+		}
+		if i > 0 && e.StartYear <= c.Eras[i-1].StartYear {
+			return errors.New("eras must be sorted by increasing start_year")
+		}
+	}
+	if c.Weekdays == nil {
+		c.Weekdays = []string{}
+	}
+	if c.Eras == nil {
+		c.Eras = []models.CalendarEra{}
+	}
+	return nil
+}
+
+// YearLength : nombre de jours dans une année.
+func YearLength(c models.Calendar) int64 {
+	var n int64
+	for _, m := range c.Months {
+		n += int64(m.Days)
+	}
+	return n
+}
+
+// eraStart : année absolue de l'an 1 de l'ère (1 si aucune ère définie).
+func eraStart(c models.Calendar, era int) (int, error) {
+	if len(c.Eras) == 0 {
+		if era != 0 {
+			return 0, errors.New("calendar has no eras")
+		}
+		return 1, nil
+	}
+	if era < 0 || era >= len(c.Eras) {
+		return 0, errors.New("invalid era")
+	}
+	return c.Eras[era].StartYear, nil
+}
+
+// ToDay convertit une date du calendrier en jour absolu.
+func ToDay(c models.Calendar, d models.StoryDate) (int64, error) {
+	start, err := eraStart(c, d.Era)
+	if err != nil {
+		return 0, err
+	}
+	if d.Month < 1 || d.Month > len(c.Months) {
+		return 0, errors.New("invalid month")
+	}
+	if d.Day < 1 || d.Day > c.Months[d.Month-1].Days {
+		return 0, errors.New("invalid day")
+	}
+
+	absYear := int64(start + d.Year - 1)
+	day := (absYear - 1) * YearLength(c)
+	for _, m := range c.Months[:d.Month-1] {
+		day += int64(m.Days)
+	}
+	day += int64(d.Day - 1)
+	return c.EpochOffset + day, nil
+}
+
+// FromDay convertit un jour absolu en date du calendrier (avec les noms).
+func FromDay(c models.Calendar, day int64) models.StoryDate {
+	yl := YearLength(c)
+	local := day - c.EpochOffset
+
+	// Division euclidienne : les jours avant l'époque donnent des années <= 0
+	yearIdx := floorDiv(local, yl)
+	rem := local - yearIdx*yl
+	absYear := int(yearIdx) + 1
+
+	var d models.StoryDate
+	for i, m := range c.Months {
+		if rem < int64(m.Days) {
+			d.Month = i + 1
+			d.MonthName = m.Name
+			d.Day = int(rem) + 1
+			break
+		}
+		rem -= int64(m.Days)
+	}
+
+	// Dernière ère commencée ; avant la première ère, on compte depuis celle-ci
+	d.Year = absYear
+	for i, e := range c.Eras {
+		if i == 0 || e.StartYear <= absYear {
+			d.Era = i
+			d.EraName = e.Name
+			d.Year = absYear - e.StartYear + 1
+		}
+	}
+
+	if n := int64(len(c.Weekdays)); n > 0 {
+		d.Weekday = c.Weekdays[floorMod(local+int64(c.WeekdayOffset), n)]
+	}
+	return d
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+func floorMod(a, b int64) int64 {
+	return a - floorDiv(a, b)*b
+}
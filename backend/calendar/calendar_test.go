@@ -0,0 +1,103 @@
+package calendar
+
+import (
+	"testing"
+
+	"backend/models"
+)
+
+var (
+	simple = models.Calendar{
+		Name:          "Simple",
+		Months:        []models.CalendarMonth{{Name: "Givre", Days: 10}, {Name: "Moisson", Days: 20}},
+		Weekdays:      []string{"Lun", "Mar", "Mer"},
+		EpochOffset:   100,
+		WeekdayOffset: 1,
+	}
+	withEras = models.Calendar{
+		Name:     "Ères",
+		Months:   []models.CalendarMonth{{Name: "Un", Days: 30}, {Name: "Deux", Days: 31}, {Name: "Trois", Days: 4}},
+		Weekdays: []string{"A", "B", "C", "D", "E", "F", "G"},
+		Eras: []models.CalendarEra{
+			{Name: "Ancien", StartYear: -500},
+			{Name: "Nouveau", StartYear: 10},
+		},
+		EpochOffset:   -12345,
+		WeekdayOffset: 4,
+	}
+)
+
+func TestFromDay(t *testing.T) {
+	tests := []struct {
+		name string
+		cal  models.Calendar
+		day  int64
+		want models.StoryDate
+	}{
+		{"époque", simple, 100, models.StoryDate{Year: 1, Month: 1, MonthName: "Givre", Day: 1, Weekday: "Mar"}},
+		{"fin de l'an 1", simple, 129, models.StoryDate{Year: 1, Month: 2, MonthName: "Moisson", Day: 20, Weekday: "Lun"}},
+		{"veille de l'époque", simple, 99, models.StoryDate{Year: 0, Month: 2, MonthName: "Moisson", Day: 20, Weekday: "Lun"}},
+		{"jour négatif", simple, -1, models.StoryDate{Year: -3, Month: 2, MonthName: "Moisson", Day: 10, Weekday: "Mer"}},
+		{"première ère", withEras, -12345, models.StoryDate{Era: 0, EraName: "Ancien", Year: 502, Month: 1, MonthName: "Un", Day: 1, Weekday: "E"}},
+		{"début de la seconde ère", withEras, -12345 + 9*65, models.StoryDate{Era: 1, EraName: "Nouveau", Year: 1, Month: 1, MonthName: "Un", Day: 1, Weekday: "B"}},
+		{"avant la première ère", withEras, -12345 - 600*65 + 61, models.StoryDate{Era: 0, EraName: "Ancien", Year: -98, Month: 3, MonthName: "Trois", Day: 1, Weekday: "G"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromDay(tt.cal, tt.day); got != tt.want {
+				t.Errorf("FromDay(%d) = %+v, want %+v", tt.day, got, tt.want)
+			}
+		})
+	}
+}
+
+// FromDay puis ToDay redonne le jour de départ, de part et d'autre de
+// l'époque et du jour 0.
+func TestDayRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		cal      models.Calendar
+		from, to int64
+	}{
+		{"sans ère", simple, -2000, 2000},
+		{"avec ères", withEras, -12345 - 1000*65, -12345 + 100*65},
+		{"autour de zéro", withEras, -500, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for day := tt.from; day <= tt.to; day++ {
+				d := FromDay(tt.cal, day)
+				got, err := ToDay(tt.cal, d)
+				if err != nil {
+					t.Fatalf("ToDay(%+v): %v", d, err)
+				}
+				if got != day {
+					t.Fatalf("ToDay(FromDay(%d)) = %d (%+v)", day, got, d)
+				}
+			}
+		})
+	}
+}
+
+func TestToDayErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cal  models.Calendar
+		date models.StoryDate
+	}{
+		{"mois 0", simple, models.StoryDate{Year: 1, Month: 0, Day: 1}},
+		{"mois trop grand", simple, models.StoryDate{Year: 1, Month: 3, Day: 1}},
+		{"jour 0", simple, models.StoryDate{Year: 1, Month: 1, Day: 0}},
+		{"jour trop grand", simple, models.StoryDate{Year: 1, Month: 1, Day: 11}},
+		{"ère sans ères", simple, models.StoryDate{Era: 1, Year: 1, Month: 1, Day: 1}},
+		{"ère inconnue", withEras, models.StoryDate{Era: 2, Year: 1, Month: 1, Day: 1}},
+		{"ère négative", withEras, models.StoryDate{Era: -1, Year: 1, Month: 1, Day: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ToDay(tt.cal, tt.date); err == nil {
+				t.Errorf("ToDay(%+v): expected an error", tt.date)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// IsUniqueViolation : err vient d'une contrainte UNIQUE (23505), par exemple
+// une insertion concurrente passée entre la vérification et l'écriture.
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
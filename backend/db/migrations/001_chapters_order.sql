@@ -0,0 +1,14 @@
+-- Normalise l'ordre existant (1..n par projet) avant d'ajouter la contrainte
+UPDATE chapters c
+SET order_index = r.rn
+FROM (
+	SELECT id, row_number() OVER (PARTITION BY project_id ORDER BY order_index, id) AS rn
+	FROM chapters
+) r
+WHERE c.id = r.id;
+
+-- Unicité de order_index par projet, vérifiée en fin de transaction pour
+-- permettre la réécriture complète de l'ordre (routes/chapters, move).
+ALTER TABLE chapters
+	ADD CONSTRAINT chapters_project_order_key
+	UNIQUE (project_id, order_index) DEFERRABLE INITIALLY DEFERRED;
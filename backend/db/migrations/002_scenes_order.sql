@@ -0,0 +1,18 @@
+-- Normalise l'ordre existant (1..n par chapitre) avant d'ajouter la contrainte
+UPDATE scenes s
+SET order_index = r.rn
+FROM (
+	SELECT id, row_number() OVER (PARTITION BY chapter_id ORDER BY order_index, id) AS rn
+	FROM scenes
+) r
+WHERE s.id = r.id;
+
+-- chapter_uuid doit toujours refléter chapter_id
+UPDATE scenes s
+SET chapter_uuid = c.public_id
+FROM chapters c
+WHERE c.id = s.chapter_id AND s.chapter_uuid IS DISTINCT FROM c.public_id;
+
+ALTER TABLE scenes
+	ADD CONSTRAINT scenes_chapter_order_key
+	UNIQUE (chapter_id, order_index) DEFERRABLE INITIALLY DEFERRED;
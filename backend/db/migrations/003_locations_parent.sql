@@ -0,0 +1,5 @@
+-- Hiérarchie de lieux : continent > royaume > ville > taverne
+ALTER TABLE locations
+	ADD COLUMN parent_id integer REFERENCES locations(id);
+
+CREATE INDEX locations_parent_id_idx ON locations (parent_id);
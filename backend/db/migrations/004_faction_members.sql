@@ -0,0 +1,14 @@
+-- Appartenance personnage <-> faction, avec rang/titre et bornes en chapitres
+CREATE TABLE faction_members (
+	id               serial PRIMARY KEY,
+	public_id        uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	faction_id       integer NOT NULL REFERENCES factions(id) ON DELETE CASCADE,
+	character_id     integer NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+	rank             integer,
+	title            text NOT NULL DEFAULT '',
+	start_chapter_id integer REFERENCES chapters(id) ON DELETE SET NULL,
+	end_chapter_id   integer REFERENCES chapters(id) ON DELETE SET NULL
+);
+
+CREATE INDEX faction_members_faction_id_idx ON faction_members (faction_id);
+CREATE INDEX faction_members_character_id_idx ON faction_members (character_id);
@@ -0,0 +1,85 @@
+-- Catalogue des modèles narratifs et de leurs phases.
+-- Les tables existent déjà sur certaines bases : on complète sans écraser.
+CREATE TABLE IF NOT EXISTS story_models (
+	id          serial PRIMARY KEY,
+	name        text NOT NULL,
+	description text NOT NULL DEFAULT ''
+);
+ALTER TABLE story_models ADD COLUMN IF NOT EXISTS description text NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS story_phases (
+	id             serial PRIMARY KEY,
+	story_model_id integer NOT NULL REFERENCES story_models(id) ON DELETE CASCADE,
+	name           text NOT NULL
+);
+ALTER TABLE story_phases ADD COLUMN IF NOT EXISTS description text NOT NULL DEFAULT '';
+ALTER TABLE story_phases ADD COLUMN IF NOT EXISTS color text NOT NULL DEFAULT '';
+-- Position attendue de la phase, en % de l'histoire (0 = début, 100 = fin)
+ALTER TABLE story_phases ADD COLUMN IF NOT EXISTS position_percent numeric(5,2) NOT NULL DEFAULT 0;
+ALTER TABLE story_phases ADD COLUMN IF NOT EXISTS order_index integer NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS story_phases_model_idx ON story_phases (story_model_id, order_index);
+
+-- Modèles intégrés (Save the Cat! garde l'id 1, attendu par le front)
+INSERT INTO story_models (id, name, description) VALUES
+	(1, 'Save the Cat!', 'Beat sheet de Blake Snyder en 15 temps.'),
+	(2, 'Hero''s Journey', 'Voyage du héros (Campbell / Vogler) en 12 étapes.'),
+	(3, 'Three-Act Structure', 'Structure classique en trois actes.')
+ON CONFLICT (id) DO NOTHING;
+
+SELECT setval(pg_get_serial_sequence('story_models', 'id'), (SELECT MAX(id) FROM story_models));
+
+-- Save the Cat!
+INSERT INTO story_phases (story_model_id, name, description, color, position_percent, order_index)
+SELECT 1, v.name, v.description, v.color, v.position_percent, v.order_index
+FROM (VALUES
+		('Opening Image', 'Image d''ouverture : instantané du héros et de son monde avant le changement.', '#e57373', 0, 1),
+		('Theme Stated', 'Le thème est énoncé, souvent par un personnage secondaire.', '#f06292', 5, 2),
+		('Set-Up', 'Présentation du héros, de ses manques et de son quotidien.', '#ba68c8', 7, 3),
+		('Catalyst', 'L''élément déclencheur qui bouleverse le statu quo.', '#9575cd', 10, 4),
+		('Debate', 'Le héros hésite face à l''appel au changement.', '#7986cb', 15, 5),
+		('Break into Two', 'Le héros choisit d''entrer dans le monde inversé de l''acte 2.', '#64b5f6', 20, 6),
+		('B Story', 'Histoire secondaire, souvent porteuse du thème (amour, amitié).', '#4fc3f7', 22, 7),
+		('Fun and Games', 'La promesse du concept : le héros explore le nouveau monde.', '#4dd0e1', 30, 8),
+		('Midpoint', 'Fausse victoire ou fausse défaite, les enjeux montent.', '#4db6ac', 50, 9),
+		('Bad Guys Close In', 'Les forces antagonistes se resserrent, l''équipe se fissure.', '#81c784', 62, 10),
+		('All Is Lost', 'Le point le plus bas, souvent marqué par une perte.', '#aed581', 75, 11),
+		('Dark Night of the Soul', 'Le héros touche le fond avant la prise de conscience.', '#dce775', 78, 12),
+		('Break into Three', 'La solution apparaît grâce à la leçon de l''histoire B.', '#ffd54f', 80, 13),
+		('Finale', 'Le héros applique ce qu''il a appris et affronte l''antagoniste.', '#ffb74d', 90, 14),
+		('Final Image', 'Image finale, miroir de l''ouverture, qui montre le changement.', '#ff8a65', 100, 15)
+	) AS v(name, description, color, position_percent, order_index)
+WHERE NOT EXISTS (SELECT 1 FROM story_phases WHERE story_model_id = 1);
+
+-- Hero's Journey
+INSERT INTO story_phases (story_model_id, name, description, color, position_percent, order_index)
+SELECT 2, v.name, v.description, v.color, v.position_percent, v.order_index
+FROM (VALUES
+		('Ordinary World', 'Le monde ordinaire du héros.', '#e57373', 0, 1),
+		('Call to Adventure', 'Un problème ou un défi se présente.', '#f06292', 10, 2),
+		('Refusal of the Call', 'Le héros doute et refuse d''abord.', '#ba68c8', 15, 3),
+		('Meeting the Mentor', 'Un mentor apporte conseils, objet ou confiance.', '#9575cd', 20, 4),
+		('Crossing the Threshold', 'Le héros quitte le monde ordinaire.', '#7986cb', 25, 5),
+		('Tests, Allies, Enemies', 'Épreuves, alliés et ennemis du monde spécial.', '#64b5f6', 35, 6),
+		('Approach to the Inmost Cave', 'Préparation avant l''épreuve centrale.', '#4fc3f7', 45, 7),
+		('Ordeal', 'L''épreuve suprême, face à la mort ou à la plus grande peur.', '#4dd0e1', 50, 8),
+		('Reward', 'Le héros s''empare de la récompense.', '#4db6ac', 60, 9),
+		('The Road Back', 'Retour vers le monde ordinaire, poursuivi.', '#81c784', 75, 10),
+		('Resurrection', 'Dernière épreuve, le héros est transformé.', '#aed581', 90, 11),
+		('Return with the Elixir', 'Le héros revient avec ce qui changera son monde.', '#dce775', 100, 12)
+	) AS v(name, description, color, position_percent, order_index)
+WHERE NOT EXISTS (SELECT 1 FROM story_phases WHERE story_model_id = 2);
+
+-- Three-Act Structure
+INSERT INTO story_phases (story_model_id, name, description, color, position_percent, order_index)
+SELECT 3, v.name, v.description, v.color, v.position_percent, v.order_index
+FROM (VALUES
+		('Setup', 'Présentation des personnages et des enjeux.', '#e57373', 0, 1),
+		('Inciting Incident', 'L''événement qui lance l''intrigue.', '#f06292', 12, 2),
+		('Plot Point 1', 'Fin de l''acte 1, le héros s''engage.', '#ba68c8', 25, 3),
+		('Midpoint', 'Retournement central.', '#9575cd', 50, 4),
+		('Plot Point 2', 'Fin de l''acte 2, crise majeure.', '#7986cb', 75, 5),
+		('Climax', 'Confrontation finale.', '#64b5f6', 90, 6),
+		('Resolution', 'Dénouement et nouvel équilibre.', '#4fc3f7', 100, 7)
+	) AS v(name, description, color, position_percent, order_index)
+WHERE NOT EXISTS (SELECT 1 FROM story_phases WHERE story_model_id = 3);
@@ -0,0 +1,5 @@
+-- Modèles narratifs personnels : user_id NULL = modèle intégré, partagé par tous
+ALTER TABLE story_models
+	ADD COLUMN user_id integer REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE INDEX story_models_user_id_idx ON story_models (user_id);
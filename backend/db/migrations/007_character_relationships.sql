@@ -0,0 +1,17 @@
+-- Relations orientées entre personnages (from -> to), typées
+CREATE TABLE character_relationships (
+	id                serial PRIMARY KEY,
+	public_id         uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	project_id        integer NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	from_character_id integer NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+	to_character_id   integer NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+	type              text NOT NULL,
+	notes             text NOT NULL DEFAULT '',
+	-- Chapitre où la relation bascule (ex. alliés -> rivaux)
+	change_chapter_id integer REFERENCES chapters(id) ON DELETE SET NULL,
+	CHECK (from_character_id <> to_character_id)
+);
+
+CREATE INDEX character_relationships_project_id_idx ON character_relationships (project_id);
+CREATE INDEX character_relationships_from_idx ON character_relationships (from_character_id);
+CREATE INDEX character_relationships_to_idx ON character_relationships (to_character_id);
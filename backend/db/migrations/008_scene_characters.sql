@@ -0,0 +1,11 @@
+-- Personnages présents dans une scène : pov, present ou mentioned
+CREATE TABLE scene_characters (
+	scene_id     integer NOT NULL REFERENCES scenes(id) ON DELETE CASCADE,
+	character_id integer NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+	role         text NOT NULL CHECK (role IN ('pov', 'present', 'mentioned')),
+	PRIMARY KEY (scene_id, character_id)
+);
+
+CREATE INDEX scene_characters_character_id_idx ON scene_characters (character_id);
+-- Un seul point de vue par scène
+CREATE UNIQUE INDEX scene_characters_one_pov_idx ON scene_characters (scene_id) WHERE role = 'pov';
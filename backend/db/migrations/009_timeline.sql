@@ -0,0 +1,31 @@
+-- Calendriers inventés par projet (voir backend/calendar)
+CREATE TABLE calendars (
+	id             serial PRIMARY KEY,
+	public_id      uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	project_id     integer NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	name           text NOT NULL,
+	months         jsonb NOT NULL,
+	weekdays       jsonb NOT NULL DEFAULT '[]',
+	eras           jsonb NOT NULL DEFAULT '[]',
+	epoch_offset   bigint NOT NULL DEFAULT 0,
+	weekday_offset integer NOT NULL DEFAULT 0
+);
+
+CREATE INDEX calendars_project_id_idx ON calendars (project_id);
+
+-- Événements de la chronologie (hors scènes : batailles, naissances...)
+CREATE TABLE timeline_events (
+	id          serial PRIMARY KEY,
+	public_id   uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	project_id  integer NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	title       text NOT NULL,
+	description text NOT NULL DEFAULT '',
+	day         bigint NOT NULL,
+	-- Calendrier d'affichage par défaut de l'événement
+	calendar_id integer REFERENCES calendars(id) ON DELETE SET NULL
+);
+
+CREATE INDEX timeline_events_project_day_idx ON timeline_events (project_id, day);
+
+-- Date in-world des scènes, en jour absolu du projet (indépendante de order_index)
+ALTER TABLE scenes ADD COLUMN story_day bigint;
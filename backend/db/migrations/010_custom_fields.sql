@@ -0,0 +1,26 @@
+-- Champs personnalisés : définitions par projet et par type d'entité
+CREATE TABLE custom_field_definitions (
+	id          serial PRIMARY KEY,
+	public_id   uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	project_id  integer NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	entity_type text NOT NULL CHECK (entity_type IN ('character', 'location', 'faction')),
+	key         text NOT NULL,
+	label       text NOT NULL,
+	field_type  text NOT NULL CHECK (field_type IN ('text', 'number', 'date', 'enum', 'reference')),
+	-- Valeurs possibles (enum)
+	options     jsonb NOT NULL DEFAULT '[]',
+	-- Type d'entité référencée (reference) : character, location, faction, chapter, scene
+	ref_type    text NOT NULL DEFAULT '',
+	required    boolean NOT NULL DEFAULT false,
+	order_index integer NOT NULL DEFAULT 0,
+	UNIQUE (project_id, entity_type, key)
+);
+
+-- Valeurs : objet { key: valeur } sur chaque entité
+ALTER TABLE characters ADD COLUMN custom_fields jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE locations  ADD COLUMN custom_fields jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE factions   ADD COLUMN custom_fields jsonb NOT NULL DEFAULT '{}';
+
+CREATE INDEX characters_custom_fields_idx ON characters USING gin (custom_fields);
+CREATE INDEX locations_custom_fields_idx  ON locations  USING gin (custom_fields);
+CREATE INDEX factions_custom_fields_idx   ON factions   USING gin (custom_fields);
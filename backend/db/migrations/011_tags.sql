@@ -0,0 +1,49 @@
+-- Tags transverses, propres à un projet
+CREATE TABLE tags (
+	id         serial PRIMARY KEY,
+	public_id  uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	project_id integer NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	name       text NOT NULL,
+	color      text NOT NULL DEFAULT ''
+);
+
+-- Nom unique par projet, sans tenir compte de la casse
+CREATE UNIQUE INDEX tags_project_name_idx ON tags (project_id, lower(name));
+
+-- Une table de liaison par type d'entité : la suppression d'une entité
+-- retire ses tags
+CREATE TABLE character_tags (
+	tag_id       integer NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+	character_id integer NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+	PRIMARY KEY (tag_id, character_id)
+);
+
+CREATE TABLE location_tags (
+	tag_id      integer NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+	location_id integer NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+	PRIMARY KEY (tag_id, location_id)
+);
+
+CREATE TABLE faction_tags (
+	tag_id     integer NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+	faction_id integer NOT NULL REFERENCES factions(id) ON DELETE CASCADE,
+	PRIMARY KEY (tag_id, faction_id)
+);
+
+CREATE TABLE chapter_tags (
+	tag_id     integer NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+	chapter_id integer NOT NULL REFERENCES chapters(id) ON DELETE CASCADE,
+	PRIMARY KEY (tag_id, chapter_id)
+);
+
+CREATE TABLE scene_tags (
+	tag_id   integer NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+	scene_id integer NOT NULL REFERENCES scenes(id) ON DELETE CASCADE,
+	PRIMARY KEY (tag_id, scene_id)
+);
+
+CREATE INDEX character_tags_character_id_idx ON character_tags (character_id);
+CREATE INDEX location_tags_location_id_idx ON location_tags (location_id);
+CREATE INDEX faction_tags_faction_id_idx ON faction_tags (faction_id);
+CREATE INDEX chapter_tags_chapter_id_idx ON chapter_tags (chapter_id);
+CREATE INDEX scene_tags_scene_id_idx ON scene_tags (scene_id);
@@ -0,0 +1,18 @@
+-- Images envoyées (avatars, lieux, cartes) ; les fichiers sont dans le
+-- stockage configuré (STORAGE_DRIVER), seule la clé est en base
+CREATE TABLE images (
+	id           serial PRIMARY KEY,
+	public_id    uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	project_id   integer NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	kind         text NOT NULL DEFAULT 'other' CHECK (kind IN ('avatar', 'location', 'map', 'other')),
+	filename     text NOT NULL DEFAULT '',
+	content_type text NOT NULL,
+	size_bytes   integer NOT NULL,
+	width        integer NOT NULL,
+	height       integer NOT NULL,
+	storage_key  text NOT NULL,
+	thumb_key    text NOT NULL,
+	created_at   timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX images_project_id_idx ON images (project_id);
@@ -0,0 +1,39 @@
+-- Cartes : une image du projet, éventuellement rattachée à un lieu (la carte
+-- de ce lieu). Les cartes imbriquées suivent la hiérarchie des lieux.
+CREATE TABLE maps (
+	id          serial PRIMARY KEY,
+	public_id   uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	project_id  integer NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	name        text NOT NULL,
+	image_id    integer REFERENCES images(id) ON DELETE SET NULL,
+	location_id integer REFERENCES locations(id) ON DELETE SET NULL
+);
+
+CREATE INDEX maps_project_id_idx ON maps (project_id);
+-- Au plus une carte par lieu
+CREATE UNIQUE INDEX maps_location_id_idx ON maps (location_id) WHERE location_id IS NOT NULL;
+
+-- Épingles : coordonnées normalisées (0..1 depuis le coin haut-gauche)
+CREATE TABLE map_pins (
+	id          serial PRIMARY KEY,
+	public_id   uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	map_id      integer NOT NULL REFERENCES maps(id) ON DELETE CASCADE,
+	location_id integer NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+	x           double precision NOT NULL CHECK (x >= 0 AND x <= 1),
+	y           double precision NOT NULL CHECK (y >= 0 AND y <= 1),
+	label       text NOT NULL DEFAULT '',
+	UNIQUE (map_id, location_id)
+);
+
+-- Régions de factions : polygone [[x, y], ...] en coordonnées normalisées
+CREATE TABLE map_regions (
+	id         serial PRIMARY KEY,
+	public_id  uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	map_id     integer NOT NULL REFERENCES maps(id) ON DELETE CASCADE,
+	faction_id integer NOT NULL REFERENCES factions(id) ON DELETE CASCADE,
+	points     jsonb NOT NULL,
+	color      text NOT NULL DEFAULT '',
+	label      text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX map_regions_map_id_idx ON map_regions (map_id);
@@ -0,0 +1,23 @@
+-- Fils narratifs (intrigue principale, sous-intrigues...)
+CREATE TABLE plot_threads (
+	id          serial PRIMARY KEY,
+	public_id   uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	project_id  integer NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	name        text NOT NULL,
+	kind        text NOT NULL DEFAULT 'subplot' CHECK (kind IN ('main', 'subplot')),
+	description text NOT NULL DEFAULT '',
+	color       text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX plot_threads_project_id_idx ON plot_threads (project_id);
+
+-- Scènes d'un fil, avec l'état du fil dans la scène
+CREATE TABLE scene_plot_threads (
+	scene_id  integer NOT NULL REFERENCES scenes(id) ON DELETE CASCADE,
+	thread_id integer NOT NULL REFERENCES plot_threads(id) ON DELETE CASCADE,
+	status    text NOT NULL CHECK (status IN ('open', 'advanced', 'resolved')),
+	notes     text NOT NULL DEFAULT '',
+	PRIMARY KEY (scene_id, thread_id)
+);
+
+CREATE INDEX scene_plot_threads_thread_id_idx ON scene_plot_threads (thread_id);
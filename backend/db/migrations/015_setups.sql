@@ -0,0 +1,17 @@
+-- Préfigurations (setup) et leur résolution (payoff) dans une scène ultérieure
+CREATE TABLE setups (
+	id              serial PRIMARY KEY,
+	public_id       uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	project_id      integer NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	title           text NOT NULL,
+	notes           text NOT NULL DEFAULT '',
+	setup_scene_id  integer NOT NULL REFERENCES scenes(id) ON DELETE CASCADE,
+	-- NULL tant que la préfiguration n'est pas payée
+	payoff_scene_id integer REFERENCES scenes(id) ON DELETE SET NULL,
+	payoff_notes    text NOT NULL DEFAULT '',
+	CHECK (payoff_scene_id IS DISTINCT FROM setup_scene_id)
+);
+
+CREATE INDEX setups_project_id_idx ON setups (project_id);
+CREATE INDEX setups_setup_scene_id_idx ON setups (setup_scene_id);
+CREATE INDEX setups_payoff_scene_id_idx ON setups (payoff_scene_id);
@@ -0,0 +1,16 @@
+-- Points d'étape de l'arc d'un personnage, au plus un par chapitre
+CREATE TABLE character_arc_checkpoints (
+	id           serial PRIMARY KEY,
+	public_id    uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	character_id integer NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+	chapter_id   integer NOT NULL REFERENCES chapters(id) ON DELETE CASCADE,
+	belief       text NOT NULL DEFAULT '',
+	want         text NOT NULL DEFAULT '',
+	need         text NOT NULL DEFAULT '',
+	-- Où en est le personnage entre ce qu'il veut et ce dont il a besoin
+	state        text NOT NULL DEFAULT 'want' CHECK (state IN ('want', 'conflicted', 'need')),
+	notes        text NOT NULL DEFAULT '',
+	UNIQUE (character_id, chapter_id)
+);
+
+CREATE INDEX character_arc_checkpoints_chapter_id_idx ON character_arc_checkpoints (chapter_id);
@@ -0,0 +1,13 @@
+-- Codex du monde : termes (lieux, sorts, titres...) avec définition et alias
+CREATE TABLE codex_terms (
+	id         serial PRIMARY KEY,
+	public_id  uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	project_id integer NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	term       text NOT NULL,
+	definition text NOT NULL DEFAULT '',
+	category   text NOT NULL DEFAULT '',
+	aliases    text[] NOT NULL DEFAULT '{}'
+);
+
+-- Terme unique par projet, sans tenir compte de la casse
+CREATE UNIQUE INDEX codex_terms_project_term_idx ON codex_terms (project_id, lower(term));
@@ -0,0 +1,4 @@
+-- Projets modèles : un monde prêt à être dupliqué pour un nouveau livre
+ALTER TABLE projects ADD COLUMN is_template boolean NOT NULL DEFAULT false;
+
+CREATE INDEX projects_user_template_idx ON projects (user_id) WHERE is_template;
@@ -0,0 +1,54 @@
+-- Séries / mondes partagés : les personnages, lieux et factions partagés
+-- appartiennent au projet "monde" de la série (un projet ordinaire, éditable
+-- avec les routes existantes) et sont visibles depuis chaque livre de la série.
+CREATE TABLE series (
+	id               serial PRIMARY KEY,
+	public_id        uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	user_id          integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name             text NOT NULL,
+	description      text NOT NULL DEFAULT '',
+	world_project_id integer NOT NULL UNIQUE REFERENCES projects(id) ON DELETE CASCADE,
+	created_at       timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX series_user_id_idx ON series (user_id);
+
+-- Livres de la série (un projet appartient au plus à une série)
+ALTER TABLE projects ADD COLUMN series_id integer REFERENCES series(id) ON DELETE SET NULL;
+
+CREATE INDEX projects_series_id_idx ON projects (series_id);
+
+-- Projets dont les entités sont visibles depuis pid : lui-même et le monde
+-- de sa série
+CREATE FUNCTION project_scope(pid integer) RETURNS integer[]
+LANGUAGE sql STABLE AS $$
+	SELECT array_remove(ARRAY[pid, (
+		SELECT s.world_project_id
+		FROM projects p
+		JOIN series s ON s.id = p.series_id
+		WHERE p.id = pid
+	)], NULL)
+$$;
+
+-- Surcharges par livre des entités partagées (ex. l'âge d'un personnage dans
+-- le tome 2) : champs remplacés, custom_fields fusionnés clé par clé
+CREATE TABLE character_overrides (
+	project_id   integer NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	character_id integer NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+	fields       jsonb NOT NULL DEFAULT '{}',
+	PRIMARY KEY (project_id, character_id)
+);
+
+CREATE TABLE location_overrides (
+	project_id  integer NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	location_id integer NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+	fields      jsonb NOT NULL DEFAULT '{}',
+	PRIMARY KEY (project_id, location_id)
+);
+
+CREATE TABLE faction_overrides (
+	project_id integer NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	faction_id integer NOT NULL REFERENCES factions(id) ON DELETE CASCADE,
+	fields     jsonb NOT NULL DEFAULT '{}',
+	PRIMARY KEY (project_id, faction_id)
+);
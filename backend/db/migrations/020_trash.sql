@@ -0,0 +1,44 @@
+-- Corbeille : suppression logique des projets et de leurs entités. Chaque
+-- table devient <table>_all (toutes les lignes) et une vue du même nom ne
+-- montre que les lignes actives : les requêtes existantes (lecture comme
+-- écriture, la vue est modifiable) ignorent ainsi la corbeille.
+-- Attention pour les migrations suivantes :
+--   - une nouvelle colonne s'ajoute sur <table>_all puis la vue est recréée
+--     (SELECT * est figé à la création de la vue) ;
+--   - une nouvelle FK référence <table>_all (une vue ne peut pas être
+--     référencée).
+-- Les lignes supprimées ensemble (un chapitre et ses scènes, un sous-arbre
+-- de lieux) partagent la même valeur de deleted_at : elles sont restaurées
+-- ensemble (routes/trash).
+
+ALTER TABLE projects ADD COLUMN deleted_at timestamptz;
+ALTER TABLE projects RENAME TO projects_all;
+CREATE VIEW projects AS SELECT * FROM projects_all WHERE deleted_at IS NULL;
+CREATE INDEX projects_all_deleted_at_idx ON projects_all (deleted_at) WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE characters ADD COLUMN deleted_at timestamptz;
+ALTER TABLE characters RENAME TO characters_all;
+CREATE VIEW characters AS SELECT * FROM characters_all WHERE deleted_at IS NULL;
+CREATE INDEX characters_all_deleted_at_idx ON characters_all (deleted_at) WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE locations ADD COLUMN deleted_at timestamptz;
+ALTER TABLE locations RENAME TO locations_all;
+CREATE VIEW locations AS SELECT * FROM locations_all WHERE deleted_at IS NULL;
+CREATE INDEX locations_all_deleted_at_idx ON locations_all (deleted_at) WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE factions ADD COLUMN deleted_at timestamptz;
+ALTER TABLE factions RENAME TO factions_all;
+CREATE VIEW factions AS SELECT * FROM factions_all WHERE deleted_at IS NULL;
+CREATE INDEX factions_all_deleted_at_idx ON factions_all (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Un chapitre ou une scène à la corbeille prend order_index = -id : il sort
+-- de la numérotation 1..n sans heurter les contraintes d'unicité
+ALTER TABLE chapters ADD COLUMN deleted_at timestamptz;
+ALTER TABLE chapters RENAME TO chapters_all;
+CREATE VIEW chapters AS SELECT * FROM chapters_all WHERE deleted_at IS NULL;
+CREATE INDEX chapters_all_deleted_at_idx ON chapters_all (deleted_at) WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE scenes ADD COLUMN deleted_at timestamptz;
+ALTER TABLE scenes RENAME TO scenes_all;
+CREATE VIEW scenes AS SELECT * FROM scenes_all WHERE deleted_at IS NULL;
+CREATE INDEX scenes_all_deleted_at_idx ON scenes_all (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,34 @@
+-- Historique du texte des scènes : chaque modification de content crée une
+-- révision (les sauvegardes automatiques rapprochées d'un même auteur sont
+-- regroupées dans la dernière, voir routes/scenes/revisions.go)
+CREATE TABLE scene_revisions (
+	id            serial PRIMARY KEY,
+	public_id     uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	scene_id      integer NOT NULL REFERENCES scenes_all(id) ON DELETE CASCADE,
+	user_id       integer REFERENCES users(id) ON DELETE SET NULL,
+	content       text NOT NULL,
+	word_count    integer NOT NULL,
+	-- Mots gagnés (ou perdus) par rapport à la révision précédente
+	word_delta    integer NOT NULL,
+	-- Révision restaurée (la restauration crée une nouvelle révision)
+	restored_from integer REFERENCES scene_revisions(id) ON DELETE SET NULL,
+	created_at    timestamptz NOT NULL DEFAULT now(),
+	updated_at    timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX scene_revisions_scene_id_idx ON scene_revisions (scene_id, id);
+
+-- Révision de départ pour le texte existant, attribuée au propriétaire du
+-- projet (compte de mots approché de textutil.WordCount)
+INSERT INTO scene_revisions (scene_id, user_id, content, word_count, word_delta)
+SELECT s.id, p.user_id, s.content, w.n, w.n
+FROM scenes_all s
+JOIN chapters_all c ON c.id = s.chapter_id
+JOIN projects_all p ON p.id = c.project_id
+CROSS JOIN LATERAL (
+	SELECT COALESCE(array_length(regexp_split_to_array(
+		NULLIF(btrim(regexp_replace(s.content, '<[^>]*>', ' ', 'g'), E' \t\r\n'), ''),
+		'\s+'), 1), 0) AS n
+) w
+WHERE s.content <> ''
+ORDER BY s.id;
@@ -0,0 +1,23 @@
+-- Instantanés nommés d'un projet. Chaque instantané est une copie complète
+-- et figée du projet (routes/projects/duplicate.go : cartes, frise, images
+-- comprises), cachée des routes habituelles, d'où l'on restaure un nouveau
+-- projet. L'état FullProject du moment est gardé à part pour la comparaison
+-- avec l'état courant.
+
+-- Copie figée : supprimée avec son projet d'origine
+ALTER TABLE projects_all ADD COLUMN snapshot_of integer REFERENCES projects_all(id) ON DELETE CASCADE;
+
+CREATE INDEX projects_all_snapshot_of_idx ON projects_all (snapshot_of) WHERE snapshot_of IS NOT NULL;
+
+-- La vue (voir 020_trash.sql) expose la colonne et cache les copies
+CREATE OR REPLACE VIEW projects AS
+SELECT * FROM projects_all WHERE deleted_at IS NULL AND snapshot_of IS NULL;
+
+CREATE TABLE project_snapshots (
+	id              serial PRIMARY KEY,
+	public_id       uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	copy_project_id integer NOT NULL UNIQUE REFERENCES projects_all(id) ON DELETE CASCADE,
+	name            text NOT NULL,
+	state           jsonb NOT NULL,
+	created_at      timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,12 @@
+-- Entités du monde d'une série figées dans la copie d'un instantané (voir
+-- routes/projects/duplicate.go) : la copie ne suit plus le monde, qui peut
+-- être modifié ou supprimé avec sa série. shared_id garde l'entité
+-- d'origine, reprise à la restauration si elle existe encore (sans clé
+-- étrangère : elle peut avoir disparu).
+CREATE TABLE snapshot_shared (
+	copy_project_id integer NOT NULL REFERENCES projects_all(id) ON DELETE CASCADE,
+	kind            text NOT NULL CHECK (kind IN ('character', 'location', 'faction')),
+	frozen_id       integer NOT NULL,
+	shared_id       integer NOT NULL,
+	PRIMARY KEY (copy_project_id, kind, frozen_id)
+);
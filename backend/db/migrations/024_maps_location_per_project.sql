@@ -0,0 +1,4 @@
+-- Au plus une carte par lieu et par projet : un lieu partagé du monde d'une
+-- série peut avoir sa carte dans chaque livre
+DROP INDEX IF EXISTS maps_location_id_idx;
+CREATE UNIQUE INDEX maps_location_id_idx ON maps (project_id, location_id) WHERE location_id IS NOT NULL;
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RewriteOrder réécrit order_index (1..n) pour les lignes ids de table, dans
+// l'ordre donné, en une seule requête. table est toujours une constante du
+// code appelant, jamais une valeur venant du client.
+func RewriteOrder(ctx context.Context, tx pgx.Tx, table string, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx, `
+		UPDATE `+table+` t
+		SET order_index = v.idx
+		FROM unnest($1::int[]) WITH ORDINALITY AS v(id, idx)
+		WHERE t.id = v.id
+	`, ids)
+	return err
+}
+
+// LockProject pose un verrou ligne sur le projet : sérialise les
+// réordonnancements concurrents (deux drag & drop simultanés).
+func LockProject(ctx context.Context, tx pgx.Tx, projectID int) error {
+	_, err := tx.Exec(ctx, `SELECT 1 FROM projects WHERE id = $1 FOR UPDATE`, projectID)
+	return err
+}
+
+// MoveID déplace id à la position pos (1-based, bornée) dans ids.
+func MoveID(ids []int, id, pos int) []int {
+	out := make([]int, 0, len(ids))
+	for _, v := range ids {
+		if v != id {
+			out = append(out, v)
+		}
+	}
+	if pos < 1 {
+		pos = 1
+	}
+	if pos > len(out)+1 {
+		pos = len(out) + 1
+	}
+	out = append(out, 0)
+	copy(out[pos:], out[pos-1:])
+	out[pos-1] = id
+	return out
+}
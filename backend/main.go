@@ -11,6 +11,8 @@ import (
 
 	"backend/db"
 	"backend/routes"
+	"backend/routes/trash"
+	"backend/storage"
 
 	"github.com/joho/godotenv"
 )
@@ -31,6 +33,12 @@ func main() {
 	// si tu as db.Close(), pense à le defer ici :
 	// defer db.Close()
 
+	// Stockage des images (local par défaut, S3 si STORAGE_DRIVER=s3)
+	storage.Init()
+
+	// Purge planifiée de la corbeille (TRASH_RETENTION_DAYS, 30 par défaut)
+	trash.StartPurge()
+
 	// Router (inclut CORS si ENABLE_CORS=true)
 	r := routes.Router()
 
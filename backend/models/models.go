@@ -23,33 +23,42 @@ type Project struct {
 	Title        string    `json:"title"`
 	Description  string    `json:"description"`
 	StoryModelID *int      `json:"story_model_id,omitempty"`
+	IsTemplate   bool      `json:"is_template"`
 	CreatedAt    time.Time `json:"created_at"`
 }
 
 type Character struct {
-	ID               int       `json:"-"`
-	PublicID         uuid.UUID `json:"id"`
-	ProjectID        int       `json:"project_id"`
-	Name             string    `json:"name"`
-	Role             string    `json:"role"`
-	Bio              string    `json:"bio"`
-	Background       string    `json:"background"`
-	Personality      string    `json:"personality"`
-	Objective        string    `json:"objective"`
-	InternalConflict string    `json:"internal_conflict"`
-	ArcType          string    `json:"arc_type"`
-	Notes            string    `json:"notes"`
-	AvatarURL        string    `json:"avatar_url"`
+	ID               int            `json:"-"`
+	PublicID         uuid.UUID      `json:"id"`
+	ProjectID        int            `json:"project_id"`
+	Name             string         `json:"name"`
+	Role             string         `json:"role"`
+	Bio              string         `json:"bio"`
+	Background       string         `json:"background"`
+	Personality      string         `json:"personality"`
+	Objective        string         `json:"objective"`
+	InternalConflict string         `json:"internal_conflict"`
+	ArcType          string         `json:"arc_type"`
+	Notes            string         `json:"notes"`
+	AvatarURL        string         `json:"avatar_url"`
+	CustomFields     map[string]any `json:"custom_fields"`
+	// Entité du monde de la série (payload /full), avec les surcharges du livre
+	Shared    bool           `json:"shared,omitempty"`
+	Overrides map[string]any `json:"overrides,omitempty"`
 }
 
 type Location struct {
-	ID           int       `json:"-"`
-	PublicID     uuid.UUID `json:"id"`
-	ProjectID    int       `json:"project_id"`
-	Name         string    `json:"name"`
-	Description  string    `json:"description"`
-	MapReference string    `json:"map_reference"`
-	ImageURL     string    `json:"image_url"`
+	ID           int            `json:"-"`
+	PublicID     uuid.UUID      `json:"id"`
+	ProjectID    int            `json:"project_id"`
+	Name         string         `json:"name"`
+	Description  string         `json:"description"`
+	MapReference string         `json:"map_reference"`
+	ImageURL     string         `json:"image_url"`
+	ParentID     *uuid.UUID     `json:"parent_id,omitempty"`
+	CustomFields map[string]any `json:"custom_fields"`
+	Shared       bool           `json:"shared,omitempty"`
+	Overrides    map[string]any `json:"overrides,omitempty"`
 }
 
 type Chapter struct {
@@ -72,22 +81,338 @@ type Scene struct {
 	Summary         string    `json:"summary"`
 	LocationID      *int      `json:"location_id,omitempty"`
 	OrderIndex      int       `json:"order_index"`
+	StoryDay        *int64    `json:"story_day,omitempty"` // date in-world (jour absolu du projet)
+}
+
+type SceneParticipant struct {
+	SceneID     uuid.UUID `json:"scene_id"`
+	CharacterID uuid.UUID `json:"character_id"`
+	Role        string    `json:"role"` // pov, present, mentioned
+}
+
+// SceneRevision : état du texte d'une scène après une modification.
+// UpdatedAt avance quand des sauvegardes rapprochées y sont regroupées.
+type SceneRevision struct {
+	ID           int        `json:"-"`
+	PublicID     uuid.UUID  `json:"id"`
+	SceneID      uuid.UUID  `json:"scene_id"`
+	AuthorID     *uuid.UUID `json:"author_id,omitempty"`
+	Author       string     `json:"author"`
+	Content      string     `json:"content,omitempty"` // absent des listes
+	WordCount    int        `json:"word_count"`
+	WordDelta    int        `json:"word_delta"`
+	RestoredFrom *uuid.UUID `json:"restored_from,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
 type Faction struct {
+	ID           int            `json:"-"`
+	PublicID     uuid.UUID      `json:"id"`
+	ProjectID    int            `json:"project_id"`
+	Name         string         `json:"name"`
+	Description  string         `json:"description"`
+	Color        string         `json:"color"`
+	CustomFields map[string]any `json:"custom_fields"`
+	Shared       bool           `json:"shared,omitempty"`
+	Overrides    map[string]any `json:"overrides,omitempty"`
+}
+
+type FactionMember struct {
+	ID             int        `json:"-"`
+	PublicID       uuid.UUID  `json:"id"`
+	FactionID      uuid.UUID  `json:"faction_id"`
+	CharacterID    uuid.UUID  `json:"character_id"`
+	Rank           *int       `json:"rank,omitempty"`
+	Title          string     `json:"title"`
+	StartChapterID *uuid.UUID `json:"start_chapter_id,omitempty"`
+	EndChapterID   *uuid.UUID `json:"end_chapter_id,omitempty"`
+}
+
+type Relationship struct {
+	ID              int        `json:"-"`
+	PublicID        uuid.UUID  `json:"id"`
+	FromCharacterID uuid.UUID  `json:"from_character_id"`
+	ToCharacterID   uuid.UUID  `json:"to_character_id"`
+	Type            string     `json:"type"`
+	Notes           string     `json:"notes"`
+	ChangeChapterID *uuid.UUID `json:"change_chapter_id,omitempty"`
+}
+
+type Calendar struct {
+	ID            int             `json:"-"`
+	PublicID      uuid.UUID       `json:"id"`
+	ProjectID     int             `json:"project_id"`
+	Name          string          `json:"name"`
+	Months        []CalendarMonth `json:"months"`
+	Weekdays      []string        `json:"weekdays"`
+	Eras          []CalendarEra   `json:"eras"`
+	EpochOffset   int64           `json:"epoch_offset"`   // jour absolu du 1er jour de l'an 1
+	WeekdayOffset int             `json:"weekday_offset"` // jour de la semaine de ce 1er jour
+}
+
+type CalendarMonth struct {
+	Name string `json:"name"`
+	Days int    `json:"days"`
+}
+
+type CalendarEra struct {
+	Name      string `json:"name"`
+	StartYear int    `json:"start_year"` // année (absolue) où commence l'an 1 de l'ère
+}
+
+type StoryDate struct {
+	Era       int    `json:"era"` // index dans Calendar.Eras
+	EraName   string `json:"era_name,omitempty"`
+	Year      int    `json:"year"`
+	Month     int    `json:"month"` // 1..len(Months)
+	MonthName string `json:"month_name,omitempty"`
+	Day       int    `json:"day"`
+	Weekday   string `json:"weekday,omitempty"`
+}
+
+type TimelineEvent struct {
+	ID          int        `json:"-"`
+	PublicID    uuid.UUID  `json:"id"`
+	ProjectID   int        `json:"project_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Day         int64      `json:"day"`
+	CalendarID  *uuid.UUID `json:"calendar_id,omitempty"`
+	Date        *StoryDate `json:"date,omitempty"`
+}
+
+type StoryModel struct {
+	ID          int          `json:"id"`
+	UserID      *int         `json:"user_id,omitempty"` // nil = modèle intégré
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Phases      []StoryPhase `json:"phases"`
+}
+
+type StoryPhase struct {
+	ID           int     `json:"id"`
+	StoryModelID int     `json:"story_model_id"`
+	Name         string  `json:"name"`
+	Description  string  `json:"description"`
+	Color        string  `json:"color"`
+	Position     float64 `json:"position"` // % attendu dans l'histoire (0-100)
+	OrderIndex   int     `json:"order_index"`
+}
+
+// CustomFieldDefinition : champ personnalisé d'un type d'entité du projet.
+// Les valeurs sont stockées dans custom_fields de l'entité, indexées par Key.
+type CustomFieldDefinition struct {
+	ID         int       `json:"-"`
+	PublicID   uuid.UUID `json:"id"`
+	ProjectID  int       `json:"project_id"`
+	EntityType string    `json:"entity_type"` // character, location, faction
+	Key        string    `json:"key"`
+	Label      string    `json:"label"`
+	FieldType  string    `json:"field_type"` // text, number, date, enum, reference
+	Options    []string  `json:"options"`    // valeurs possibles (enum)
+	RefType    string    `json:"ref_type"`   // entité référencée (reference)
+	Required   bool      `json:"required"`
+	OrderIndex int       `json:"order_index"`
+}
+
+type Tag struct {
+	ID        int            `json:"-"`
+	PublicID  uuid.UUID      `json:"id"`
+	ProjectID int            `json:"project_id"`
+	Name      string         `json:"name"`
+	Color     string         `json:"color"`
+	Count     int            `json:"count"`  // nombre total d'entités taguées
+	Counts    map[string]int `json:"counts"` // par type d'entité
+}
+
+// EntityTag : un tag posé sur une entité (character, location, faction,
+// chapter ou scene).
+type EntityTag struct {
+	TagID      uuid.UUID `json:"tag_id"`
+	EntityType string    `json:"entity_type"`
+	EntityID   uuid.UUID `json:"entity_id"`
+}
+
+// Image : fichier envoyé ; URL et ThumbURL sont servis par /api/images et
+// réservés au propriétaire du projet.
+type Image struct {
+	ID          int       `json:"-"`
+	PublicID    uuid.UUID `json:"id"`
+	ProjectID   int       `json:"project_id"`
+	Kind        string    `json:"kind"` // avatar, location, map, other
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int       `json:"size_bytes"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	StorageKey  string    `json:"-"`
+	ThumbKey    string    `json:"-"`
+	URL         string    `json:"url"`
+	ThumbURL    string    `json:"thumb_url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Map : carte du projet ; LocationID = lieu représenté, ParentMapID = carte
+// du plus proche lieu ancêtre qui en a une.
+type Map struct {
+	ID          int        `json:"-"`
+	PublicID    uuid.UUID  `json:"id"`
+	ProjectID   int        `json:"project_id"`
+	Name        string     `json:"name"`
+	ImageID     *uuid.UUID `json:"image_id"`
+	ImageURL    string     `json:"image_url"`
+	ThumbURL    string     `json:"thumb_url"`
+	Width       int        `json:"width"`
+	Height      int        `json:"height"`
+	LocationID  *uuid.UUID `json:"location_id"`
+	ParentMapID *uuid.UUID `json:"parent_map_id,omitempty"`
+}
+
+// MapPin : lieu épinglé ; ChildMapID = carte de ce lieu, si elle existe.
+type MapPin struct {
+	ID           int        `json:"-"`
+	PublicID     uuid.UUID  `json:"id"`
+	MapID        uuid.UUID  `json:"map_id"`
+	LocationID   uuid.UUID  `json:"location_id"`
+	LocationName string     `json:"location_name"`
+	X            float64    `json:"x"`
+	Y            float64    `json:"y"`
+	Label        string     `json:"label"`
+	ChildMapID   *uuid.UUID `json:"child_map_id,omitempty"`
+}
+
+type MapRegion struct {
+	ID          int          `json:"-"`
+	PublicID    uuid.UUID    `json:"id"`
+	MapID       uuid.UUID    `json:"map_id"`
+	FactionID   uuid.UUID    `json:"faction_id"`
+	FactionName string       `json:"faction_name"`
+	Points      [][2]float64 `json:"points"`
+	Color       string       `json:"color"`
+	Label       string       `json:"label"`
+}
+
+// PlotThread : fil narratif (intrigue principale ou sous-intrigue).
+type PlotThread struct {
 	ID          int       `json:"-"`
 	PublicID    uuid.UUID `json:"id"`
 	ProjectID   int       `json:"project_id"`
 	Name        string    `json:"name"`
+	Kind        string    `json:"kind"` // main, subplot
 	Description string    `json:"description"`
 	Color       string    `json:"color"`
 }
 
+// ScenePlotThread : présence d'un fil dans une scène et son état à ce point.
+type ScenePlotThread struct {
+	SceneID  uuid.UUID `json:"scene_id"`
+	ThreadID uuid.UUID `json:"thread_id"`
+	Status   string    `json:"status"` // open, advanced, resolved
+	Notes    string    `json:"notes"`
+}
+
+// Setup : préfiguration posée dans une scène, payée (PayoffSceneID) dans une
+// autre.
+type Setup struct {
+	ID            int        `json:"-"`
+	PublicID      uuid.UUID  `json:"id"`
+	ProjectID     int        `json:"project_id"`
+	Title         string     `json:"title"`
+	Notes         string     `json:"notes"`
+	SetupSceneID  uuid.UUID  `json:"setup_scene_id"`
+	PayoffSceneID *uuid.UUID `json:"payoff_scene_id"`
+	PayoffNotes   string     `json:"payoff_notes"`
+}
+
+// ArcCheckpoint : état de l'arc d'un personnage à un chapitre donné.
+type ArcCheckpoint struct {
+	ID          int       `json:"-"`
+	PublicID    uuid.UUID `json:"id"`
+	CharacterID uuid.UUID `json:"character_id"`
+	ChapterID   uuid.UUID `json:"chapter_id"`
+	Belief      string    `json:"belief"`
+	Want        string    `json:"want"`
+	Need        string    `json:"need"`
+	State       string    `json:"state"` // want, conflicted, need
+	Notes       string    `json:"notes"`
+}
+
+// CodexTerm : terme du monde ; Aliases sont aussi reconnus dans le texte.
+type CodexTerm struct {
+	ID         int       `json:"-"`
+	PublicID   uuid.UUID `json:"id"`
+	ProjectID  int       `json:"project_id"`
+	Term       string    `json:"term"`
+	Definition string    `json:"definition"`
+	Category   string    `json:"category"`
+	Aliases    []string  `json:"aliases"`
+}
+
+// Series : livres partageant un monde. Les entités partagées appartiennent
+// au projet WorldProjectID.
+type Series struct {
+	ID             int         `json:"-"`
+	PublicID       uuid.UUID   `json:"id"`
+	UserID         int         `json:"user_id"`
+	Name           string      `json:"name"`
+	Description    string      `json:"description"`
+	WorldProjectID uuid.UUID   `json:"world_project_id"`
+	Projects       []uuid.UUID `json:"projects"`
+	CreatedAt      time.Time   `json:"created_at"`
+}
+
+// EntityOverride : champs d'une entité partagée remplacés dans un livre.
+type EntityOverride struct {
+	EntityType string         `json:"entity_type"`
+	EntityID   uuid.UUID      `json:"entity_id"`
+	Fields     map[string]any `json:"fields"`
+}
+
 type FullProject struct {
-	Project    Project     `json:"project"`
-	Characters []Character `json:"characters"`
-	Locations  []Location  `json:"locations"`
-	Chapters   []Chapter   `json:"chapters"`
-	Scenes     []Scene     `json:"scenes"`
-	Factions   []Faction   `json:"factions"`
+	Project           Project                 `json:"project"`
+	Characters        []Character             `json:"characters"`
+	Locations         []Location              `json:"locations"`
+	Chapters          []Chapter               `json:"chapters"`
+	Scenes            []Scene                 `json:"scenes"`
+	Factions          []Faction               `json:"factions"`
+	FactionMembers    []FactionMember         `json:"faction_members"`
+	Relationships     []Relationship          `json:"relationships"`
+	SceneParticipants []SceneParticipant      `json:"scene_participants"`
+	StoryModel        *StoryModel             `json:"story_model,omitempty"`
+	CustomFields      []CustomFieldDefinition `json:"custom_fields"`
+	Tags              []Tag                   `json:"tags"`
+	EntityTags        []EntityTag             `json:"entity_tags"`
+	PlotThreads       []PlotThread            `json:"plot_threads"`
+	ScenePlotThreads  []ScenePlotThread       `json:"scene_plot_threads"`
+	Setups            []Setup                 `json:"setups"`
+	ArcCheckpoints    []ArcCheckpoint         `json:"arc_checkpoints"`
+	CodexTerms        []CodexTerm             `json:"codex_terms"`
+	Series            *Series                 `json:"series,omitempty"`
+}
+
+// ProjectState : FullProject complété de ce qu'un instantané doit aussi
+// retrouver (calendriers, cartes, images, historique des scènes, surcharges).
+// Les révisions sont enregistrées sans leur texte.
+type ProjectState struct {
+	FullProject
+	Calendars      []Calendar       `json:"calendars"`
+	TimelineEvents []TimelineEvent  `json:"timeline_events"`
+	Maps           []Map            `json:"maps"`
+	MapPins        []MapPin         `json:"map_pins"`
+	MapRegions     []MapRegion      `json:"map_regions"`
+	Images         []Image          `json:"images"`
+	SceneRevisions []SceneRevision  `json:"scene_revisions"`
+	Overrides      []EntityOverride `json:"overrides"`
+}
+
+// ProjectSnapshot : instantané nommé d'un projet ; State est l'état complet
+// du projet au moment de l'instantané (absent des listes).
+type ProjectSnapshot struct {
+	ID        int           `json:"-"`
+	PublicID  uuid.UUID     `json:"id"`
+	ProjectID uuid.UUID     `json:"project_id"`
+	Name      string        `json:"name"`
+	State     *ProjectState `json:"state,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
 }
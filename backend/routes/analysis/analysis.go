@@ -0,0 +1,225 @@
+package analysis
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+
+	"backend/db"
+	"backend/routes/auth"
+	"backend/routes/storymodels"
+	"backend/textutil"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/project/{projectUUID}/beats", getBeats)
+
+	return r
+}
+
+// Écart toléré (en points de %) entre position réelle et position cible
+const defaultTolerance = 5.0
+
+// Flags d'une phase dans le rapport
+const (
+	flagMissing    = "missing"
+	flagOutOfOrder = "out_of_order"
+	flagDrifted    = "drifted"
+)
+
+type phaseReport struct {
+	PhaseID    int         `json:"phase_id"`
+	Name       string      `json:"name"`
+	OrderIndex int         `json:"order_index"`
+	Target     float64     `json:"target"`
+	Actual     *float64    `json:"actual"`     // début de la phase, en %
+	ActualEnd  *float64    `json:"actual_end"` // fin de la phase, en %
+	Drift      *float64    `json:"drift"`      // actual - target
+	Words      int         `json:"words"`
+	Chapters   []uuid.UUID `json:"chapters"`
+	Flags      []string    `json:"flags"`
+}
+
+type beatReport struct {
+	StoryModelID int           `json:"story_model_id"`
+	Basis        string        `json:"basis"` // "words", ou "chapters" si aucune scène n'est écrite
+	TotalWords   int           `json:"total_words"`
+	Tolerance    float64       `json:"tolerance"`
+	Phases       []phaseReport `json:"phases"`
+}
+
+type chapterWords struct {
+	PublicID     uuid.UUID
+	StoryPhaseID *int
+	Words        int
+}
+
+// chapterWordCounts : chapitres du projet dans l'ordre de lecture, avec le
+// nombre de mots de leurs scènes.
+func chapterWordCounts(ctx context.Context, projectID int) ([]chapterWords, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT c.id, c.public_id, c.story_phase_id, COALESCE(s.content, '')
+		FROM chapters c
+		LEFT JOIN scenes s ON s.chapter_id = c.id
+		WHERE c.project_id = $1
+		ORDER BY c.order_index ASC, c.id ASC, s.order_index ASC, s.id ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []chapterWords
+	lastID := 0
+	for rows.Next() {
+		var id int
+		var c chapterWords
+		var content string
+		if err := rows.Scan(&id, &c.PublicID, &c.StoryPhaseID, &content); err != nil {
+			return nil, err
+		}
+		if id != lastID {
+			list = append(list, c)
+			lastID = id
+		}
+		list[len(list)-1].Words += textutil.WordCount(content)
+	}
+	return list, rows.Err()
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// getBeats compare la position réelle de chaque phase du modèle (en % du
+// manuscrit) à sa position cible, et signale les phases absentes, hors
+// d'ordre ou trop décalées (?tolerance=<points>, 5 par défaut).
+func getBeats(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tolerance := defaultTolerance
+	if v := r.URL.Query().Get("tolerance"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t < 0 {
+			http.Error(w, "invalid tolerance", http.StatusBadRequest)
+			return
+		}
+		tolerance = t
+	}
+
+	var storyModelID *int
+	if err := db.Pool.QueryRow(ctx, `
+		SELECT story_model_id FROM projects WHERE id = $1
+	`, projectID).Scan(&storyModelID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if storyModelID == nil {
+		http.Error(w, "project has no story model", http.StatusConflict)
+		return
+	}
+
+	phases, err := storymodels.PhasesByModel(ctx, db.Pool, *storyModelID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	chapters, err := chapterWordCounts(ctx, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	report := beatReport{
+		StoryModelID: *storyModelID,
+		Basis:        "words",
+		Tolerance:    tolerance,
+		Phases:       make([]phaseReport, 0, len(phases)),
+	}
+	for _, c := range chapters {
+		report.TotalWords += c.Words
+	}
+
+	// Étendue [start, end) de chaque chapitre, en mots ou en chapitres
+	total := float64(report.TotalWords)
+	if report.TotalWords == 0 {
+		report.Basis = "chapters"
+		total = float64(len(chapters))
+	}
+	type span struct{ start, end float64 }
+	spans := make([]span, len(chapters))
+	offset := 0.0
+	for i, c := range chapters {
+		size := float64(c.Words)
+		if report.Basis == "chapters" {
+			size = 1
+		}
+		spans[i] = span{offset, offset + size}
+		offset += size
+	}
+
+	maxStart := -1.0
+	for _, ph := range phases {
+		pr := phaseReport{
+			PhaseID:    ph.ID,
+			Name:       ph.Name,
+			OrderIndex: ph.OrderIndex,
+			Target:     ph.Position,
+			Chapters:   []uuid.UUID{},
+			Flags:      []string{},
+		}
+
+		start, end := math.Inf(1), math.Inf(-1)
+		for i, c := range chapters {
+			if c.StoryPhaseID == nil || *c.StoryPhaseID != ph.ID {
+				continue
+			}
+			pr.Chapters = append(pr.Chapters, c.PublicID)
+			pr.Words += c.Words
+			start = math.Min(start, spans[i].start)
+			end = math.Max(end, spans[i].end)
+		}
+
+		if len(pr.Chapters) == 0 || total == 0 {
+			pr.Flags = append(pr.Flags, flagMissing)
+			report.Phases = append(report.Phases, pr)
+			continue
+		}
+
+		actual := round1(start / total * 100)
+		actualEnd := round1(end / total * 100)
+		drift := round1(actual - ph.Position)
+		pr.Actual, pr.ActualEnd, pr.Drift = &actual, &actualEnd, &drift
+
+		// Une phase qui commence avant une phase précédente du modèle
+		if start < maxStart {
+			pr.Flags = append(pr.Flags, flagOutOfOrder)
+		}
+		maxStart = math.Max(maxStart, start)
+
+		if math.Abs(drift) > tolerance {
+			pr.Flags = append(pr.Flags, flagDrifted)
+		}
+
+		report.Phases = append(report.Phases, pr)
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
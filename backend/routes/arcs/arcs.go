@@ -0,0 +1,434 @@
+package arcs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/project/{projectUUID}/report", getReport) // personnages sans étape dans l'acte final
+	r.Get("/character/{uuid}", getArc)                // arc ordonné + avertissements
+	r.Post("/character/{uuid}", upsertCheckpoint)     // une étape par chapitre : remplace l'existante
+	r.Put("/{uuid}", updateCheckpoint)
+	r.Delete("/{uuid}", deleteCheckpoint)
+
+	return r
+}
+
+var validStates = map[string]bool{
+	"want":       true,
+	"conflicted": true,
+	"need":       true,
+}
+
+type checkpointInput struct {
+	ChapterID uuid.UUID `json:"chapter_id"`
+	Belief    string    `json:"belief"`
+	Want      string    `json:"want"`
+	Need      string    `json:"need"`
+	State     string    `json:"state"`
+	Notes     string    `json:"notes"`
+}
+
+func (in *checkpointInput) validate() error {
+	in.State = strings.ToLower(strings.TrimSpace(in.State))
+	if in.State == "" {
+		in.State = "want"
+	}
+	if !validStates[in.State] {
+		return errors.New("state must be want, conflicted or need")
+	}
+	return nil
+}
+
+var (
+	errInvalidChapter = errors.New("invalid chapter_id")
+	errChapterTaken   = errors.New("this character already has a checkpoint in this chapter")
+)
+
+// Avertissement : l'arc n'a aucune étape dans l'acte final
+const warnNoFinalActCheckpoint = "no_final_act_checkpoint"
+
+const checkpointSelect = `
+	SELECT a.id, a.public_id, ch.public_id, c.public_id, a.belief, a.want, a.need, a.state, a.notes
+	FROM character_arc_checkpoints a
+	JOIN characters ch ON ch.id = a.character_id
+	JOIN chapters c ON c.id = a.chapter_id`
+
+func scanCheckpoint(row pgx.Row) (models.ArcCheckpoint, error) {
+	var a models.ArcCheckpoint
+	err := row.Scan(&a.ID, &a.PublicID, &a.CharacterID, &a.ChapterID,
+		&a.Belief, &a.Want, &a.Need, &a.State, &a.Notes)
+	return a, err
+}
+
+func listCheckpoints(ctx context.Context, q db.Querier, where string, arg any) ([]models.ArcCheckpoint, error) {
+	rows, err := q.Query(ctx, checkpointSelect+`
+		WHERE `+where+`
+		ORDER BY ch.id ASC, c.order_index ASC, c.id ASC`, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.ArcCheckpoint{}
+	for rows.Next() {
+		a, err := scanCheckpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// CheckpointsByProject : étapes d'arc posées sur les chapitres du projet,
+// personnages partagés compris (payload /full).
+func CheckpointsByProject(ctx context.Context, q db.Querier, projectID int) ([]models.ArcCheckpoint, error) {
+	return listCheckpoints(ctx, q, `c.project_id = $1`, projectID)
+}
+
+// ownedCharacter retrouve (id, project_id) d'un personnage du propriétaire.
+func ownedCharacter(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (id, projectID int, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT c.id, c.project_id
+		FROM characters c
+		JOIN projects p ON p.id = c.project_id
+		WHERE c.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&id, &projectID)
+	return id, projectID, err
+}
+
+// ownedCheckpoint retrouve (id, character_id, project_id) d'une étape du
+// propriétaire.
+func ownedCheckpoint(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (id, characterID, projectID int, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT a.id, ch.id, ch.project_id
+		FROM character_arc_checkpoints a
+		JOIN characters ch ON ch.id = a.character_id
+		JOIN projects p ON p.id = ch.project_id
+		WHERE a.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&id, &characterID, &projectID)
+	return id, characterID, projectID, err
+}
+
+// projectChapter : chapitre du projet du personnage, ou d'un livre de la
+// série quand le personnage est partagé.
+func projectChapter(ctx context.Context, q db.Querier, pub uuid.UUID, projectID int) (int, error) {
+	var id int
+	err := q.QueryRow(ctx, `
+		SELECT id FROM chapters WHERE public_id = $1 AND $2 = ANY (project_scope(project_id))
+	`, pub, projectID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, errInvalidChapter
+	}
+	return id, err
+}
+
+func writeCheckpointError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidChapter):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errChapterTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// finalActParam lit ?final_act=<pourcentage> (75 par défaut), début de
+// l'acte final d'un projet sans modèle narratif.
+func finalActParam(r *http.Request) (float64, bool) {
+	v := r.URL.Query().Get("final_act")
+	if v == "" {
+		return defaultFinalActStart, true
+	}
+	start, err := strconv.ParseFloat(v, 64)
+	if err != nil || start < 0 || start > 100 {
+		return 0, false
+	}
+	return start, true
+}
+
+// arcEntry : une étape de l'arc avec sa place dans le manuscrit.
+type arcEntry struct {
+	models.ArcCheckpoint
+	ChapterTitle string `json:"chapter_title"`
+	ChapterOrder int    `json:"chapter_order"`
+	InFinalAct   bool   `json:"in_final_act"`
+}
+
+type arcResponse struct {
+	CharacterID      uuid.UUID  `json:"character_id"`
+	ArcType          string     `json:"arc_type"`
+	InternalConflict string     `json:"internal_conflict"`
+	Checkpoints      []arcEntry `json:"checkpoints"`
+	FinalAct         finalAct   `json:"final_act"`
+	Warnings         []string   `json:"warnings"`
+}
+
+// buildArc : étapes du personnage dans l'ordre des chapitres, situées par
+// rapport à l'acte final.
+func buildArc(ctx context.Context, q db.Querier, characterID int, fa finalAct) (arcResponse, error) {
+	var resp arcResponse
+	if err := q.QueryRow(ctx, `
+		SELECT public_id, arc_type, internal_conflict FROM characters WHERE id = $1
+	`, characterID).Scan(&resp.CharacterID, &resp.ArcType, &resp.InternalConflict); err != nil {
+		return resp, err
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT a.id, a.public_id, ch.public_id, c.public_id, a.belief, a.want, a.need, a.state, a.notes,
+		       c.title, c.order_index
+		FROM character_arc_checkpoints a
+		JOIN characters ch ON ch.id = a.character_id
+		JOIN chapters c ON c.id = a.chapter_id
+		WHERE a.character_id = $1
+		ORDER BY c.order_index ASC, c.id ASC`, characterID)
+	if err != nil {
+		return resp, err
+	}
+	defer rows.Close()
+
+	resp.Checkpoints = []arcEntry{}
+	resp.FinalAct = fa
+	inFinal := fa.contains()
+	for rows.Next() {
+		var e arcEntry
+		if err := rows.Scan(&e.ID, &e.PublicID, &e.CharacterID, &e.ChapterID,
+			&e.Belief, &e.Want, &e.Need, &e.State, &e.Notes,
+			&e.ChapterTitle, &e.ChapterOrder); err != nil {
+			return resp, err
+		}
+		e.InFinalAct = inFinal[e.ChapterID]
+		resp.Checkpoints = append(resp.Checkpoints, e)
+	}
+	if err := rows.Err(); err != nil {
+		return resp, err
+	}
+
+	resp.Warnings = arcWarnings(resp.Checkpoints)
+	return resp, nil
+}
+
+func arcWarnings(entries []arcEntry) []string {
+	warnings := []string{}
+	if len(entries) == 0 {
+		return warnings
+	}
+	for _, e := range entries {
+		if e.InFinalAct {
+			return warnings
+		}
+	}
+	return append(warnings, warnNoFinalActCheckpoint)
+}
+
+// getArc : l'arc du personnage, étape par étape (?final_act=<pourcentage>
+// pour un projet sans modèle).
+func getArc(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+	start, ok := finalActParam(r)
+	if !ok {
+		http.Error(w, "invalid final_act", http.StatusBadRequest)
+		return
+	}
+
+	id, projectID, err := ownedCharacter(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fa, err := loadFinalAct(ctx, db.Pool, projectID, start)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp, err := buildArc(ctx, db.Pool, id, fa)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// upsertCheckpoint crée l'étape du personnage pour le chapitre, ou la
+// remplace si elle existe déjà.
+func upsertCheckpoint(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body checkpointInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	characterID, projectID, err := ownedCharacter(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	chapterID, err := projectChapter(ctx, db.Pool, body.ChapterID, projectID)
+	if err != nil {
+		writeCheckpointError(w, err)
+		return
+	}
+
+	var id int
+	if err := db.Pool.QueryRow(ctx, `
+		INSERT INTO character_arc_checkpoints (character_id, chapter_id, belief, want, need, state, notes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (character_id, chapter_id) DO UPDATE
+		SET belief = EXCLUDED.belief, want = EXCLUDED.want, need = EXCLUDED.need,
+		    state = EXCLUDED.state, notes = EXCLUDED.notes
+		RETURNING id`,
+		characterID, chapterID, body.Belief, body.Want, body.Need, body.State, body.Notes).Scan(&id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	a, err := scanCheckpoint(db.Pool.QueryRow(ctx, checkpointSelect+` WHERE a.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a)
+}
+
+// updateCheckpoint : changer de chapitre vers un chapitre qui a déjà une
+// étape est refusé (409).
+func updateCheckpoint(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body checkpointInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, characterID, projectID, err := ownedCheckpoint(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	chapterID, err := projectChapter(ctx, db.Pool, body.ChapterID, projectID)
+	if err != nil {
+		writeCheckpointError(w, err)
+		return
+	}
+
+	var taken bool
+	if err := db.Pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM character_arc_checkpoints
+			WHERE character_id = $1 AND chapter_id = $2 AND id <> $3
+		)`, characterID, chapterID, id).Scan(&taken); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		writeCheckpointError(w, errChapterTaken)
+		return
+	}
+
+	if _, err := db.Pool.Exec(ctx, `
+		UPDATE character_arc_checkpoints
+		SET chapter_id = $2, belief = $3, want = $4, need = $5, state = $6, notes = $7
+		WHERE id = $1
+	`, id, chapterID, body.Belief, body.Want, body.Need, body.State, body.Notes); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	a, err := scanCheckpoint(db.Pool.QueryRow(ctx, checkpointSelect+` WHERE a.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a)
+}
+
+func deleteCheckpoint(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM character_arc_checkpoints a
+		USING characters ch, projects p
+		WHERE ch.id = a.character_id AND p.id = ch.project_id
+		  AND a.public_id = $1 AND p.user_id = $2
+	`, pub, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,215 @@
+package arcs
+
+import (
+	"context"
+	"net/http"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+	"backend/routes/storymodels"
+
+	"github.com/google/uuid"
+)
+
+// Début de l'acte final, en % de l'histoire (Plot Point 2 de la structure en
+// trois actes).
+const defaultFinalActStart = 75.0
+
+// finalAct : chapitres de l'acte final. Basis vaut "story_model" quand il
+// commence au premier chapitre rattaché à une phase du modèle placée à
+// Start % ou plus (à défaut d'une telle phase, la dernière du modèle, Start
+// prenant alors sa position) ; Phase est la première de ces phases. Basis vaut
+// "chapters" quand le projet n'a pas de modèle ou aucun chapitre dans ces
+// phases : on prend alors les chapitres situés à partir de Start % de leur
+// nombre.
+type finalAct struct {
+	Basis    string      `json:"basis"`
+	Phase    string      `json:"phase,omitempty"`
+	Start    float64     `json:"start"`
+	Chapters []uuid.UUID `json:"chapters"`
+}
+
+func (fa finalAct) contains() map[uuid.UUID]bool {
+	set := make(map[uuid.UUID]bool, len(fa.Chapters))
+	for _, c := range fa.Chapters {
+		set[c] = true
+	}
+	return set
+}
+
+type chapterPhase struct {
+	PublicID     uuid.UUID
+	StoryPhaseID *int
+}
+
+// loadFinalAct : start est le seuil (en %) de l'acte final, ?final_act= ou
+// defaultFinalActStart.
+func loadFinalAct(ctx context.Context, q db.Querier, projectID int, start float64) (finalAct, error) {
+	var storyModelID *int
+	if err := q.QueryRow(ctx, `
+		SELECT story_model_id FROM projects WHERE id = $1
+	`, projectID).Scan(&storyModelID); err != nil {
+		return finalAct{}, err
+	}
+	var phases []models.StoryPhase
+	if storyModelID != nil {
+		var err error
+		if phases, err = storymodels.PhasesByModel(ctx, q, *storyModelID); err != nil {
+			return finalAct{}, err
+		}
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT public_id, story_phase_id FROM chapters
+		WHERE project_id = $1
+		ORDER BY order_index ASC, id ASC`, projectID)
+	if err != nil {
+		return finalAct{}, err
+	}
+	var chapters []chapterPhase
+	for rows.Next() {
+		var c chapterPhase
+		if err := rows.Scan(&c.PublicID, &c.StoryPhaseID); err != nil {
+			rows.Close()
+			return finalAct{}, err
+		}
+		chapters = append(chapters, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return finalAct{}, err
+	}
+
+	return computeFinalAct(phases, chapters, start), nil
+}
+
+// computeFinalAct : phases dans l'ordre du modèle, chapters dans l'ordre du
+// manuscrit.
+func computeFinalAct(phases []models.StoryPhase, chapters []chapterPhase, start float64) finalAct {
+	fa := finalAct{Basis: "chapters", Start: start, Chapters: []uuid.UUID{}}
+
+	final := make(map[int]bool)
+	for _, ph := range phases {
+		if ph.Position >= start {
+			if len(final) == 0 {
+				fa.Phase = ph.Name
+			}
+			final[ph.ID] = true
+		}
+	}
+	if len(final) == 0 && len(phases) > 0 {
+		last := phases[len(phases)-1]
+		final[last.ID] = true
+		fa.Phase, fa.Start = last.Name, last.Position
+	}
+	if len(chapters) == 0 {
+		return fa
+	}
+
+	first := -1
+	for i, c := range chapters {
+		if c.StoryPhaseID != nil && final[*c.StoryPhaseID] {
+			first = i
+			fa.Basis = "story_model"
+			break
+		}
+	}
+	if first < 0 {
+		// Premier chapitre dont le début est à Start % ou plus
+		first = len(chapters) - 1
+		for i := range chapters {
+			if float64(i)*100 >= fa.Start*float64(len(chapters)) {
+				first = i
+				break
+			}
+		}
+	}
+
+	for _, c := range chapters[first:] {
+		fa.Chapters = append(fa.Chapters, c.PublicID)
+	}
+	return fa
+}
+
+type reportEntry struct {
+	CharacterID uuid.UUID `json:"character_id"`
+	Name        string    `json:"name"`
+	Checkpoints int       `json:"checkpoints"`
+	Warnings    []string  `json:"warnings"`
+}
+
+type report struct {
+	FinalAct   finalAct      `json:"final_act"`
+	Characters []reportEntry `json:"characters"` // personnages avec un arc et au moins un avertissement
+}
+
+// getReport : personnages dont l'arc n'a aucune étape dans l'acte final
+// (?final_act=<pourcentage>). Les personnages sans étape sont ignorés.
+func getReport(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+	start, ok := finalActParam(r)
+	if !ok {
+		http.Error(w, "invalid final_act", http.StatusBadRequest)
+		return
+	}
+
+	fa, err := loadFinalAct(ctx, db.Pool, projectID, start)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	inFinal := fa.contains()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT ch.public_id, ch.name, c.public_id
+		FROM character_arc_checkpoints a
+		JOIN characters ch ON ch.id = a.character_id
+		JOIN chapters c ON c.id = a.chapter_id
+		WHERE c.project_id = $1
+		ORDER BY ch.name ASC, ch.id ASC`, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var entries []reportEntry
+	var covered []bool
+	for rows.Next() {
+		var characterID, chapterID uuid.UUID
+		var name string
+		if err := rows.Scan(&characterID, &name, &chapterID); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(entries) == 0 || entries[len(entries)-1].CharacterID != characterID {
+			entries = append(entries, reportEntry{CharacterID: characterID, Name: name})
+			covered = append(covered, false)
+		}
+		entries[len(entries)-1].Checkpoints++
+		if inFinal[chapterID] {
+			covered[len(covered)-1] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rep := report{FinalAct: fa, Characters: []reportEntry{}}
+	for i, e := range entries {
+		if covered[i] {
+			continue
+		}
+		e.Warnings = []string{warnNoFinalActCheckpoint}
+		rep.Characters = append(rep.Characters, e)
+	}
+
+	writeJSON(w, http.StatusOK, rep)
+}
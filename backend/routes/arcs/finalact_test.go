@@ -0,0 +1,80 @@
+package arcs
+
+import (
+	"reflect"
+	"testing"
+
+	"backend/models"
+
+	"github.com/google/uuid"
+)
+
+// Phases du modèle « Three-Act Structure » (migration 005)
+var threeAct = []models.StoryPhase{
+	{ID: 1, Name: "Setup", Position: 0},
+	{ID: 2, Name: "Inciting Incident", Position: 12},
+	{ID: 3, Name: "Plot Point 1", Position: 25},
+	{ID: 4, Name: "Midpoint", Position: 50},
+	{ID: 5, Name: "Plot Point 2", Position: 75},
+	{ID: 6, Name: "Climax", Position: 90},
+	{ID: 7, Name: "Resolution", Position: 100},
+}
+
+// chapterIDs : uuid déterministe par rang de chapitre
+func chapterIDs(idx ...int) []uuid.UUID {
+	ids := []uuid.UUID{}
+	for _, i := range idx {
+		ids = append(ids, uuid.UUID{byte(i + 1)})
+	}
+	return ids
+}
+
+// tagged : un chapitre par entrée, 0 = sans phase
+func tagged(phases ...int) []chapterPhase {
+	chapters := make([]chapterPhase, len(phases))
+	for i, ph := range phases {
+		chapters[i].PublicID = uuid.UUID{byte(i + 1)}
+		if ph != 0 {
+			ph := ph
+			chapters[i].StoryPhaseID = &ph
+		}
+	}
+	return chapters
+}
+
+func TestComputeFinalAct(t *testing.T) {
+	tests := []struct {
+		name     string
+		phases   []models.StoryPhase
+		chapters []chapterPhase
+		start    float64
+		want     finalAct
+	}{
+		{"à partir de Plot Point 2", threeAct, tagged(1, 2, 3, 4, 5, 6, 7), 75,
+			finalAct{"story_model", "Plot Point 2", 75, chapterIDs(4, 5, 6)}},
+		{"Plot Point 2 sans chapitre, Climax ouvre l'acte", threeAct, tagged(1, 3, 4, 4, 6, 7), 75,
+			finalAct{"story_model", "Plot Point 2", 75, chapterIDs(4, 5)}},
+		{"chapitre final avant un chapitre non rattaché", threeAct, tagged(1, 3, 6, 0, 4), 75,
+			finalAct{"story_model", "Plot Point 2", 75, chapterIDs(2, 3, 4)}},
+		{"seuil demandé", threeAct, tagged(1, 3, 4, 5, 6, 7), 90,
+			finalAct{"story_model", "Climax", 90, chapterIDs(4, 5)}},
+		{"aucun chapitre rattaché : au prorata", threeAct, tagged(0, 0, 0, 0, 0, 0, 0, 0), 75,
+			finalAct{"chapters", "Plot Point 2", 75, chapterIDs(6, 7)}},
+		{"aucune phase au seuil : la dernière", threeAct[:4], tagged(1, 3, 4, 4), 75,
+			finalAct{"story_model", "Midpoint", 50, chapterIDs(2, 3)}},
+		{"dernière phase sans chapitre : sa position", threeAct[:4], tagged(1, 2, 3, 0), 75,
+			finalAct{"chapters", "Midpoint", 50, chapterIDs(2, 3)}},
+		{"sans modèle", nil, tagged(0, 0, 0, 0), 50,
+			finalAct{"chapters", "", 50, chapterIDs(2, 3)}},
+		{"sans chapitre", threeAct, nil, 75,
+			finalAct{"chapters", "Plot Point 2", 75, []uuid.UUID{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := computeFinalAct(tt.phases, tt.chapters, tt.start)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("computeFinalAct() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"backend/db"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// ErrUnauthorized : pas de cookie "auth" ou session expirée.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// SessionUserID retrouve l'id interne de l'utilisateur à partir du cookie
+// de session opaque (même logique que /auth/me).
+func SessionUserID(ctx context.Context, r *http.Request) (int64, error) {
+	c, err := r.Cookie("auth")
+	if err != nil || c.Value == "" {
+		return 0, ErrUnauthorized
+	}
+
+	var userID int64
+	if err := db.Pool.QueryRow(ctx, `
+		SELECT u.id
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = $1 AND s.expires_at > now()
+		LIMIT 1
+	`, sha256b64(c.Value)).Scan(&userID); err != nil {
+		return 0, ErrUnauthorized
+	}
+	return userID, nil
+}
+
+// OwnedProjectID résout le public_id d'un projet en id interne, seulement si
+// le projet appartient à userID. Renvoie pgx.ErrNoRows sinon.
+func OwnedProjectID(ctx context.Context, projectPublicID uuid.UUID, userID int64) (int, error) {
+	var id int
+	err := db.Pool.QueryRow(ctx, `
+		SELECT id FROM projects WHERE public_id = $1 AND user_id = $2
+	`, projectPublicID, userID).Scan(&id)
+	return id, err
+}
+
+// RequireProject : session + projet {projectUUID} de l'URL appartenant à
+// l'utilisateur. Écrit la réponse d'erreur et renvoie ok=false si refusé.
+func RequireProject(ctx context.Context, w http.ResponseWriter, r *http.Request) (projectID int, userID int64, ok bool) {
+	userID, err := SessionUserID(ctx, r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+	pub, err := uuid.Parse(chi.URLParam(r, "projectUUID"))
+	if err != nil {
+		http.Error(w, "invalid uuid", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	projectID, err = OwnedProjectID(ctx, pub, userID)
+	if err != nil {
+		http.Error(w, "project not found", http.StatusNotFound)
+		return 0, 0, false
+	}
+	return projectID, userID, true
+}
+
+// RequireEntity : session + {uuid} de l'URL (l'appartenance est vérifiée
+// ensuite dans la requête SQL via projects.user_id).
+func RequireEntity(ctx context.Context, w http.ResponseWriter, r *http.Request) (userID int64, pub uuid.UUID, ok bool) {
+	userID, err := SessionUserID(ctx, r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return 0, uuid.Nil, false
+	}
+	pub, err = uuid.Parse(chi.URLParam(r, "uuid"))
+	if err != nil {
+		http.Error(w, "invalid uuid", http.StatusBadRequest)
+		return 0, uuid.Nil, false
+	}
+	return userID, pub, true
+}
@@ -0,0 +1,414 @@
+package chapters
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/project/{projectUUID}", getChaptersByProject)
+	r.Post("/project/{projectUUID}", createChapter)
+	r.Get("/{uuid}", getChapter)
+	r.Put("/{uuid}", updateChapter)
+	r.Delete("/{uuid}", deleteChapter)
+	r.Post("/{uuid}/move", moveChapter)
+
+	return r
+}
+
+type chapterInput struct {
+	Title        string `json:"title"`
+	Synopsis     string `json:"synopsis"`
+	StoryPhaseID *int   `json:"story_phase_id,omitempty"`
+}
+
+func (in *chapterInput) validate() error {
+	in.Title = strings.TrimSpace(in.Title)
+	if in.Title == "" {
+		return errors.New("title requis")
+	}
+	return nil
+}
+
+const chapterColumns = `c.id, c.public_id, c.project_id, c.title, c.synopsis, c.story_phase_id, c.order_index`
+
+func scanChapter(row pgx.Row) (models.Chapter, error) {
+	var c models.Chapter
+	err := row.Scan(&c.ID, &c.PublicID, &c.ProjectID, &c.Title,
+		&c.Synopsis, &c.StoryPhaseID, &c.OrderIndex)
+	return c, err
+}
+
+func listChapters(ctx context.Context, q db.Querier, projectID int) ([]models.Chapter, error) {
+	rows, err := q.Query(ctx, `
+		SELECT `+chapterColumns+`
+		FROM chapters c
+		WHERE c.project_id = $1
+		ORDER BY c.order_index ASC, c.id ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Chapter{}
+	for rows.Next() {
+		c, err := scanChapter(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+func chapterIDs(list []models.Chapter) []int {
+	ids := make([]int, len(list))
+	for i, c := range list {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
+// checkPhase vérifie que story_phase_id est une phase du modèle du projet.
+func checkPhase(ctx context.Context, q db.Querier, phaseID *int, projectID int) error {
+	if phaseID == nil {
+		return nil
+	}
+	var ok bool
+	if err := q.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM story_phases ph
+			JOIN projects p ON p.story_model_id = ph.story_model_id
+			WHERE ph.id = $1 AND p.id = $2
+		)
+	`, *phaseID, projectID).Scan(&ok); err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidPhase
+	}
+	return nil
+}
+
+var errInvalidPhase = errors.New("invalid story_phase_id")
+
+// ownedChapter retrouve (id, project_id) d'un chapitre du propriétaire.
+func ownedChapter(ctx context.Context, tx db.Querier, pub uuid.UUID, userID int64) (id, projectID int, err error) {
+	err = tx.QueryRow(ctx, `
+		SELECT c.id, c.project_id
+		FROM chapters c
+		JOIN projects p ON p.id = c.project_id
+		WHERE c.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&id, &projectID)
+	return id, projectID, err
+}
+
+func getChaptersByProject(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	list, err := listChapters(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createChapter(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body chapterInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Verrou projet : le MAX(order_index)+1 reste unique même en concurrence
+	if err := db.LockProject(ctx, tx, projectID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := checkPhase(ctx, tx, body.StoryPhaseID, projectID); err != nil {
+		if errors.Is(err, errInvalidPhase) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c, err := scanChapter(tx.QueryRow(ctx, `
+		INSERT INTO chapters AS c (public_id, project_id, title, synopsis, story_phase_id, order_index)
+		VALUES (gen_random_uuid(), $1, $2, $3, $4,
+		        (SELECT COALESCE(MAX(order_index), 0) + 1 FROM chapters WHERE project_id = $1))
+		RETURNING `+chapterColumns,
+		projectID, body.Title, body.Synopsis, body.StoryPhaseID))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, c)
+}
+
+func getChapter(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	c, err := scanChapter(db.Pool.QueryRow(ctx, `
+		SELECT `+chapterColumns+`
+		FROM chapters c
+		JOIN projects p ON p.id = c.project_id
+		WHERE c.public_id = $1 AND p.user_id = $2`, pub, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, c)
+}
+
+func updateChapter(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body chapterInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	id, projectID, err := ownedChapter(ctx, tx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := checkPhase(ctx, tx, body.StoryPhaseID, projectID); err != nil {
+		if errors.Is(err, errInvalidPhase) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// order_index n'est modifiable que via /move
+	c, err := scanChapter(tx.QueryRow(ctx, `
+		UPDATE chapters AS c
+		SET title = $2, synopsis = $3, story_phase_id = $4
+		WHERE c.id = $1
+		RETURNING `+chapterColumns,
+		id, body.Title, body.Synopsis, body.StoryPhaseID))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, c)
+}
+
+func deleteChapter(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	id, projectID, err := ownedChapter(ctx, tx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := db.LockProject(ctx, tx, projectID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Les scènes du chapitre partent à la corbeille avec lui (même deleted_at :
+	// restaurées ensemble) ; now() est fixe pour toute la transaction
+	if _, err := tx.Exec(ctx, `UPDATE scenes SET deleted_at = now() WHERE chapter_id = $1`, id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(ctx, `UPDATE chapters SET deleted_at = now(), order_index = -id WHERE id = $1`, id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Referme le trou laissé dans order_index
+	list, err := listChapters(ctx, tx, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := db.RewriteOrder(ctx, tx, "chapters", chapterIDs(list)); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// moveChapter place le chapitre à la position N (1-based) et réécrit
+// order_index pour tout le projet dans une seule transaction.
+func moveChapter(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Position int `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if body.Position < 1 {
+		http.Error(w, "position must be >= 1", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	id, projectID, err := ownedChapter(ctx, tx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Le verrou garantit que l'ordre lu ci-dessous est celui qu'on réécrit
+	if err := db.LockProject(ctx, tx, projectID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list, err := listChapters(ctx, tx, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ids := db.MoveID(chapterIDs(list), id, body.Position)
+	if err := db.RewriteOrder(ctx, tx, "chapters", ids); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list, err = listChapters(ctx, tx, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
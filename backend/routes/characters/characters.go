@@ -1,9 +1,361 @@
 package characters
 
-import "github.com/go-chi/chi/v5"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+	"backend/routes/customfields"
+	"backend/routes/factions"
+	"backend/routes/scenes"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
 
 func Routes() *chi.Mux {
 	r := chi.NewRouter()
-	// routes à venir...
+
+	r.Get("/project/{projectUUID}", getCharactersByProject)
+	r.Post("/project/{projectUUID}", createCharacter)
+	r.Get("/{uuid}", getCharacter)
+	r.Put("/{uuid}", updateCharacter)
+	r.Delete("/{uuid}", deleteCharacter)
+	r.Get("/{uuid}/factions", getCharacterFactions)
+	r.Get("/{uuid}/appearances", getCharacterAppearances)
+
 	return r
 }
+
+// Valeurs acceptées pour role / arc_type (vide = non renseigné)
+var validRoles = map[string]bool{
+	"":              true,
+	"protagonist":   true,
+	"antagonist":    true,
+	"deuteragonist": true,
+	"mentor":        true,
+	"ally":          true,
+	"love_interest": true,
+	"foil":          true,
+	"secondary":     true,
+	"minor":         true,
+}
+
+var validArcTypes = map[string]bool{
+	"":               true,
+	"positive":       true,
+	"negative":       true,
+	"flat":           true,
+	"corruption":     true,
+	"disillusion":    true,
+	"fall":           true,
+	"redemption":     true,
+	"transformation": true,
+}
+
+// ValidRole / ValidArcType : valeurs acceptées, aussi pour les surcharges
+// d'un personnage partagé (séries).
+func ValidRole(role string) bool       { return validRoles[role] }
+func ValidArcType(arcType string) bool { return validArcTypes[arcType] }
+
+type characterInput struct {
+	Name             string         `json:"name"`
+	Role             string         `json:"role"`
+	Bio              string         `json:"bio"`
+	Background       string         `json:"background"`
+	Personality      string         `json:"personality"`
+	Objective        string         `json:"objective"`
+	InternalConflict string         `json:"internal_conflict"`
+	ArcType          string         `json:"arc_type"`
+	Notes            string         `json:"notes"`
+	AvatarURL        string         `json:"avatar_url"`
+	CustomFields     map[string]any `json:"custom_fields"`
+}
+
+func (in *characterInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Role = strings.ToLower(strings.TrimSpace(in.Role))
+	in.ArcType = strings.ToLower(strings.TrimSpace(in.ArcType))
+
+	if in.Name == "" {
+		return errors.New("name requis")
+	}
+	if !validRoles[in.Role] {
+		return errors.New("invalid role")
+	}
+	if !validArcTypes[in.ArcType] {
+		return errors.New("invalid arc_type")
+	}
+	return nil
+}
+
+const characterColumns = `c.id, c.public_id, c.project_id, c.name, c.role, c.bio, c.background,
+	c.personality, c.objective, c.internal_conflict, c.arc_type, c.notes, c.avatar_url, c.custom_fields`
+
+func scanCharacter(row pgx.Row) (models.Character, error) {
+	var c models.Character
+	err := row.Scan(&c.ID, &c.PublicID, &c.ProjectID, &c.Name, &c.Role, &c.Bio,
+		&c.Background, &c.Personality, &c.Objective, &c.InternalConflict,
+		&c.ArcType, &c.Notes, &c.AvatarURL, &c.CustomFields)
+	return c, err
+}
+
+func getCharactersByProject(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	// Filtres ?cf.<key>=<valeur> sur les champs personnalisés
+	filter, args, err := customfields.Filter(ctx, db.Pool, projectID, "character", r.URL.Query(), "c", 2)
+	if err != nil {
+		customfields.WriteError(w, err)
+		return
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+characterColumns+`
+		FROM characters c
+		WHERE c.project_id = $1`+filter+`
+		ORDER BY c.name ASC`, append([]any{projectID}, args...)...)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := []models.Character{}
+	for rows.Next() {
+		c, err := scanCharacter(rows)
+		if err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		list = append(list, c)
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createCharacter(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body characterInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cf, err := customfields.Validate(ctx, db.Pool, projectID, "character", body.CustomFields)
+	if err != nil {
+		customfields.WriteError(w, err)
+		return
+	}
+
+	c, err := scanCharacter(db.Pool.QueryRow(ctx, `
+		INSERT INTO characters AS c (public_id, project_id, name, role, bio, background, personality,
+		                             objective, internal_conflict, arc_type, notes, avatar_url, custom_fields)
+		VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING `+characterColumns,
+		projectID, body.Name, body.Role, body.Bio, body.Background, body.Personality,
+		body.Objective, body.InternalConflict, body.ArcType, body.Notes, body.AvatarURL, cf))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, c)
+}
+
+func getCharacter(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	c, err := scanCharacter(db.Pool.QueryRow(ctx, `
+		SELECT `+characterColumns+`
+		FROM characters c
+		JOIN projects p ON p.id = c.project_id
+		WHERE c.public_id = $1 AND p.user_id = $2`, pub, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, c)
+}
+
+func updateCharacter(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body characterInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Scoping: seulement les personnages d'un projet du propriétaire
+	id, projectID, err := ownedCharacter(ctx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cf, err := customfields.ValidateUpdate(ctx, db.Pool, projectID, "character", body.CustomFields)
+	if err != nil {
+		customfields.WriteError(w, err)
+		return
+	}
+
+	c, err := scanCharacter(db.Pool.QueryRow(ctx, `
+		UPDATE characters AS c
+		SET name = $2, role = $3, bio = $4, background = $5, personality = $6,
+		    objective = $7, internal_conflict = $8, arc_type = $9, notes = $10, avatar_url = $11,
+		    custom_fields = COALESCE($12, c.custom_fields)
+		WHERE c.id = $1
+		RETURNING `+characterColumns,
+		id, body.Name, body.Role, body.Bio, body.Background, body.Personality,
+		body.Objective, body.InternalConflict, body.ArcType, body.Notes, body.AvatarURL, cf))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, c)
+}
+
+func deleteCharacter(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	// Mise à la corbeille : scènes, relations et factions gardent leurs liens,
+	// masqués tant que le personnage n'est pas restauré (routes/trash)
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE characters c SET deleted_at = now()
+		FROM projects p
+		WHERE p.id = c.project_id AND c.public_id = $1 AND p.user_id = $2
+	`, pub, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ownedCharacter : (id, project_id) d'un personnage du propriétaire.
+func ownedCharacter(ctx context.Context, pub uuid.UUID, userID int64) (id, projectID int, err error) {
+	err = db.Pool.QueryRow(ctx, `
+		SELECT c.id, c.project_id
+		FROM characters c
+		JOIN projects p ON p.id = c.project_id
+		WHERE c.public_id = $1 AND p.user_id = $2`, pub, userID).Scan(&id, &projectID)
+	return id, projectID, err
+}
+
+// getCharacterFactions : appartenances du personnage (rang, titre, chapitres).
+func getCharacterFactions(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	id, _, err := ownedCharacter(ctx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list, err := factions.MembersByCharacter(ctx, db.Pool, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// getCharacterAppearances : scènes où le personnage apparaît, dans l'ordre de
+// lecture ; la dernière entrée répond à "quand l'a-t-on vu pour la dernière fois ?".
+func getCharacterAppearances(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	id, _, err := ownedCharacter(ctx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list, err := scenes.AppearancesByCharacter(ctx, db.Pool, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
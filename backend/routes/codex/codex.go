@@ -0,0 +1,279 @@
+package codex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/project/{projectUUID}", getTermsByProject)
+	r.Post("/project/{projectUUID}", createTerm)
+	r.Get("/{uuid}", getTerm)
+	r.Put("/{uuid}", updateTerm)
+	r.Delete("/{uuid}", deleteTerm)
+
+	// Mentions dans le contenu des scènes (voir mentions.go)
+	r.Get("/scenes/{uuid}/mentions", getSceneMentions)
+	r.Get("/mentions/{entityType}/{uuid}", getEntityScenes) // scènes qui mentionnent X
+
+	return r
+}
+
+type termInput struct {
+	Term       string   `json:"term"`
+	Definition string   `json:"definition"`
+	Category   string   `json:"category"`
+	Aliases    []string `json:"aliases"`
+}
+
+// validate nettoie les alias : vides, doublons et alias égaux au terme
+// (casse ignorée) sont retirés.
+func (in *termInput) validate() error {
+	in.Term = strings.TrimSpace(in.Term)
+	in.Category = strings.TrimSpace(in.Category)
+	if in.Term == "" {
+		return errors.New("term requis")
+	}
+	seen := map[string]bool{strings.ToLower(in.Term): true}
+	aliases := []string{}
+	for _, a := range in.Aliases {
+		a = strings.TrimSpace(a)
+		if a == "" || seen[strings.ToLower(a)] {
+			continue
+		}
+		seen[strings.ToLower(a)] = true
+		aliases = append(aliases, a)
+	}
+	in.Aliases = aliases
+	return nil
+}
+
+var errTermTaken = errors.New("a codex term with this name already exists")
+
+const termSelect = `
+	SELECT t.id, t.public_id, t.project_id, t.term, t.definition, t.category, t.aliases
+	FROM codex_terms t`
+
+func scanTerm(row pgx.Row) (models.CodexTerm, error) {
+	var t models.CodexTerm
+	err := row.Scan(&t.ID, &t.PublicID, &t.ProjectID, &t.Term, &t.Definition, &t.Category, &t.Aliases)
+	return t, err
+}
+
+// ByProject : termes du codex du projet (payload /full).
+func ByProject(ctx context.Context, q db.Querier, projectID int) ([]models.CodexTerm, error) {
+	rows, err := q.Query(ctx, termSelect+`
+		WHERE t.project_id = $1
+		ORDER BY lower(t.term) ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.CodexTerm{}
+	for rows.Next() {
+		t, err := scanTerm(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// ownedTerm retrouve (id, project_id) d'un terme du propriétaire.
+func ownedTerm(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (id, projectID int, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT t.id, t.project_id
+		FROM codex_terms t
+		JOIN projects p ON p.id = t.project_id
+		WHERE t.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&id, &projectID)
+	return id, projectID, err
+}
+
+func termTaken(ctx context.Context, q db.Querier, projectID int, term string, selfID int) (bool, error) {
+	var taken bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM codex_terms WHERE project_id = $1 AND lower(term) = lower($2) AND id <> $3
+		)`, projectID, term, selfID).Scan(&taken)
+	return taken, err
+}
+
+func getTermsByProject(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	list, err := ByProject(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createTerm(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body termInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	taken, err := termTaken(ctx, db.Pool, projectID, body.Term, 0)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		http.Error(w, errTermTaken.Error(), http.StatusConflict)
+		return
+	}
+
+	t, err := scanTerm(db.Pool.QueryRow(ctx, `
+		INSERT INTO codex_terms (project_id, term, definition, category, aliases)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, public_id, project_id, term, definition, category, aliases`,
+		projectID, body.Term, body.Definition, body.Category, body.Aliases))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, t)
+}
+
+func getTerm(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	t, err := scanTerm(db.Pool.QueryRow(ctx, termSelect+`
+		JOIN projects p ON p.id = t.project_id
+		WHERE t.public_id = $1 AND p.user_id = $2`, pub, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, t)
+}
+
+func updateTerm(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body termInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, projectID, err := ownedTerm(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	taken, err := termTaken(ctx, db.Pool, projectID, body.Term, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		http.Error(w, errTermTaken.Error(), http.StatusConflict)
+		return
+	}
+
+	t, err := scanTerm(db.Pool.QueryRow(ctx, `
+		UPDATE codex_terms
+		SET term = $2, definition = $3, category = $4, aliases = $5
+		WHERE id = $1
+		RETURNING id, public_id, project_id, term, definition, category, aliases`,
+		id, body.Term, body.Definition, body.Category, body.Aliases))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, t)
+}
+
+func deleteTerm(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM codex_terms t
+		USING projects p
+		WHERE p.id = t.project_id AND t.public_id = $1 AND p.user_id = $2
+	`, pub, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
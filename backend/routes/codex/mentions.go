@@ -0,0 +1,231 @@
+package codex
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/routes/auth"
+	"backend/textutil"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Entités reconnues dans le texte : personnages, lieux et factions par leur
+// nom, termes du codex par leur terme et leurs alias.
+var mentionTables = map[string]string{
+	"character": "characters",
+	"location":  "locations",
+	"faction":   "factions",
+	"term":      "codex_terms",
+}
+
+type dictEntry struct {
+	EntityType string
+	EntityID   uuid.UUID
+	Name       string
+}
+
+// dictionary : entités du projet et les textes qui les désignent
+// (Pattern.Key = indice dans entries).
+type dictionary struct {
+	entries  []dictEntry
+	patterns []textutil.Pattern
+}
+
+// loadDictionary : entités du projet et du monde de sa série. Quand deux
+// entités portent le même nom, la première l'emporte (personnages, puis
+// lieux, factions et termes du codex).
+func loadDictionary(ctx context.Context, q db.Querier, projectID int) (dictionary, error) {
+	var d dictionary
+	rows, err := q.Query(ctx, `
+		SELECT 'character', public_id, name, '{}'::text[], 1 AS rank, id FROM characters WHERE project_id = ANY (project_scope($1))
+		UNION ALL
+		SELECT 'location', public_id, name, '{}'::text[], 2, id FROM locations WHERE project_id = ANY (project_scope($1))
+		UNION ALL
+		SELECT 'faction', public_id, name, '{}'::text[], 3, id FROM factions WHERE project_id = ANY (project_scope($1))
+		UNION ALL
+		SELECT 'term', public_id, term, aliases, 4, id FROM codex_terms WHERE project_id = $1
+		ORDER BY rank ASC, id ASC`, projectID)
+	if err != nil {
+		return d, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e dictEntry
+		var aliases []string
+		var rank, id int
+		if err := rows.Scan(&e.EntityType, &e.EntityID, &e.Name, &aliases, &rank, &id); err != nil {
+			return d, err
+		}
+		key := len(d.entries)
+		d.entries = append(d.entries, e)
+		d.patterns = append(d.patterns, textutil.Pattern{Key: key, Text: e.Name})
+		for _, a := range aliases {
+			d.patterns = append(d.patterns, textutil.Pattern{Key: key, Text: a})
+		}
+	}
+	return d, rows.Err()
+}
+
+// mention : occurrence d'une entité dans le contenu d'une scène. Start et
+// End sont en unités UTF-16 dans Scene.Content (comme les positions de
+// l'éditeur), End exclu.
+type mention struct {
+	EntityType string    `json:"entity_type"`
+	EntityID   uuid.UUID `json:"entity_id"`
+	Name       string    `json:"name"` // nom de l'entité
+	Text       string    `json:"text"` // texte tel qu'écrit dans la scène
+	Start      int       `json:"start"`
+	End        int       `json:"end"`
+}
+
+func (d dictionary) scan(content string) []mention {
+	matches := textutil.FindMentions(content, d.patterns)
+	list := make([]mention, 0, len(matches))
+	for _, m := range matches {
+		e := d.entries[m.Key]
+		list = append(list, mention{
+			EntityType: e.EntityType,
+			EntityID:   e.EntityID,
+			Name:       e.Name,
+			Text:       m.Text,
+			Start:      m.Start,
+			End:        m.End,
+		})
+	}
+	return list
+}
+
+// getSceneMentions : entités mentionnées dans le contenu de la scène, dans
+// l'ordre du texte.
+func getSceneMentions(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var projectID int
+	var content string
+	err := db.Pool.QueryRow(ctx, `
+		SELECT c.project_id, COALESCE(s.content, '')
+		FROM scenes s
+		JOIN chapters c ON c.id = s.chapter_id
+		JOIN projects p ON p.id = c.project_id
+		WHERE s.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&projectID, &content)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	dict, err := loadDictionary(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dict.scan(content))
+}
+
+type sceneMentions struct {
+	SceneID      uuid.UUID `json:"scene_id"`
+	SceneTitle   string    `json:"scene_title"`
+	ChapterID    uuid.UUID `json:"chapter_id"`
+	ChapterTitle string    `json:"chapter_title"`
+	ChapterOrder int       `json:"chapter_order"`
+	SceneOrder   int       `json:"scene_order"`
+	Count        int       `json:"count"`
+	Mentions     []mention `json:"mentions"`
+}
+
+// getEntityScenes : scènes qui mentionnent l'entité, dans l'ordre de
+// lecture, avec les occurrences. Pour une entité partagée, les scènes de
+// tous les livres de la série.
+func getEntityScenes(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+	entityType := strings.ToLower(chi.URLParam(r, "entityType"))
+	table, ok := mentionTables[entityType]
+	if !ok {
+		http.Error(w, "invalid entity_type", http.StatusBadRequest)
+		return
+	}
+
+	var projectID int
+	err := db.Pool.QueryRow(ctx, `
+		SELECT e.project_id
+		FROM `+table+` e
+		JOIN projects p ON p.id = e.project_id
+		WHERE e.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&projectID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	dict, err := loadDictionary(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT s.public_id, s.title, c.public_id, c.title, c.order_index, s.order_index, COALESCE(s.content, '')
+		FROM scenes s
+		JOIN chapters c ON c.id = s.chapter_id
+		WHERE $1 = ANY (project_scope(c.project_id))
+		ORDER BY c.project_id ASC, c.order_index ASC, s.order_index ASC`, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := []sceneMentions{}
+	for rows.Next() {
+		var sm sceneMentions
+		var content string
+		if err := rows.Scan(&sm.SceneID, &sm.SceneTitle, &sm.ChapterID, &sm.ChapterTitle,
+			&sm.ChapterOrder, &sm.SceneOrder, &content); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sm.Mentions = []mention{}
+		for _, m := range dict.scan(content) {
+			if m.EntityType == entityType && m.EntityID == pub {
+				sm.Mentions = append(sm.Mentions, m)
+			}
+		}
+		if len(sm.Mentions) == 0 {
+			continue
+		}
+		sm.Count = len(sm.Mentions)
+		list = append(list, sm)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
@@ -0,0 +1,445 @@
+package customfields
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/project/{projectUUID}", getDefinitionsByProject) // ?entity_type=
+	r.Post("/project/{projectUUID}", createDefinition)
+	r.Get("/{uuid}", getDefinition)
+	r.Put("/{uuid}", updateDefinition)
+	r.Delete("/{uuid}", deleteDefinition)
+
+	return r
+}
+
+// Types d'entités qui portent des champs personnalisés -> tables. Les
+// valeurs vivent sur l'entité (corbeille comprise, d'où la table _all) et
+// dans les surcharges par livre des entités partagées d'une série.
+type entityTable struct {
+	table     string
+	overrides string
+	fk        string
+}
+
+var entityTables = map[string]entityTable{
+	"character": {"characters_all", "character_overrides", "character_id"},
+	"location":  {"locations_all", "location_overrides", "location_id"},
+	"faction":   {"factions_all", "faction_overrides", "faction_id"},
+}
+
+// values : custom_fields de toutes les entités du projet $1 et de leurs
+// surcharges, une ligne jsonb par source.
+func (t entityTable) values() string {
+	return `
+		SELECT e.custom_fields AS cf FROM ` + t.table + ` e WHERE e.project_id = $1
+		UNION ALL
+		SELECT o.fields->'custom_fields' FROM ` + t.overrides + ` o
+		JOIN ` + t.table + ` e ON e.id = o.` + t.fk + `
+		WHERE e.project_id = $1`
+}
+
+var validFieldTypes = map[string]bool{
+	"text":      true,
+	"number":    true,
+	"date":      true,
+	"enum":      true,
+	"reference": true,
+}
+
+// Entités référençables par un champ "reference"
+var validRefTypes = map[string]bool{
+	"character": true,
+	"location":  true,
+	"faction":   true,
+	"chapter":   true,
+	"scene":     true,
+}
+
+// La clé sert de nom de propriété JSON et de paramètre ?cf.<key>=
+var keyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+type definitionInput struct {
+	EntityType string   `json:"entity_type"`
+	Key        string   `json:"key"`
+	Label      string   `json:"label"`
+	FieldType  string   `json:"field_type"`
+	Options    []string `json:"options"`
+	RefType    string   `json:"ref_type"`
+	Required   bool     `json:"required"`
+	OrderIndex int      `json:"order_index"`
+}
+
+func (in *definitionInput) validate() error {
+	in.EntityType = strings.ToLower(strings.TrimSpace(in.EntityType))
+	in.Key = strings.TrimSpace(in.Key)
+	in.Label = strings.TrimSpace(in.Label)
+	in.FieldType = strings.ToLower(strings.TrimSpace(in.FieldType))
+	in.RefType = strings.ToLower(strings.TrimSpace(in.RefType))
+
+	if _, ok := entityTables[in.EntityType]; !ok {
+		return errors.New("invalid entity_type")
+	}
+	if !keyPattern.MatchString(in.Key) {
+		return errors.New("key must match [a-z][a-z0-9_]*")
+	}
+	if in.Label == "" {
+		in.Label = in.Key
+	}
+	if !validFieldTypes[in.FieldType] {
+		return errors.New("invalid field_type")
+	}
+
+	options := []string{}
+	if in.FieldType == "enum" {
+		seen := map[string]bool{}
+		for _, o := range in.Options {
+			o = strings.TrimSpace(o)
+			if o == "" || seen[o] {
+				continue
+			}
+			seen[o] = true
+			options = append(options, o)
+		}
+		if len(options) == 0 {
+			return errors.New("enum fields need at least one option")
+		}
+	}
+	in.Options = options
+
+	if in.FieldType == "reference" {
+		if !validRefTypes[in.RefType] {
+			return errors.New("invalid ref_type")
+		}
+	} else {
+		in.RefType = ""
+	}
+	return nil
+}
+
+var errFieldInUse = errors.New("field_type, ref_type or options conflict with existing values")
+
+const definitionColumns = `d.id, d.public_id, d.project_id, d.entity_type, d.key, d.label,
+	d.field_type, d.options, d.ref_type, d.required, d.order_index`
+
+func scanDefinition(row pgx.Row) (models.CustomFieldDefinition, error) {
+	var d models.CustomFieldDefinition
+	err := row.Scan(&d.ID, &d.PublicID, &d.ProjectID, &d.EntityType, &d.Key, &d.Label,
+		&d.FieldType, &d.Options, &d.RefType, &d.Required, &d.OrderIndex)
+	return d, err
+}
+
+func listDefinitions(ctx context.Context, q db.Querier, where string, args ...any) ([]models.CustomFieldDefinition, error) {
+	rows, err := q.Query(ctx, `
+		SELECT `+definitionColumns+`
+		FROM custom_field_definitions d
+		WHERE `+where+`
+		ORDER BY d.entity_type ASC, d.order_index ASC, d.key ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.CustomFieldDefinition{}
+	for rows.Next() {
+		d, err := scanDefinition(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
+
+// ByProject : toutes les définitions du projet (payload /full).
+func ByProject(ctx context.Context, q db.Querier, projectID int) ([]models.CustomFieldDefinition, error) {
+	return listDefinitions(ctx, q, `d.project_id = $1`, projectID)
+}
+
+// Definitions : définitions d'un type d'entité du projet.
+func Definitions(ctx context.Context, q db.Querier, projectID int, entityType string) ([]models.CustomFieldDefinition, error) {
+	return listDefinitions(ctx, q, `d.project_id = $1 AND d.entity_type = $2`, projectID, entityType)
+}
+
+// ownedDefinition : définition d'un projet du propriétaire.
+func ownedDefinition(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (models.CustomFieldDefinition, error) {
+	return scanDefinition(q.QueryRow(ctx, `
+		SELECT `+definitionColumns+`
+		FROM custom_field_definitions d
+		JOIN projects p ON p.id = d.project_id
+		WHERE d.public_id = $1 AND p.user_id = $2`, pub, userID))
+}
+
+func getDefinitionsByProject(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var list []models.CustomFieldDefinition
+	var err error
+	if et := r.URL.Query().Get("entity_type"); et != "" {
+		if _, ok := entityTables[et]; !ok {
+			http.Error(w, "invalid entity_type", http.StatusBadRequest)
+			return
+		}
+		list, err = Definitions(ctx, db.Pool, projectID, et)
+	} else {
+		list, err = ByProject(ctx, db.Pool, projectID)
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createDefinition(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body definitionInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	d, err := scanDefinition(db.Pool.QueryRow(ctx, `
+		INSERT INTO custom_field_definitions AS d
+			(project_id, entity_type, key, label, field_type, options, ref_type, required, order_index)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING `+definitionColumns,
+		projectID, body.EntityType, body.Key, body.Label, body.FieldType, body.Options,
+		body.RefType, body.Required, body.OrderIndex))
+	// La contrainte UNIQUE (project_id, entity_type, key) tranche, même entre
+	// deux créations simultanées
+	if db.IsUniqueViolation(err) {
+		http.Error(w, "key already used for this entity_type", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, d)
+}
+
+func getDefinition(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	d, err := ownedDefinition(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, d)
+}
+
+// updateDefinition : entity_type et key sont figés (les valeurs y sont
+// rattachées). Changer de type, de cible ou retirer une option encore
+// utilisée est refusé (409) ; passer un champ en required ne touche pas aux
+// entités existantes, la contrainte s'applique à leur prochaine écriture.
+func updateDefinition(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body definitionInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	cur, err := ownedDefinition(ctx, tx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if body.EntityType == "" {
+		body.EntityType = cur.EntityType
+	}
+	if body.Key == "" {
+		body.Key = cur.Key
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.EntityType != cur.EntityType || body.Key != cur.Key {
+		http.Error(w, "entity_type and key cannot be changed", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.LockProject(ctx, tx, cur.ProjectID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	conflict, err := conflictsWithValues(ctx, tx, cur, body)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if conflict {
+		http.Error(w, errFieldInUse.Error(), http.StatusConflict)
+		return
+	}
+
+	d, err := scanDefinition(tx.QueryRow(ctx, `
+		UPDATE custom_field_definitions AS d
+		SET label = $2, field_type = $3, options = $4, ref_type = $5, required = $6, order_index = $7
+		WHERE d.id = $1
+		RETURNING `+definitionColumns,
+		cur.ID, body.Label, body.FieldType, body.Options, body.RefType, body.Required, body.OrderIndex))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, d)
+}
+
+// conflictsWithValues : des entités ont-elles une valeur que la nouvelle
+// définition rendrait invalide ?
+func conflictsWithValues(ctx context.Context, q db.Querier, cur models.CustomFieldDefinition, next definitionInput) (bool, error) {
+	values := entityTables[cur.EntityType].values()
+	var conflict bool
+
+	if next.FieldType != cur.FieldType || next.RefType != cur.RefType {
+		err := q.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM (`+values+`) v WHERE v.cf ? $2)
+		`, cur.ProjectID, cur.Key).Scan(&conflict)
+		return conflict, err
+	}
+	if next.FieldType == "enum" {
+		err := q.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM (`+values+`) v
+				WHERE v.cf ? $2
+				  AND NOT (v.cf ->> $2 = ANY ($3::text[]))
+			)`, cur.ProjectID, cur.Key, next.Options).Scan(&conflict)
+		return conflict, err
+	}
+	return false, nil
+}
+
+// deleteDefinition supprime aussi la valeur du champ sur toutes les entités,
+// à la corbeille comprises, et dans leurs surcharges.
+func deleteDefinition(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	d, err := ownedDefinition(ctx, tx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	t := entityTables[d.EntityType]
+	if _, err := tx.Exec(ctx, `
+		UPDATE `+t.table+`
+		SET custom_fields = custom_fields - $2
+		WHERE project_id = $1 AND custom_fields ? $2
+	`, d.ProjectID, d.Key); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE `+t.overrides+` o
+		SET fields = jsonb_set(o.fields, '{custom_fields}', (o.fields->'custom_fields') - $2)
+		FROM `+t.table+` e
+		WHERE e.id = o.`+t.fk+` AND e.project_id = $1 AND o.fields->'custom_fields' ? $2
+	`, d.ProjectID, d.Key); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM custom_field_definitions WHERE id = $1`, d.ID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,209 @@
+package customfields
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/db"
+	"backend/models"
+
+	"github.com/google/uuid"
+)
+
+// ValueError : valeur de champ personnalisé invalide (400).
+type ValueError struct {
+	Key string
+	Msg string
+}
+
+func (e *ValueError) Error() string {
+	if e.Key == "" {
+		return e.Msg
+	}
+	return "custom_fields." + e.Key + ": " + e.Msg
+}
+
+// WriteError : 400 pour une valeur invalide, 500 sinon.
+func WriteError(w http.ResponseWriter, err error) {
+	var ve *ValueError
+	if errors.As(err, &ve) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+}
+
+// Table des entités référencées par un champ "reference" ; les scènes n'ont
+// pas de project_id et passent par leur chapitre. Personnages, lieux et
+// factions peuvent venir du monde de la série.
+var refExistsQueries = map[string]string{
+	"character": `SELECT EXISTS (SELECT 1 FROM characters WHERE public_id = $1 AND project_id = ANY (project_scope($2)))`,
+	"location":  `SELECT EXISTS (SELECT 1 FROM locations WHERE public_id = $1 AND project_id = ANY (project_scope($2)))`,
+	"faction":   `SELECT EXISTS (SELECT 1 FROM factions WHERE public_id = $1 AND project_id = ANY (project_scope($2)))`,
+	"chapter":   `SELECT EXISTS (SELECT 1 FROM chapters WHERE public_id = $1 AND project_id = $2)`,
+	"scene": `SELECT EXISTS (
+		SELECT 1 FROM scenes s JOIN chapters c ON c.id = s.chapter_id
+		WHERE s.public_id = $1 AND c.project_id = $2)`,
+}
+
+// Validate contrôle les valeurs d'une entité contre les définitions du
+// projet et renvoie l'objet normalisé à stocker (les valeurs null sont
+// retirées). Un champ required doit être présent.
+func Validate(ctx context.Context, q db.Querier, projectID int, entityType string, values map[string]any) (map[string]any, error) {
+	defs, err := Definitions(ctx, q, projectID, entityType)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]models.CustomFieldDefinition, len(defs))
+	for _, d := range defs {
+		byKey[d.Key] = d
+	}
+
+	out := map[string]any{}
+	for key, raw := range values {
+		d, ok := byKey[key]
+		if !ok {
+			return nil, &ValueError{Key: key, Msg: "unknown custom field"}
+		}
+		if raw == nil {
+			continue
+		}
+		v, err := normalize(ctx, q, projectID, d, raw)
+		if err != nil {
+			return nil, err
+		}
+		out[key] = v
+	}
+
+	for _, d := range defs {
+		if _, ok := out[d.Key]; d.Required && !ok {
+			return nil, &ValueError{Key: d.Key, Msg: "required"}
+		}
+	}
+	return out, nil
+}
+
+// ValidateUpdate : Validate pour une mise à jour. custom_fields absent du
+// corps (values nil) renvoie nil, à écrire avec COALESCE pour garder les
+// valeurs enregistrées ; un objet vide les efface.
+func ValidateUpdate(ctx context.Context, q db.Querier, projectID int, entityType string, values map[string]any) (any, error) {
+	if values == nil {
+		return nil, nil
+	}
+	return Validate(ctx, q, projectID, entityType, values)
+}
+
+func normalize(ctx context.Context, q db.Querier, projectID int, d models.CustomFieldDefinition, raw any) (any, error) {
+	switch d.FieldType {
+	case "number":
+		n, ok := raw.(float64)
+		if !ok {
+			return nil, &ValueError{Key: d.Key, Msg: "must be a number"}
+		}
+		return n, nil
+	}
+
+	s, ok := raw.(string)
+	if !ok {
+		return nil, &ValueError{Key: d.Key, Msg: "must be a string"}
+	}
+	s = strings.TrimSpace(s)
+
+	switch d.FieldType {
+	case "text":
+		return s, nil
+	case "date":
+		if _, err := time.Parse(time.DateOnly, s); err != nil {
+			return nil, &ValueError{Key: d.Key, Msg: "must be a date (YYYY-MM-DD)"}
+		}
+		return s, nil
+	case "enum":
+		for _, o := range d.Options {
+			if o == s {
+				return s, nil
+			}
+		}
+		return nil, &ValueError{Key: d.Key, Msg: "must be one of " + strings.Join(d.Options, ", ")}
+	case "reference":
+		pub, err := uuid.Parse(s)
+		if err != nil {
+			return nil, &ValueError{Key: d.Key, Msg: "must be a " + d.RefType + " id"}
+		}
+		var exists bool
+		if err := q.QueryRow(ctx, refExistsQueries[d.RefType], pub, projectID).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, &ValueError{Key: d.Key, Msg: "unknown " + d.RefType}
+		}
+		return pub.String(), nil
+	}
+	return nil, &ValueError{Key: d.Key, Msg: "unsupported field_type " + d.FieldType}
+}
+
+// FilterPrefix : paramètres de filtre des listes, ?cf.<key>=<valeur>.
+const FilterPrefix = "cf."
+
+// Filter traduit les paramètres ?cf.<key>=<valeur> en conditions SQL
+// (" AND ...") sur <alias>.custom_fields ; les paramètres SQL sont numérotés
+// à partir de $<next>. Plusieurs valeurs pour une même clé = OU.
+func Filter(ctx context.Context, q db.Querier, projectID int, entityType string, query url.Values, alias string, next int) (string, []any, error) {
+	var keys []string
+	for p := range query {
+		if strings.HasPrefix(p, FilterPrefix) {
+			keys = append(keys, p)
+		}
+	}
+	if len(keys) == 0 {
+		return "", nil, nil
+	}
+	sort.Strings(keys)
+
+	defs, err := Definitions(ctx, q, projectID, entityType)
+	if err != nil {
+		return "", nil, err
+	}
+	byKey := make(map[string]models.CustomFieldDefinition, len(defs))
+	for _, d := range defs {
+		byKey[d.Key] = d
+	}
+
+	var sql strings.Builder
+	var args []any
+	for _, p := range keys {
+		key := strings.TrimPrefix(p, FilterPrefix)
+		d, ok := byKey[key]
+		if !ok {
+			return "", nil, &ValueError{Key: key, Msg: "unknown custom field"}
+		}
+
+		col := fmt.Sprintf("(%s.custom_fields ->> $%d)", alias, next)
+		args = append(args, key)
+		next++
+
+		if d.FieldType == "number" {
+			nums := []float64{}
+			for _, v := range query[p] {
+				n, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					return "", nil, &ValueError{Key: key, Msg: "filter must be a number"}
+				}
+				nums = append(nums, n)
+			}
+			fmt.Fprintf(&sql, " AND %s::numeric = ANY ($%d::numeric[])", col, next)
+			args = append(args, nums)
+		} else {
+			fmt.Fprintf(&sql, " AND %s = ANY ($%d::text[])", col, next)
+			args = append(args, query[p])
+		}
+		next++
+	}
+	return sql.String(), args, nil
+}
@@ -0,0 +1,531 @@
+package factions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+	"backend/routes/customfields"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/project/{projectUUID}", getFactionsByProject)
+	r.Post("/project/{projectUUID}", createFaction)
+	r.Get("/{uuid}", getFaction)
+	r.Put("/{uuid}", updateFaction)
+	r.Delete("/{uuid}", deleteFaction)
+
+	// Membres (personnage <-> faction)
+	r.Get("/{uuid}/members", getMembers)
+	r.Post("/{uuid}/members", addMember)
+	r.Put("/members/{uuid}", updateMember)
+	r.Delete("/members/{uuid}", deleteMember)
+
+	return r
+}
+
+type factionInput struct {
+	Name         string         `json:"name"`
+	Description  string         `json:"description"`
+	Color        string         `json:"color"`
+	CustomFields map[string]any `json:"custom_fields"`
+}
+
+func (in *factionInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Color = strings.TrimSpace(in.Color)
+	if in.Name == "" {
+		return errors.New("name requis")
+	}
+	return nil
+}
+
+type memberInput struct {
+	CharacterID    uuid.UUID  `json:"character_id"`
+	Rank           *int       `json:"rank,omitempty"`
+	Title          string     `json:"title"`
+	StartChapterID *uuid.UUID `json:"start_chapter_id,omitempty"`
+	EndChapterID   *uuid.UUID `json:"end_chapter_id,omitempty"`
+}
+
+var (
+	errInvalidCharacter = errors.New("invalid character_id")
+	errInvalidChapter   = errors.New("invalid start_chapter_id or end_chapter_id")
+	errChapterRange     = errors.New("end_chapter_id is before start_chapter_id")
+)
+
+const factionColumns = `f.id, f.public_id, f.project_id, f.name, f.description, f.color, f.custom_fields`
+
+func scanFaction(row pgx.Row) (models.Faction, error) {
+	var f models.Faction
+	err := row.Scan(&f.ID, &f.PublicID, &f.ProjectID, &f.Name, &f.Description, &f.Color, &f.CustomFields)
+	return f, err
+}
+
+const memberSelect = `
+	SELECT m.id, m.public_id, f.public_id, c.public_id, m.rank, m.title, sc.public_id, ec.public_id
+	FROM faction_members m
+	JOIN factions f ON f.id = m.faction_id
+	JOIN characters c ON c.id = m.character_id
+	LEFT JOIN chapters sc ON sc.id = m.start_chapter_id
+	LEFT JOIN chapters ec ON ec.id = m.end_chapter_id`
+
+func scanMember(row pgx.Row) (models.FactionMember, error) {
+	var m models.FactionMember
+	err := row.Scan(&m.ID, &m.PublicID, &m.FactionID, &m.CharacterID, &m.Rank, &m.Title,
+		&m.StartChapterID, &m.EndChapterID)
+	return m, err
+}
+
+func listMembers(ctx context.Context, q db.Querier, where string, arg any) ([]models.FactionMember, error) {
+	rows, err := q.Query(ctx, memberSelect+`
+		WHERE `+where+`
+		ORDER BY f.name ASC, m.rank ASC NULLS LAST, c.name ASC`, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.FactionMember{}
+	for rows.Next() {
+		m, err := scanMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// MembersByProject : toutes les appartenances d'un projet, y compris celles
+// du monde de sa série entre entités visibles (payload /full).
+func MembersByProject(ctx context.Context, q db.Querier, projectID int) ([]models.FactionMember, error) {
+	return listMembers(ctx, q, "f.project_id = ANY (project_scope($1)) AND c.project_id = ANY (project_scope($1))", projectID)
+}
+
+// MembersByCharacter : les factions d'un personnage (côté /characters).
+func MembersByCharacter(ctx context.Context, q db.Querier, characterID int) ([]models.FactionMember, error) {
+	return listMembers(ctx, q, "m.character_id = $1", characterID)
+}
+
+// ownedFaction retrouve (id, project_id) d'une faction du propriétaire.
+func ownedFaction(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (id, projectID int, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT f.id, f.project_id
+		FROM factions f
+		JOIN projects p ON p.id = f.project_id
+		WHERE f.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&id, &projectID)
+	return id, projectID, err
+}
+
+// chapterRef résout un chapitre du projet en (id, order_index).
+func chapterRef(ctx context.Context, q db.Querier, pub *uuid.UUID, projectID int) (*int, int, error) {
+	if pub == nil {
+		return nil, 0, nil
+	}
+	var id, order int
+	err := q.QueryRow(ctx, `
+		SELECT id, order_index FROM chapters WHERE public_id = $1 AND project_id = $2
+	`, *pub, projectID).Scan(&id, &order)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, errInvalidChapter
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return &id, order, nil
+}
+
+// resolveChapters valide les bornes start/end : même projet et start <= end.
+func resolveChapters(ctx context.Context, q db.Querier, in memberInput, projectID int) (start, end *int, err error) {
+	start, startOrder, err := chapterRef(ctx, q, in.StartChapterID, projectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	end, endOrder, err := chapterRef(ctx, q, in.EndChapterID, projectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if start != nil && end != nil && endOrder < startOrder {
+		return nil, nil, errChapterRange
+	}
+	return start, end, nil
+}
+
+func writeMemberError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidCharacter) || errors.Is(err, errInvalidChapter) || errors.Is(err, errChapterRange) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+}
+
+func getFactionsByProject(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	// Filtres ?cf.<key>=<valeur> sur les champs personnalisés
+	filter, args, err := customfields.Filter(ctx, db.Pool, projectID, "faction", r.URL.Query(), "f", 2)
+	if err != nil {
+		customfields.WriteError(w, err)
+		return
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+factionColumns+`
+		FROM factions f
+		WHERE f.project_id = $1`+filter+`
+		ORDER BY f.name ASC`, append([]any{projectID}, args...)...)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := []models.Faction{}
+	for rows.Next() {
+		f, err := scanFaction(rows)
+		if err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		list = append(list, f)
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createFaction(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body factionInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cf, err := customfields.Validate(ctx, db.Pool, projectID, "faction", body.CustomFields)
+	if err != nil {
+		customfields.WriteError(w, err)
+		return
+	}
+
+	f, err := scanFaction(db.Pool.QueryRow(ctx, `
+		INSERT INTO factions AS f (public_id, project_id, name, description, color, custom_fields)
+		VALUES (gen_random_uuid(), $1, $2, $3, $4, $5)
+		RETURNING `+factionColumns,
+		projectID, body.Name, body.Description, body.Color, cf))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, f)
+}
+
+func getFaction(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	f, err := scanFaction(db.Pool.QueryRow(ctx, `
+		SELECT `+factionColumns+`
+		FROM factions f
+		JOIN projects p ON p.id = f.project_id
+		WHERE f.public_id = $1 AND p.user_id = $2`, pub, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, f)
+}
+
+func updateFaction(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body factionInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, projectID, err := ownedFaction(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cf, err := customfields.ValidateUpdate(ctx, db.Pool, projectID, "faction", body.CustomFields)
+	if err != nil {
+		customfields.WriteError(w, err)
+		return
+	}
+
+	f, err := scanFaction(db.Pool.QueryRow(ctx, `
+		UPDATE factions AS f
+		SET name = $2, description = $3, color = $4, custom_fields = COALESCE($5, f.custom_fields)
+		WHERE f.id = $1
+		RETURNING `+factionColumns,
+		id, body.Name, body.Description, body.Color, cf))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, f)
+}
+
+func deleteFaction(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	// Mise à la corbeille : les membres et régions restent, masqués
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE factions f SET deleted_at = now()
+		FROM projects p
+		WHERE p.id = f.project_id AND f.public_id = $1 AND p.user_id = $2
+	`, pub, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getMembers(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+	id, _, err := ownedFaction(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list, err := listMembers(ctx, db.Pool, "m.faction_id = $1", id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func addMember(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body memberInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	body.Title = strings.TrimSpace(body.Title)
+
+	factionID, projectID, err := ownedFaction(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Le personnage doit appartenir au projet de la faction (ou au monde de
+	// sa série)
+	var characterID int
+	err = db.Pool.QueryRow(ctx, `
+		SELECT id FROM characters WHERE public_id = $1 AND project_id = ANY (project_scope($2))
+	`, body.CharacterID, projectID).Scan(&characterID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeMemberError(w, errInvalidCharacter)
+		return
+	}
+	if err != nil {
+		writeMemberError(w, err)
+		return
+	}
+	start, end, err := resolveChapters(ctx, db.Pool, body, projectID)
+	if err != nil {
+		writeMemberError(w, err)
+		return
+	}
+
+	var id int
+	if err := db.Pool.QueryRow(ctx, `
+		INSERT INTO faction_members (faction_id, character_id, rank, title, start_chapter_id, end_chapter_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		factionID, characterID, body.Rank, body.Title, start, end).Scan(&id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	m, err := scanMember(db.Pool.QueryRow(ctx, memberSelect+` WHERE m.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, m)
+}
+
+// ownedMember retrouve (id, project_id) d'une appartenance du propriétaire.
+func ownedMember(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (id, projectID int, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT m.id, f.project_id
+		FROM faction_members m
+		JOIN factions f ON f.id = m.faction_id
+		JOIN projects p ON p.id = f.project_id
+		WHERE m.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&id, &projectID)
+	return id, projectID, err
+}
+
+// updateMember modifie rang, titre et bornes ; le personnage et la faction
+// ne changent pas (supprimer puis recréer pour ça).
+func updateMember(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body memberInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	body.Title = strings.TrimSpace(body.Title)
+
+	id, projectID, err := ownedMember(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	start, end, err := resolveChapters(ctx, db.Pool, body, projectID)
+	if err != nil {
+		writeMemberError(w, err)
+		return
+	}
+
+	if _, err := db.Pool.Exec(ctx, `
+		UPDATE faction_members
+		SET rank = $2, title = $3, start_chapter_id = $4, end_chapter_id = $5
+		WHERE id = $1`,
+		id, body.Rank, body.Title, start, end); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	m, err := scanMember(db.Pool.QueryRow(ctx, memberSelect+` WHERE m.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, m)
+}
+
+func deleteMember(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM faction_members m
+		USING factions f, projects p
+		WHERE f.id = m.faction_id AND p.id = f.project_id
+		  AND m.public_id = $1 AND p.user_id = $2
+	`, pub, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,88 @@
+package images
+
+import (
+	"context"
+	"io"
+	"path"
+	"strconv"
+
+	"backend/db"
+	"backend/models"
+	"backend/storage"
+
+	"github.com/google/uuid"
+)
+
+// storageKeys : clés de l'image et de sa miniature dans le stockage.
+func storageKeys(projectID int, pub uuid.UUID, ext, thumbExt string) (string, string) {
+	prefix := path.Join("projects", strconv.Itoa(projectID), "images")
+	return path.Join(prefix, pub.String()+ext), path.Join(prefix, pub.String()+"_thumb"+thumbExt)
+}
+
+// ByProject : images du projet, avec leurs clés de stockage.
+func ByProject(ctx context.Context, q db.Querier, projectID int) ([]models.Image, error) {
+	rows, err := q.Query(ctx, `
+		SELECT `+imageColumns+`
+		FROM images i
+		WHERE i.project_id = $1
+		ORDER BY i.id ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Image{}
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, img)
+	}
+	return list, rows.Err()
+}
+
+func copyObject(ctx context.Context, from, to, contentType string) error {
+	rc, err := storage.Default.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	return storage.Default.Put(ctx, to, data, contentType)
+}
+
+// CopyToProject duplique img (fichiers compris) dans le projet projectID.
+// Renvoie la nouvelle image et les clés écrites dans le stockage, que
+// l'appelant supprime si sa transaction n'aboutit pas.
+func CopyToProject(ctx context.Context, q db.Querier, img models.Image, projectID int) (models.Image, []string, error) {
+	pub := uuid.New()
+	key, thumbKey := storageKeys(projectID, pub, path.Ext(img.StorageKey), path.Ext(img.ThumbKey))
+
+	var written []string
+	if err := copyObject(ctx, img.StorageKey, key, img.ContentType); err != nil {
+		return models.Image{}, written, err
+	}
+	written = append(written, key)
+	// Type de la miniature déduit de son extension (JPEG ou PNG, voir encodeThumb)
+	thumbType := "image/png"
+	if path.Ext(img.ThumbKey) == allowedTypes["image/jpeg"] {
+		thumbType = "image/jpeg"
+	}
+	if err := copyObject(ctx, img.ThumbKey, thumbKey, thumbType); err != nil {
+		return models.Image{}, written, err
+	}
+	written = append(written, thumbKey)
+
+	copied, err := scanImage(q.QueryRow(ctx, `
+		INSERT INTO images AS i (public_id, project_id, kind, filename, content_type, size_bytes,
+		                         width, height, storage_key, thumb_key, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING `+imageColumns,
+		pub, projectID, img.Kind, img.Filename, img.ContentType, img.SizeBytes,
+		img.Width, img.Height, key, thumbKey, img.CreatedAt))
+	return copied, written, err
+}
@@ -0,0 +1,473 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+	"backend/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/project/{projectUUID}", getImagesByProject)
+	r.Post("/project/{projectUUID}", uploadImage) // multipart : file, kind, character_id?, location_id?
+	r.Get("/{uuid}", getImage)
+	r.Get("/{uuid}/file", serveOriginal)
+	r.Get("/{uuid}/thumb", serveThumb)
+	r.Delete("/{uuid}", deleteImage)
+
+	return r
+}
+
+// Taille max d'un fichier (MAX_UPLOAD_BYTES, 10 Mo par défaut)
+const defaultMaxUploadBytes = 10 << 20
+
+// Nombre max de pixels décodés : protège des "bombes" (petit fichier,
+// dimensions énormes)
+const maxPixels = 40_000_000
+
+// Types acceptés, détectés sur le contenu (pas sur l'extension ni l'en-tête
+// envoyé par le client)
+var allowedTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+var validKinds = map[string]bool{
+	"avatar":   true,
+	"location": true,
+	"map":      true,
+	"other":    true,
+}
+
+func maxUploadBytes() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("MAX_UPLOAD_BYTES"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return defaultMaxUploadBytes
+}
+
+const imageColumns = `i.id, i.public_id, i.project_id, i.kind, i.filename, i.content_type,
+	i.size_bytes, i.width, i.height, i.storage_key, i.thumb_key, i.created_at`
+
+func scanImage(row pgx.Row) (models.Image, error) {
+	var img models.Image
+	err := row.Scan(&img.ID, &img.PublicID, &img.ProjectID, &img.Kind, &img.Filename, &img.ContentType,
+		&img.SizeBytes, &img.Width, &img.Height, &img.StorageKey, &img.ThumbKey, &img.CreatedAt)
+	if err == nil {
+		img.URL, img.ThumbURL = URLs(img.PublicID)
+	}
+	return img, err
+}
+
+// URLs : adresses de l'image et de sa miniature (lecture réservée au
+// propriétaire).
+func URLs(pub uuid.UUID) (string, string) {
+	base := "/api/images/" + pub.String()
+	return base + "/file", base + "/thumb"
+}
+
+// ownedImage : image d'un projet du propriétaire.
+func ownedImage(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (models.Image, error) {
+	return scanImage(q.QueryRow(ctx, `
+		SELECT `+imageColumns+`
+		FROM images i
+		JOIN projects p ON p.id = i.project_id
+		WHERE i.public_id = $1 AND p.user_id = $2`, pub, userID))
+}
+
+func getImagesByProject(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	args := []any{projectID}
+	where := `i.project_id = $1`
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		if !validKinds[kind] {
+			http.Error(w, "invalid kind", http.StatusBadRequest)
+			return
+		}
+		where += ` AND i.kind = $2`
+		args = append(args, kind)
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+imageColumns+`
+		FROM images i
+		WHERE `+where+`
+		ORDER BY i.created_at DESC, i.id DESC`, args...)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := []models.Image{}
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		list = append(list, img)
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// uploadImage reçoit une image (multipart, champ "file"), vérifie son type
+// réel et sa taille, génère la miniature et stocke les deux fichiers.
+// character_id / location_id optionnels : l'URL est alors posée directement
+// sur avatar_url / image_url de l'entité (même projet).
+func uploadImage(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	limit := maxUploadBytes()
+	// Marge pour l'enveloppe multipart et les autres champs
+	r.Body = http.MaxBytesReader(w, r.Body, limit+64<<10)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("file too large (max %d bytes)", limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "bad multipart form", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	kind := strings.ToLower(strings.TrimSpace(r.FormValue("kind")))
+	if kind == "" {
+		kind = "other"
+	}
+	if !validKinds[kind] {
+		http.Error(w, "invalid kind", http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file requis", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		http.Error(w, "read error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > limit {
+		http.Error(w, fmt.Sprintf("file too large (max %d bytes)", limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := allowedTypes[contentType]
+	if !ok {
+		http.Error(w, "unsupported image type "+contentType+" (jpeg, png or gif)", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		http.Error(w, "invalid image", http.StatusBadRequest)
+		return
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		http.Error(w, "image dimensions too large", http.StatusBadRequest)
+		return
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		http.Error(w, "invalid image", http.StatusBadRequest)
+		return
+	}
+	thumb, thumbType, err := encodeThumb(thumbnail(decoded, thumbSize), contentType)
+	if err != nil {
+		http.Error(w, "thumbnail error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Entité cible éventuelle, vérifiée avant d'écrire quoi que ce soit
+	var characterID, locationID *int
+	if v := r.FormValue("character_id"); v != "" {
+		id, err := resolveInProject(ctx, "characters", v, projectID)
+		if err != nil {
+			writeTargetError(w, err, "character_id")
+			return
+		}
+		characterID = &id
+	}
+	if v := r.FormValue("location_id"); v != "" {
+		id, err := resolveInProject(ctx, "locations", v, projectID)
+		if err != nil {
+			writeTargetError(w, err, "location_id")
+			return
+		}
+		locationID = &id
+	}
+
+	pub := uuid.New()
+	key, thumbKey := storageKeys(projectID, pub, ext, allowedTypes[thumbType])
+
+	if err := storage.Default.Put(ctx, key, data, contentType); err != nil {
+		http.Error(w, "storage error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := storage.Default.Put(ctx, thumbKey, thumb, thumbType); err != nil {
+		_ = storage.Default.Delete(ctx, key)
+		http.Error(w, "storage error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	img, err := insertImage(ctx, pub, projectID, kind, header.Filename, contentType, len(data),
+		cfg.Width, cfg.Height, key, thumbKey, characterID, locationID)
+	if err != nil {
+		// Pas de fichiers orphelins si l'écriture en base échoue
+		_ = storage.Default.Delete(ctx, key)
+		_ = storage.Default.Delete(ctx, thumbKey)
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, img)
+}
+
+var errInvalidTarget = errors.New("invalid target")
+
+// resolveInProject : id interne d'un personnage / lieu du projet.
+func resolveInProject(ctx context.Context, table, pubStr string, projectID int) (int, error) {
+	pub, err := uuid.Parse(pubStr)
+	if err != nil {
+		return 0, errInvalidTarget
+	}
+	var id int
+	err = db.Pool.QueryRow(ctx, `
+		SELECT id FROM `+table+` WHERE public_id = $1 AND project_id = $2
+	`, pub, projectID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, errInvalidTarget
+	}
+	return id, err
+}
+
+func writeTargetError(w http.ResponseWriter, err error, field string) {
+	if errors.Is(err, errInvalidTarget) {
+		http.Error(w, "invalid "+field, http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+}
+
+// insertImage enregistre l'image et, le cas échéant, la pose sur le
+// personnage / lieu, dans une même transaction.
+func insertImage(ctx context.Context, pub uuid.UUID, projectID int, kind, filename, contentType string,
+	size, width, height int, key, thumbKey string, characterID, locationID *int) (models.Image, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return models.Image{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	img, err := scanImage(tx.QueryRow(ctx, `
+		INSERT INTO images AS i (public_id, project_id, kind, filename, content_type, size_bytes,
+		                         width, height, storage_key, thumb_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING `+imageColumns,
+		pub, projectID, kind, path.Base(filename), contentType, size, width, height, key, thumbKey))
+	if err != nil {
+		return img, err
+	}
+
+	if characterID != nil {
+		if _, err := tx.Exec(ctx, `UPDATE characters SET avatar_url = $2 WHERE id = $1`, *characterID, img.URL); err != nil {
+			return img, err
+		}
+	}
+	if locationID != nil {
+		if _, err := tx.Exec(ctx, `UPDATE locations SET image_url = $2 WHERE id = $1`, *locationID, img.URL); err != nil {
+			return img, err
+		}
+	}
+
+	return img, tx.Commit(ctx)
+}
+
+func getImage(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	img, err := ownedImage(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, img)
+}
+
+func serveOriginal(w http.ResponseWriter, r *http.Request) {
+	serveFile(w, r, false)
+}
+
+func serveThumb(w http.ResponseWriter, r *http.Request) {
+	serveFile(w, r, true)
+}
+
+// serveFile : les images sont privées, on vérifie la session et la
+// propriété du projet à chaque lecture.
+func serveFile(w http.ResponseWriter, r *http.Request, thumb bool) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	img, err := ownedImage(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Le contenu d'une image ne change jamais : l'id suffit comme ETag
+	key, contentType, etag := img.StorageKey, img.ContentType, pub.String()
+	if thumb {
+		key, etag = img.ThumbKey, etag+"-thumb"
+		contentType = "image/png"
+		if strings.HasSuffix(key, allowedTypes["image/jpeg"]) {
+			contentType = "image/jpeg"
+		}
+	}
+	etag = `"` + etag + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	rc, err := storage.Default.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "storage error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("ETag", etag)
+	_, _ = io.Copy(w, rc)
+}
+
+// deleteImage supprime l'image et vide les avatar_url / image_url qui y
+// pointaient.
+func deleteImage(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	img, err := ownedImage(ctx, tx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	urlList := []string{img.URL, img.ThumbURL}
+	if _, err := tx.Exec(ctx, `
+		UPDATE characters SET avatar_url = '' WHERE project_id = $1 AND avatar_url = ANY ($2)
+	`, img.ProjectID, urlList); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE locations SET image_url = '' WHERE project_id = $1 AND image_url = ANY ($2)
+	`, img.ProjectID, urlList); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM images WHERE id = $1`, img.ID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Fichiers supprimés après le commit : au pire un orphelin, jamais une
+	// ligne qui pointe vers un fichier absent
+	for _, key := range []string{img.StorageKey, img.ThumbKey} {
+		if err := storage.Default.Delete(ctx, key); err != nil {
+			log.Printf("❌ storage delete error: %s: %v", key, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
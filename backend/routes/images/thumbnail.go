@@ -0,0 +1,98 @@
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+
+	_ "image/gif" // décodeur GIF
+)
+
+// Côté le plus long des miniatures, en pixels
+const thumbSize = 256
+
+// Nombre max d'échantillons par côté et par pixel de la miniature : la
+// moyenne reste rapide même pour une grande image.
+const maxSamples = 4
+
+// thumbnail réduit img pour que son plus grand côté fasse au plus size
+// (jamais d'agrandissement), en moyennant des échantillons de chaque zone.
+func thumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, h*size/w
+		} else {
+			tw, th = w*size/h, size
+		}
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0 := b.Min.Y + y*h/th
+		y1 := b.Min.Y + (y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0 := b.Min.X + x*w/tw
+			x1 := b.Min.X + (x+1)*w/tw
+			dst.Set(x, y, average(img, x0, y0, x1, y1))
+		}
+	}
+	return dst
+}
+
+// average : couleur moyenne (prémultipliée) de [x0,x1)×[y0,y1), sur au
+// plus maxSamples×maxSamples points répartis dans la zone.
+func average(img image.Image, x0, y0, x1, y1 int) color.Color {
+	if x1 <= x0 {
+		x1 = x0 + 1
+	}
+	if y1 <= y0 {
+		y1 = y0 + 1
+	}
+	stepX := max(1, (x1-x0)/maxSamples)
+	stepY := max(1, (y1-y0)/maxSamples)
+
+	var r, g, bl, a, n uint64
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			c := color.RGBA64Model.Convert(img.At(x, y)).(color.RGBA64)
+			r += uint64(c.R)
+			g += uint64(c.G)
+			bl += uint64(c.B)
+			a += uint64(c.A)
+			n++
+		}
+	}
+	return color.RGBA64{
+		R: uint16(r / n),
+		G: uint16(g / n),
+		B: uint16(bl / n),
+		A: uint16(a / n),
+	}
+}
+
+// encodeThumb : JPEG pour les photos, PNG si la source peut être
+// transparente (PNG, GIF).
+func encodeThumb(img image.Image, sourceType string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if sourceType == "image/jpeg" {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "image/png", nil
+}
@@ -0,0 +1,521 @@
+package locations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+	"backend/routes/customfields"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/project/{projectUUID}", getLocationsByProject)
+	r.Post("/project/{projectUUID}", createLocation)
+	r.Get("/{uuid}", getLocation)
+	r.Put("/{uuid}", updateLocation)
+	r.Delete("/{uuid}", deleteLocation)
+	r.Get("/{uuid}/subtree", getSubtree)
+	r.Get("/{uuid}/path", getPath)
+
+	return r
+}
+
+type locationInput struct {
+	Name         string         `json:"name"`
+	Description  string         `json:"description"`
+	MapReference string         `json:"map_reference"`
+	ImageURL     string         `json:"image_url"`
+	ParentID     *uuid.UUID     `json:"parent_id,omitempty"`
+	CustomFields map[string]any `json:"custom_fields"`
+}
+
+func (in *locationInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		return errors.New("name requis")
+	}
+	return nil
+}
+
+// LocationNode : un lieu et ses sous-lieux, pour /subtree.
+type LocationNode struct {
+	models.Location
+	Children []*LocationNode `json:"children"`
+}
+
+var (
+	errInvalidParent = errors.New("invalid parent_id")
+	errParentCycle   = errors.New("parent_id would create a cycle")
+)
+
+// Le parent est exposé par son public_id (sous-requête : la liste sert aussi
+// dans les RETURNING)
+const locationColumns = `l.id, l.public_id, l.project_id, l.name, l.description,
+	l.map_reference, l.image_url,
+	(SELECT pl.public_id FROM locations_all pl WHERE pl.id = l.parent_id), l.custom_fields`
+
+func scanLocation(row pgx.Row) (models.Location, error) {
+	var l models.Location
+	err := row.Scan(&l.ID, &l.PublicID, &l.ProjectID, &l.Name, &l.Description,
+		&l.MapReference, &l.ImageURL, &l.ParentID, &l.CustomFields)
+	return l, err
+}
+
+func collect(rows pgx.Rows) ([]models.Location, error) {
+	defer rows.Close()
+	list := []models.Location{}
+	for rows.Next() {
+		l, err := scanLocation(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, l)
+	}
+	return list, rows.Err()
+}
+
+// ownedLocation retrouve (id, project_id, parent_id) d'un lieu du propriétaire.
+func ownedLocation(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (id, projectID int, parentID *int, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT l.id, l.project_id, l.parent_id
+		FROM locations l
+		JOIN projects p ON p.id = l.project_id
+		WHERE l.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&id, &projectID, &parentID)
+	return id, projectID, parentID, err
+}
+
+// resolveParent traduit le public_id du parent en id interne : il doit être
+// visible depuis le projet (le sien ou le monde de sa série) et ne pas être
+// le lieu lui-même ni l'un de ses descendants (selfID = 0 à la création).
+func resolveParent(ctx context.Context, q db.Querier, parentPub *uuid.UUID, projectID, selfID int) (*int, error) {
+	if parentPub == nil {
+		return nil, nil
+	}
+	var parentID int
+	err := q.QueryRow(ctx, `
+		SELECT id FROM locations WHERE public_id = $1 AND project_id = ANY (project_scope($2))
+	`, *parentPub, projectID).Scan(&parentID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errInvalidParent
+	}
+	if err != nil {
+		return nil, err
+	}
+	if selfID == 0 {
+		return &parentID, nil
+	}
+
+	// Remonte les ancêtres du parent : si on croise selfID, c'est un cycle
+	var cycle bool
+	if err := q.QueryRow(ctx, `
+		WITH RECURSIVE up AS (
+			SELECT id, parent_id FROM locations WHERE id = $1
+			UNION ALL
+			SELECT l.id, l.parent_id FROM locations l JOIN up ON l.id = up.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM up WHERE id = $2)
+	`, parentID, selfID).Scan(&cycle); err != nil {
+		return nil, err
+	}
+	if cycle {
+		return nil, errParentCycle
+	}
+	return &parentID, nil
+}
+
+func writeParentError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidParent) || errors.Is(err, errParentCycle) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+}
+
+func getLocationsByProject(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	// Filtres ?cf.<key>=<valeur> sur les champs personnalisés
+	filter, args, err := customfields.Filter(ctx, db.Pool, projectID, "location", r.URL.Query(), "l", 2)
+	if err != nil {
+		customfields.WriteError(w, err)
+		return
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+locationColumns+`
+		FROM locations l
+		WHERE l.project_id = $1`+filter+`
+		ORDER BY l.name ASC`, append([]any{projectID}, args...)...)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	list, err := collect(rows)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createLocation(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body locationInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	parentID, err := resolveParent(ctx, db.Pool, body.ParentID, projectID, 0)
+	if err != nil {
+		writeParentError(w, err)
+		return
+	}
+
+	cf, err := customfields.Validate(ctx, db.Pool, projectID, "location", body.CustomFields)
+	if err != nil {
+		customfields.WriteError(w, err)
+		return
+	}
+
+	l, err := scanLocation(db.Pool.QueryRow(ctx, `
+		INSERT INTO locations AS l (public_id, project_id, name, description, map_reference, image_url, parent_id, custom_fields)
+		VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+locationColumns,
+		projectID, body.Name, body.Description, body.MapReference, body.ImageURL, parentID, cf))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, l)
+}
+
+func getLocation(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	l, err := scanLocation(db.Pool.QueryRow(ctx, `
+		SELECT `+locationColumns+`
+		FROM locations l
+		JOIN projects p ON p.id = l.project_id
+		WHERE l.public_id = $1 AND p.user_id = $2`, pub, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, l)
+}
+
+func updateLocation(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body locationInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	id, projectID, _, err := ownedLocation(ctx, tx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Verrou projet : deux reparentages croisés ne peuvent pas créer de cycle
+	if err := db.LockProject(ctx, tx, projectID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	parentID, err := resolveParent(ctx, tx, body.ParentID, projectID, id)
+	if err != nil {
+		writeParentError(w, err)
+		return
+	}
+
+	cf, err := customfields.ValidateUpdate(ctx, tx, projectID, "location", body.CustomFields)
+	if err != nil {
+		customfields.WriteError(w, err)
+		return
+	}
+
+	l, err := scanLocation(tx.QueryRow(ctx, `
+		UPDATE locations AS l
+		SET name = $2, description = $3, map_reference = $4, image_url = $5, parent_id = $6, custom_fields = COALESCE($7, l.custom_fields)
+		WHERE l.id = $1
+		RETURNING `+locationColumns,
+		id, body.Name, body.Description, body.MapReference, body.ImageURL, parentID, cf))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, l)
+}
+
+// deleteLocation exige ?mode=reparent|cascade dès que le lieu a des enfants
+// ou des scènes qui y font référence :
+//   - reparent : enfants et scènes passent au parent du lieu supprimé
+//   - cascade  : tout le sous-arbre est supprimé, les scènes concernées
+//     perdent leur location_id (elles ne sont jamais supprimées)
+//
+// Les lieux supprimés vont à la corbeille (routes/trash) ; un sous-arbre y
+// garde sa forme et se restaure d'un bloc.
+func deleteLocation(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+	mode := r.URL.Query().Get("mode")
+	if mode != "" && mode != "reparent" && mode != "cascade" {
+		http.Error(w, "mode must be reparent or cascade", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	id, projectID, parentID, err := ownedLocation(ctx, tx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := db.LockProject(ctx, tx, projectID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var children, scenes int
+	if err := tx.QueryRow(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM locations WHERE parent_id = $1),
+			(SELECT COUNT(*) FROM scenes WHERE location_id = $1)
+	`, id).Scan(&children, &scenes); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if mode == "" && (children > 0 || scenes > 0) {
+		http.Error(w, "location has children or scenes: use ?mode=reparent or ?mode=cascade", http.StatusConflict)
+		return
+	}
+
+	switch mode {
+	case "cascade":
+		if _, err := tx.Exec(ctx, `
+			WITH RECURSIVE sub AS (
+				SELECT id FROM locations WHERE id = $1
+				UNION ALL
+				SELECT l.id FROM locations l JOIN sub ON l.parent_id = sub.id
+			)
+			UPDATE scenes SET location_id = NULL WHERE location_id IN (SELECT id FROM sub)
+		`, id); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if _, err := tx.Exec(ctx, `
+			WITH RECURSIVE sub AS (
+				SELECT id FROM locations WHERE id = $1
+				UNION ALL
+				SELECT l.id FROM locations l JOIN sub ON l.parent_id = sub.id
+			)
+			UPDATE locations SET deleted_at = now() WHERE id IN (SELECT id FROM sub)
+		`, id); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		if _, err := tx.Exec(ctx, `UPDATE locations SET parent_id = $2 WHERE parent_id = $1`, id, parentID); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if _, err := tx.Exec(ctx, `UPDATE scenes SET location_id = $2 WHERE location_id = $1`, id, parentID); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if _, err := tx.Exec(ctx, `UPDATE locations SET deleted_at = now() WHERE id = $1`, id); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getSubtree renvoie le lieu et tous ses descendants, imbriqués.
+func getSubtree(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+	id, _, _, err := ownedLocation(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		WITH RECURSIVE sub AS (
+			SELECT id, 0 AS depth FROM locations WHERE id = $1
+			UNION ALL
+			SELECT l.id, sub.depth + 1 FROM locations l JOIN sub ON l.parent_id = sub.id
+		)
+		SELECT `+locationColumns+`
+		FROM sub
+		JOIN locations l ON l.id = sub.id
+		ORDER BY sub.depth ASC, l.name ASC`, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	list, err := collect(rows)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Trié par profondeur : un parent est toujours vu avant ses enfants
+	nodes := make(map[uuid.UUID]*LocationNode, len(list))
+	var root *LocationNode
+	for _, l := range list {
+		n := &LocationNode{Location: l, Children: []*LocationNode{}}
+		nodes[l.PublicID] = n
+		if l.ID == id {
+			root = n
+			continue
+		}
+		if parent, ok := nodes[*l.ParentID]; ok {
+			parent.Children = append(parent.Children, n)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, root)
+}
+
+// getPath renvoie le fil d'Ariane, de la racine jusqu'au lieu.
+func getPath(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+	id, _, _, err := ownedLocation(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		WITH RECURSIVE up AS (
+			SELECT id, parent_id, 0 AS depth FROM locations WHERE id = $1
+			UNION ALL
+			SELECT l.id, l.parent_id, up.depth + 1 FROM locations l JOIN up ON l.id = up.parent_id
+		)
+		SELECT `+locationColumns+`
+		FROM up
+		JOIN locations l ON l.id = up.id
+		ORDER BY up.depth DESC`, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	list, err := collect(rows)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,482 @@
+package maps
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+	"backend/routes/images"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/project/{projectUUID}", getMapsByProject)
+	r.Post("/project/{projectUUID}", createMap)
+	r.Get("/location/{uuid}", getLocationMap) // carte d'un lieu (clic sur une épingle)
+	r.Get("/{uuid}", getMap)                  // carte + épingles + régions
+	r.Put("/{uuid}", updateMap)
+	r.Delete("/{uuid}", deleteMap)
+
+	// Épingles et régions (voir pins.go)
+	r.Post("/{uuid}/pins", createPin)
+	r.Put("/pins/{uuid}", updatePin)
+	r.Delete("/pins/{uuid}", deletePin)
+	r.Post("/{uuid}/regions", createRegion)
+	r.Put("/regions/{uuid}", updateRegion)
+	r.Delete("/regions/{uuid}", deleteRegion)
+
+	return r
+}
+
+type mapInput struct {
+	Name       string     `json:"name"`
+	ImageID    *uuid.UUID `json:"image_id,omitempty"`
+	LocationID *uuid.UUID `json:"location_id,omitempty"`
+}
+
+func (in *mapInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		return errors.New("name requis")
+	}
+	return nil
+}
+
+// mapDetail : réponse de GET /{uuid}, tout ce qu'il faut pour afficher la carte.
+type mapDetail struct {
+	models.Map
+	Pins    []models.MapPin    `json:"pins"`
+	Regions []models.MapRegion `json:"regions"`
+}
+
+var (
+	errInvalidImage    = errors.New("invalid image_id")
+	errInvalidLocation = errors.New("invalid location_id")
+	errLocationHasMap  = errors.New("this location already has a map")
+)
+
+const mapSelect = `
+	SELECT m.id, m.public_id, m.project_id, m.name, i.public_id, COALESCE(i.width, 0), COALESCE(i.height, 0), l.public_id
+	FROM maps m
+	LEFT JOIN images i ON i.id = m.image_id
+	LEFT JOIN locations l ON l.id = m.location_id`
+
+func scanMap(row pgx.Row) (models.Map, error) {
+	var m models.Map
+	err := row.Scan(&m.ID, &m.PublicID, &m.ProjectID, &m.Name, &m.ImageID, &m.Width, &m.Height, &m.LocationID)
+	if err == nil && m.ImageID != nil {
+		m.ImageURL, m.ThumbURL = images.URLs(*m.ImageID)
+	}
+	return m, err
+}
+
+// ownedMap retrouve (id, project_id) d'une carte du propriétaire.
+func ownedMap(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (id, projectID int, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT m.id, m.project_id
+		FROM maps m
+		JOIN projects p ON p.id = m.project_id
+		WHERE m.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&id, &projectID)
+	return id, projectID, err
+}
+
+// resolveRefs traduit image_id / location_id en ids internes du projet (le
+// lieu peut venir du monde de la série) ; un lieu n'a qu'une carte par
+// projet (selfID = 0 à la création).
+func resolveRefs(ctx context.Context, q db.Querier, in mapInput, projectID, selfID int) (imageID, locationID *int, err error) {
+	if in.ImageID != nil {
+		var id int
+		err = q.QueryRow(ctx, `
+			SELECT id FROM images WHERE public_id = $1 AND project_id = $2
+		`, *in.ImageID, projectID).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, errInvalidImage
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		imageID = &id
+	}
+	if in.LocationID != nil {
+		var id int
+		var taken bool
+		err = q.QueryRow(ctx, `
+			SELECT l.id, EXISTS (
+				SELECT 1 FROM maps WHERE project_id = $2 AND location_id = l.id AND id <> $3
+			)
+			FROM locations l
+			WHERE l.public_id = $1 AND l.project_id = ANY (project_scope($2))
+		`, *in.LocationID, projectID, selfID).Scan(&id, &taken)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, errInvalidLocation
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if taken {
+			return nil, nil, errLocationHasMap
+		}
+		locationID = &id
+	}
+	return imageID, locationID, nil
+}
+
+func writeRefError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidImage), errors.Is(err, errInvalidLocation):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errLocationHasMap):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// parentMap : carte du plus proche ancêtre du lieu représenté qui en a une,
+// parmi les cartes du projet de la carte (puis celles du monde de sa série).
+func parentMap(ctx context.Context, q db.Querier, mapID int) (*uuid.UUID, error) {
+	var pub uuid.UUID
+	err := q.QueryRow(ctx, `
+		WITH RECURSIVE up AS (
+			SELECT l.parent_id AS id, 1 AS depth, m.project_id AS view
+			FROM maps m JOIN locations l ON l.id = m.location_id
+			WHERE m.id = $1
+			UNION ALL
+			SELECT l.parent_id, up.depth + 1, up.view
+			FROM locations l JOIN up ON l.id = up.id
+		)
+		SELECT pm.public_id
+		FROM up
+		JOIN maps pm ON pm.location_id = up.id AND pm.project_id = ANY (project_scope(up.view))
+		ORDER BY up.depth ASC, pm.project_id = up.view DESC
+		LIMIT 1`, mapID).Scan(&pub)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pub, nil
+}
+
+// loadDetail : carte, épingles et régions en une réponse.
+func loadDetail(ctx context.Context, q db.Querier, mapID int) (mapDetail, error) {
+	var d mapDetail
+	m, err := scanMap(q.QueryRow(ctx, mapSelect+` WHERE m.id = $1`, mapID))
+	if err != nil {
+		return d, err
+	}
+	if m.ParentMapID, err = parentMap(ctx, q, mapID); err != nil {
+		return d, err
+	}
+	d.Map = m
+
+	if d.Pins, err = pinsByMap(ctx, q, mapID); err != nil {
+		return d, err
+	}
+	if d.Regions, err = regionsByMap(ctx, q, mapID); err != nil {
+		return d, err
+	}
+	return d, nil
+}
+
+// ByProject : cartes du projet, par nom.
+func ByProject(ctx context.Context, q db.Querier, projectID int) ([]models.Map, error) {
+	rows, err := q.Query(ctx, mapSelect+`
+		WHERE m.project_id = $1
+		ORDER BY m.name ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Map{}
+	for rows.Next() {
+		m, err := scanMap(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+func getMapsByProject(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	list, err := ByProject(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createMap(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body mapInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if err := db.LockProject(ctx, tx, projectID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	imageID, locationID, err := resolveRefs(ctx, tx, body, projectID, 0)
+	if err != nil {
+		writeRefError(w, err)
+		return
+	}
+
+	var id int
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO maps (project_id, name, image_id, location_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`,
+		projectID, body.Name, imageID, locationID).Scan(&id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	d, err := loadDetail(ctx, tx, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, d)
+}
+
+func getMap(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	id, _, err := ownedMap(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	d, err := loadDetail(ctx, db.Pool, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, d)
+}
+
+// getLocationMap : carte d'un lieu ; à défaut, celle de son plus proche
+// ancêtre qui en a une (le lieu y est alors un point de la carte parente).
+// Les cartes sont celles du projet du lieu, ou de ?project=<uuid> pour un
+// lieu partagé vu depuis un livre de la série (chaque livre a les siennes).
+func getLocationMap(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var viewID *int
+	if v := r.URL.Query().Get("project"); v != "" {
+		projectPub, err := uuid.Parse(v)
+		if err != nil {
+			http.Error(w, "invalid project", http.StatusBadRequest)
+			return
+		}
+		id, err := auth.OwnedProjectID(ctx, projectPub, userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "project not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		viewID = &id
+	}
+
+	var id int
+	err := db.Pool.QueryRow(ctx, `
+		WITH RECURSIVE up AS (
+			SELECT l.id, 0 AS depth, COALESCE($3::int, l.project_id) AS view
+			FROM locations l
+			JOIN projects p ON p.id = l.project_id
+			WHERE l.public_id = $1 AND p.user_id = $2
+			  AND l.project_id = ANY (project_scope(COALESCE($3::int, l.project_id)))
+			UNION ALL
+			SELECT l.parent_id, up.depth + 1, up.view
+			FROM locations l JOIN up ON l.id = up.id
+			WHERE l.parent_id IS NOT NULL
+		)
+		SELECT m.id
+		FROM up
+		JOIN maps m ON m.location_id = up.id AND m.project_id = ANY (project_scope(up.view))
+		ORDER BY up.depth ASC, m.project_id = up.view DESC
+		LIMIT 1`, pub, userID, viewID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	d, err := loadDetail(ctx, db.Pool, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, d)
+}
+
+func updateMap(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body mapInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	id, projectID, err := ownedMap(ctx, tx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := db.LockProject(ctx, tx, projectID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	imageID, locationID, err := resolveRefs(ctx, tx, body, projectID, id)
+	if err != nil {
+		writeRefError(w, err)
+		return
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE maps SET name = $2, image_id = $3, location_id = $4 WHERE id = $1
+	`, id, body.Name, imageID, locationID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	d, err := loadDetail(ctx, tx, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, d)
+}
+
+// deleteMap : épingles et régions partent avec la carte ; l'image reste
+// dans la médiathèque du projet.
+func deleteMap(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM maps m
+		USING projects p
+		WHERE p.id = m.project_id AND m.public_id = $1 AND p.user_id = $2
+	`, pub, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
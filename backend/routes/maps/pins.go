@@ -0,0 +1,496 @@
+package maps
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Coordonnées normalisées : (0, 0) coin haut-gauche, (1, 1) coin bas-droit,
+// indépendantes de la résolution de l'image.
+
+func inUnit(v float64) bool {
+	return v >= 0 && v <= 1
+}
+
+type pinInput struct {
+	LocationID uuid.UUID `json:"location_id"`
+	X          float64   `json:"x"`
+	Y          float64   `json:"y"`
+	Label      string    `json:"label"`
+}
+
+func (in *pinInput) validate() error {
+	in.Label = strings.TrimSpace(in.Label)
+	if !inUnit(in.X) || !inUnit(in.Y) {
+		return errors.New("x and y must be between 0 and 1")
+	}
+	return nil
+}
+
+type regionInput struct {
+	FactionID uuid.UUID    `json:"faction_id"`
+	Points    [][2]float64 `json:"points"`
+	Color     string       `json:"color"`
+	Label     string       `json:"label"`
+}
+
+func (in *regionInput) validate() error {
+	in.Color = strings.TrimSpace(in.Color)
+	in.Label = strings.TrimSpace(in.Label)
+	if len(in.Points) < 3 {
+		return errors.New("a region needs at least 3 points")
+	}
+	for _, p := range in.Points {
+		if !inUnit(p[0]) || !inUnit(p[1]) {
+			return errors.New("points must be between 0 and 1")
+		}
+	}
+	return nil
+}
+
+var (
+	errInvalidFaction = errors.New("invalid faction_id")
+	errAlreadyPinned  = errors.New("this location is already pinned on this map")
+)
+
+// La carte "enfant" d'une épingle est celle du lieu épinglé dans le projet
+// de la carte ; à défaut, celle du monde de la série pour un lieu partagé
+const pinSelect = `
+	SELECT pin.id, pin.public_id, m.public_id, l.public_id, l.name, pin.x, pin.y, pin.label, cm.public_id
+	FROM map_pins pin
+	JOIN maps m ON m.id = pin.map_id
+	JOIN locations l ON l.id = pin.location_id
+	LEFT JOIN LATERAL (
+		SELECT c.public_id FROM maps c
+		WHERE c.location_id = pin.location_id AND c.project_id = ANY (project_scope(m.project_id))
+		ORDER BY c.project_id = m.project_id DESC
+		LIMIT 1
+	) cm ON true`
+
+func scanPin(row pgx.Row) (models.MapPin, error) {
+	var p models.MapPin
+	err := row.Scan(&p.ID, &p.PublicID, &p.MapID, &p.LocationID, &p.LocationName,
+		&p.X, &p.Y, &p.Label, &p.ChildMapID)
+	return p, err
+}
+
+func pinsByMap(ctx context.Context, q db.Querier, mapID int) ([]models.MapPin, error) {
+	rows, err := q.Query(ctx, pinSelect+`
+		WHERE pin.map_id = $1
+		ORDER BY l.name ASC`, mapID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.MapPin{}
+	for rows.Next() {
+		p, err := scanPin(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// PinsByProject : épingles de toutes les cartes du projet.
+func PinsByProject(ctx context.Context, q db.Querier, projectID int) ([]models.MapPin, error) {
+	rows, err := q.Query(ctx, pinSelect+`
+		WHERE m.project_id = $1
+		ORDER BY m.id ASC, l.name ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.MapPin, error) {
+		return scanPin(row)
+	})
+}
+
+// Sans couleur propre, une région prend celle de sa faction
+const regionSelect = `
+	SELECT rg.id, rg.public_id, m.public_id, f.public_id, f.name, rg.points,
+	       COALESCE(NULLIF(rg.color, ''), f.color), rg.label
+	FROM map_regions rg
+	JOIN maps m ON m.id = rg.map_id
+	JOIN factions f ON f.id = rg.faction_id`
+
+func scanRegion(row pgx.Row) (models.MapRegion, error) {
+	var rg models.MapRegion
+	err := row.Scan(&rg.ID, &rg.PublicID, &rg.MapID, &rg.FactionID, &rg.FactionName,
+		&rg.Points, &rg.Color, &rg.Label)
+	return rg, err
+}
+
+func regionsByMap(ctx context.Context, q db.Querier, mapID int) ([]models.MapRegion, error) {
+	rows, err := q.Query(ctx, regionSelect+`
+		WHERE rg.map_id = $1
+		ORDER BY rg.id ASC`, mapID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.MapRegion{}
+	for rows.Next() {
+		rg, err := scanRegion(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, rg)
+	}
+	return list, rows.Err()
+}
+
+// RegionsByProject : régions de toutes les cartes du projet.
+func RegionsByProject(ctx context.Context, q db.Querier, projectID int) ([]models.MapRegion, error) {
+	rows, err := q.Query(ctx, regionSelect+`
+		WHERE m.project_id = $1
+		ORDER BY m.id ASC, rg.id ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.MapRegion, error) {
+		return scanRegion(row)
+	})
+}
+
+// pinLocation : id interne du lieu (même projet), refusé s'il est déjà
+// épinglé sur la carte (selfID = épingle modifiée, 0 à la création).
+func pinLocation(ctx context.Context, q db.Querier, pub uuid.UUID, projectID, mapID, selfID int) (int, error) {
+	var id int
+	var pinned bool
+	err := q.QueryRow(ctx, `
+		SELECT l.id, EXISTS (
+			SELECT 1 FROM map_pins WHERE map_id = $3 AND location_id = l.id AND id <> $4
+		)
+		FROM locations l
+		WHERE l.public_id = $1 AND l.project_id = ANY (project_scope($2))
+	`, pub, projectID, mapID, selfID).Scan(&id, &pinned)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, errInvalidLocation
+	}
+	if err != nil {
+		return 0, err
+	}
+	if pinned {
+		return 0, errAlreadyPinned
+	}
+	return id, nil
+}
+
+func regionFaction(ctx context.Context, q db.Querier, pub uuid.UUID, projectID int) (int, error) {
+	var id int
+	err := q.QueryRow(ctx, `
+		SELECT id FROM factions WHERE public_id = $1 AND project_id = ANY (project_scope($2))
+	`, pub, projectID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, errInvalidFaction
+	}
+	return id, err
+}
+
+func writePinError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidLocation), errors.Is(err, errInvalidFaction):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errAlreadyPinned):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ownedPin retrouve (id, map_id, project_id) d'une épingle du propriétaire.
+func ownedPin(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (id, mapID, projectID int, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT pin.id, m.id, m.project_id
+		FROM map_pins pin
+		JOIN maps m ON m.id = pin.map_id
+		JOIN projects p ON p.id = m.project_id
+		WHERE pin.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&id, &mapID, &projectID)
+	return id, mapID, projectID, err
+}
+
+// ownedRegion retrouve (id, project_id) d'une région du propriétaire.
+func ownedRegion(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (id, projectID int, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT rg.id, m.project_id
+		FROM map_regions rg
+		JOIN maps m ON m.id = rg.map_id
+		JOIN projects p ON p.id = m.project_id
+		WHERE rg.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&id, &projectID)
+	return id, projectID, err
+}
+
+func createPin(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body pinInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mapID, projectID, err := ownedMap(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	locationID, err := pinLocation(ctx, db.Pool, body.LocationID, projectID, mapID, 0)
+	if err != nil {
+		writePinError(w, err)
+		return
+	}
+
+	var id int
+	if err := db.Pool.QueryRow(ctx, `
+		INSERT INTO map_pins (map_id, location_id, x, y, label)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (map_id, location_id) DO NOTHING
+		RETURNING id`,
+		mapID, locationID, body.X, body.Y, body.Label).Scan(&id); err != nil {
+		// Course avec une épingle concurrente sur le même lieu
+		if errors.Is(err, pgx.ErrNoRows) {
+			writePinError(w, errAlreadyPinned)
+			return
+		}
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p, err := scanPin(db.Pool.QueryRow(ctx, pinSelect+` WHERE pin.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, p)
+}
+
+func updatePin(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body pinInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, mapID, projectID, err := ownedPin(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	locationID, err := pinLocation(ctx, db.Pool, body.LocationID, projectID, mapID, id)
+	if err != nil {
+		writePinError(w, err)
+		return
+	}
+
+	if _, err := db.Pool.Exec(ctx, `
+		UPDATE map_pins SET location_id = $2, x = $3, y = $4, label = $5 WHERE id = $1
+	`, id, locationID, body.X, body.Y, body.Label); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p, err := scanPin(db.Pool.QueryRow(ctx, pinSelect+` WHERE pin.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, p)
+}
+
+func deletePin(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM map_pins pin
+		USING maps m, projects p
+		WHERE m.id = pin.map_id AND p.id = m.project_id
+		  AND pin.public_id = $1 AND p.user_id = $2
+	`, pub, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func createRegion(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body regionInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mapID, projectID, err := ownedMap(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	factionID, err := regionFaction(ctx, db.Pool, body.FactionID, projectID)
+	if err != nil {
+		writePinError(w, err)
+		return
+	}
+
+	var id int
+	if err := db.Pool.QueryRow(ctx, `
+		INSERT INTO map_regions (map_id, faction_id, points, color, label)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`,
+		mapID, factionID, body.Points, body.Color, body.Label).Scan(&id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rg, err := scanRegion(db.Pool.QueryRow(ctx, regionSelect+` WHERE rg.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, rg)
+}
+
+func updateRegion(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body regionInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, projectID, err := ownedRegion(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	factionID, err := regionFaction(ctx, db.Pool, body.FactionID, projectID)
+	if err != nil {
+		writePinError(w, err)
+		return
+	}
+
+	if _, err := db.Pool.Exec(ctx, `
+		UPDATE map_regions SET faction_id = $2, points = $3, color = $4, label = $5 WHERE id = $1
+	`, id, factionID, body.Points, body.Color, body.Label); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rg, err := scanRegion(db.Pool.QueryRow(ctx, regionSelect+` WHERE rg.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rg)
+}
+
+func deleteRegion(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM map_regions rg
+		USING maps m, projects p
+		WHERE m.id = rg.map_id AND p.id = m.project_id
+		  AND rg.public_id = $1 AND p.user_id = $2
+	`, pub, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
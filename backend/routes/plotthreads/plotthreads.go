@@ -0,0 +1,257 @@
+package plotthreads
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/project/{projectUUID}", getThreadsByProject)
+	r.Post("/project/{projectUUID}", createThread)
+	r.Get("/project/{projectUUID}/report", getReport) // voir report.go
+	r.Get("/{uuid}", getThread)                       // fil + ses scènes dans l'ordre de lecture
+	r.Put("/{uuid}", updateThread)
+	r.Delete("/{uuid}", deleteThread)
+
+	// Rattachement aux scènes (voir scenes.go)
+	r.Post("/{uuid}/scenes", attachScene)
+	r.Delete("/{uuid}/scenes/{sceneUUID}", detachScene)
+	r.Get("/scenes/{uuid}", getSceneThreads)
+
+	return r
+}
+
+var validKinds = map[string]bool{
+	"main":    true,
+	"subplot": true,
+}
+
+type threadInput struct {
+	Name        string `json:"name"`
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	Color       string `json:"color"`
+}
+
+func (in *threadInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Kind = strings.ToLower(strings.TrimSpace(in.Kind))
+	in.Color = strings.TrimSpace(in.Color)
+	if in.Name == "" {
+		return errors.New("name requis")
+	}
+	if in.Kind == "" {
+		in.Kind = "subplot"
+	}
+	if !validKinds[in.Kind] {
+		return errors.New("kind must be main or subplot")
+	}
+	return nil
+}
+
+const threadSelect = `
+	SELECT t.id, t.public_id, t.project_id, t.name, t.kind, t.description, t.color
+	FROM plot_threads t`
+
+func scanThread(row pgx.Row) (models.PlotThread, error) {
+	var t models.PlotThread
+	err := row.Scan(&t.ID, &t.PublicID, &t.ProjectID, &t.Name, &t.Kind, &t.Description, &t.Color)
+	return t, err
+}
+
+// ByProject : fils du projet, intrigue principale en tête (payload /full).
+func ByProject(ctx context.Context, q db.Querier, projectID int) ([]models.PlotThread, error) {
+	rows, err := q.Query(ctx, threadSelect+`
+		WHERE t.project_id = $1
+		ORDER BY t.kind = 'main' DESC, lower(t.name) ASC, t.id ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.PlotThread{}
+	for rows.Next() {
+		t, err := scanThread(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// ownedThread retrouve (id, project_id) d'un fil du propriétaire.
+func ownedThread(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (id, projectID int, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT t.id, t.project_id
+		FROM plot_threads t
+		JOIN projects p ON p.id = t.project_id
+		WHERE t.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&id, &projectID)
+	return id, projectID, err
+}
+
+func getThreadsByProject(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	list, err := ByProject(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createThread(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body threadInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, err := scanThread(db.Pool.QueryRow(ctx, `
+		INSERT INTO plot_threads (project_id, name, kind, description, color)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, public_id, project_id, name, kind, description, color`,
+		projectID, body.Name, body.Kind, body.Description, body.Color))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, t)
+}
+
+// getThread : le fil et ses scènes, dans l'ordre de lecture.
+func getThread(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	id, _, err := ownedThread(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	t, err := scanThread(db.Pool.QueryRow(ctx, threadSelect+` WHERE t.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	scenes, err := threadScenes(ctx, db.Pool, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"thread": t,
+		"scenes": scenes,
+	})
+}
+
+func updateThread(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body threadInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, err := scanThread(db.Pool.QueryRow(ctx, `
+		UPDATE plot_threads t
+		SET name = $3, kind = $4, description = $5, color = $6
+		FROM projects p
+		WHERE p.id = t.project_id AND t.public_id = $1 AND p.user_id = $2
+		RETURNING t.id, t.public_id, t.project_id, t.name, t.kind, t.description, t.color`,
+		pub, userID, body.Name, body.Kind, body.Description, body.Color))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, t)
+}
+
+func deleteThread(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM plot_threads t
+		USING projects p
+		WHERE p.id = t.project_id AND t.public_id = $1 AND p.user_id = $2
+	`, pub, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,146 @@
+package plotthreads
+
+import (
+	"context"
+	"net/http"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/google/uuid"
+)
+
+// gap : suite de chapitres consécutifs où le fil n'apparaît pas, entre sa
+// première et sa dernière scène.
+type gap struct {
+	FromChapterID uuid.UUID   `json:"from_chapter_id"`
+	ToChapterID   uuid.UUID   `json:"to_chapter_id"`
+	Chapters      []uuid.UUID `json:"chapters"`
+}
+
+type threadReport struct {
+	Thread         models.PlotThread `json:"thread"`
+	Scenes         []threadScene     `json:"scenes"`
+	FirstChapterID *uuid.UUID        `json:"first_chapter_id"`
+	LastChapterID  *uuid.UUID        `json:"last_chapter_id"`
+	LastStatus     string            `json:"last_status"` // état dans la dernière scène du fil, "" si aucune
+	Resolved       bool              `json:"resolved"`
+	Gaps           []gap             `json:"gaps"`
+}
+
+type report struct {
+	Threads []threadReport `json:"threads"`
+	// Fils ouverts dont la dernière scène ne les résout pas
+	Unresolved []uuid.UUID `json:"unresolved"`
+}
+
+type chapterRef struct {
+	ID       int
+	PublicID uuid.UUID
+}
+
+func projectChapters(ctx context.Context, q db.Querier, projectID int) ([]chapterRef, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id, public_id FROM chapters
+		WHERE project_id = $1
+		ORDER BY order_index ASC, id ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []chapterRef
+	for rows.Next() {
+		var c chapterRef
+		if err := rows.Scan(&c.ID, &c.PublicID); err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+// buildThreadReport : scenes est dans l'ordre de lecture, chapters aussi.
+func buildThreadReport(t models.PlotThread, scenes []threadScene, chapters []chapterRef) threadReport {
+	tr := threadReport{Thread: t, Scenes: scenes, Gaps: []gap{}}
+	if len(scenes) == 0 {
+		return tr
+	}
+
+	first, last := scenes[0].ChapterID, scenes[len(scenes)-1].ChapterID
+	tr.FirstChapterID, tr.LastChapterID = &first, &last
+	tr.LastStatus = scenes[len(scenes)-1].Status
+	tr.Resolved = tr.LastStatus == "resolved"
+
+	present := make(map[uuid.UUID]bool, len(scenes))
+	for _, s := range scenes {
+		present[s.ChapterID] = true
+	}
+
+	var current *gap
+	inside := false
+	for _, c := range chapters {
+		if c.PublicID == first {
+			inside = true
+		}
+		if !inside {
+			continue
+		}
+		if present[c.PublicID] {
+			if current != nil {
+				tr.Gaps = append(tr.Gaps, *current)
+				current = nil
+			}
+		} else {
+			if current == nil {
+				current = &gap{FromChapterID: c.PublicID}
+			}
+			current.ToChapterID = c.PublicID
+			current.Chapters = append(current.Chapters, c.PublicID)
+		}
+		if c.PublicID == last {
+			break
+		}
+	}
+	return tr
+}
+
+// getReport : pour chaque fil, ses scènes dans l'ordre, les trous (chapitres
+// sans le fil entre sa première et sa dernière apparition) et la liste des
+// fils non résolus à la fin du manuscrit.
+func getReport(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	threads, err := ByProject(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	chapters, err := projectChapters(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rep := report{Threads: []threadReport{}, Unresolved: []uuid.UUID{}}
+	for _, t := range threads {
+		scenes, err := threadScenes(ctx, db.Pool, t.ID)
+		if err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tr := buildThreadReport(t, scenes, chapters)
+		if len(scenes) > 0 && !tr.Resolved {
+			rep.Unresolved = append(rep.Unresolved, t.PublicID)
+		}
+		rep.Threads = append(rep.Threads, tr)
+	}
+
+	writeJSON(w, http.StatusOK, rep)
+}
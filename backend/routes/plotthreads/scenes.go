@@ -0,0 +1,269 @@
+package plotthreads
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// État d'un fil dans une scène : ouvert, avancé ou résolu.
+
+var validStatuses = map[string]bool{
+	"open":     true,
+	"advanced": true,
+	"resolved": true,
+}
+
+var (
+	errInvalidScene  = errors.New("invalid scene_id")
+	errInvalidStatus = errors.New("status must be open, advanced or resolved")
+)
+
+type attachInput struct {
+	SceneID uuid.UUID `json:"scene_id"`
+	Status  string    `json:"status"`
+	Notes   string    `json:"notes"`
+}
+
+// threadScene : une scène du fil, dans l'ordre de lecture.
+type threadScene struct {
+	SceneID      uuid.UUID `json:"scene_id"`
+	SceneTitle   string    `json:"scene_title"`
+	ChapterID    uuid.UUID `json:"chapter_id"`
+	ChapterTitle string    `json:"chapter_title"`
+	ChapterOrder int       `json:"chapter_order"`
+	SceneOrder   int       `json:"scene_order"`
+	Status       string    `json:"status"`
+	Notes        string    `json:"notes"`
+}
+
+func threadScenes(ctx context.Context, q db.Querier, threadID int) ([]threadScene, error) {
+	rows, err := q.Query(ctx, `
+		SELECT s.public_id, s.title, c.public_id, c.title, c.order_index, s.order_index, spt.status, spt.notes
+		FROM scene_plot_threads spt
+		JOIN scenes s ON s.id = spt.scene_id
+		JOIN chapters c ON c.id = s.chapter_id
+		WHERE spt.thread_id = $1
+		ORDER BY c.order_index ASC, s.order_index ASC`, threadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []threadScene{}
+	for rows.Next() {
+		var ts threadScene
+		if err := rows.Scan(&ts.SceneID, &ts.SceneTitle, &ts.ChapterID, &ts.ChapterTitle,
+			&ts.ChapterOrder, &ts.SceneOrder, &ts.Status, &ts.Notes); err != nil {
+			return nil, err
+		}
+		list = append(list, ts)
+	}
+	return list, rows.Err()
+}
+
+// ScenesByProject : tous les rattachements scène / fil du projet (payload /full).
+func ScenesByProject(ctx context.Context, q db.Querier, projectID int) ([]models.ScenePlotThread, error) {
+	rows, err := q.Query(ctx, `
+		SELECT s.public_id, t.public_id, spt.status, spt.notes
+		FROM scene_plot_threads spt
+		JOIN plot_threads t ON t.id = spt.thread_id
+		JOIN scenes s ON s.id = spt.scene_id
+		WHERE t.project_id = $1
+		ORDER BY t.id ASC, s.id ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.ScenePlotThread{}
+	for rows.Next() {
+		var spt models.ScenePlotThread
+		if err := rows.Scan(&spt.SceneID, &spt.ThreadID, &spt.Status, &spt.Notes); err != nil {
+			return nil, err
+		}
+		list = append(list, spt)
+	}
+	return list, rows.Err()
+}
+
+// attachScene rattache une scène au fil (ou met à jour son état s'il y est
+// déjà). Renvoie les scènes du fil.
+func attachScene(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body attachInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	body.Status = strings.ToLower(strings.TrimSpace(body.Status))
+	if !validStatuses[body.Status] {
+		http.Error(w, errInvalidStatus.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, projectID, err := ownedThread(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// La scène doit être du même projet que le fil
+	var sceneID int
+	err = db.Pool.QueryRow(ctx, `
+		SELECT s.id
+		FROM scenes s
+		JOIN chapters c ON c.id = s.chapter_id
+		WHERE s.public_id = $1 AND c.project_id = $2
+	`, body.SceneID, projectID).Scan(&sceneID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, errInvalidScene.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := db.Pool.Exec(ctx, `
+		INSERT INTO scene_plot_threads (scene_id, thread_id, status, notes)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (scene_id, thread_id) DO UPDATE SET status = EXCLUDED.status, notes = EXCLUDED.notes
+	`, sceneID, id, body.Status, body.Notes); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list, err := threadScenes(ctx, db.Pool, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func detachScene(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+	scenePub, err := uuid.Parse(chi.URLParam(r, "sceneUUID"))
+	if err != nil {
+		http.Error(w, "invalid uuid", http.StatusBadRequest)
+		return
+	}
+
+	id, _, err := ownedThread(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM scene_plot_threads spt
+		USING scenes s
+		WHERE s.id = spt.scene_id AND spt.thread_id = $1 AND s.public_id = $2
+	`, id, scenePub)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sceneThread : un fil présent dans la scène et son état.
+type sceneThread struct {
+	ThreadID uuid.UUID `json:"thread_id"`
+	Name     string    `json:"name"`
+	Kind     string    `json:"kind"`
+	Color    string    `json:"color"`
+	Status   string    `json:"status"`
+	Notes    string    `json:"notes"`
+}
+
+// getSceneThreads : fils présents dans une scène.
+func getSceneThreads(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var sceneID int
+	err := db.Pool.QueryRow(ctx, `
+		SELECT s.id
+		FROM scenes s
+		JOIN chapters c ON c.id = s.chapter_id
+		JOIN projects p ON p.id = c.project_id
+		WHERE s.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&sceneID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT t.public_id, t.name, t.kind, t.color, spt.status, spt.notes
+		FROM scene_plot_threads spt
+		JOIN plot_threads t ON t.id = spt.thread_id
+		WHERE spt.scene_id = $1
+		ORDER BY t.kind = 'main' DESC, lower(t.name) ASC`, sceneID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := []sceneThread{}
+	for rows.Next() {
+		var st sceneThread
+		if err := rows.Scan(&st.ThreadID, &st.Name, &st.Kind, &st.Color, &st.Status, &st.Notes); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		list = append(list, st)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
@@ -0,0 +1,731 @@
+package projects
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+	"backend/routes/images"
+	"backend/storage"
+	"backend/textutil"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Duplication profonde d'un projet : chaque ligne est recopiée avec un
+// nouveau public_id, et les clés étrangères internes pointent vers les
+// copies. Les correspondances ancien id -> nouvel id sont tenues dans une
+// table temporaire (dup_ids) propre à la transaction.
+
+type duplicateInput struct {
+	Title string `json:"title"`
+	// Monde seul (personnages, lieux, factions, codex, cartes...) sans
+	// chapitres ni scènes. Par défaut : oui pour un modèle, non sinon.
+	WorldOnly *bool `json:"world_only,omitempty"`
+}
+
+// ref : nouvel id correspondant à l'ancien id col, NULL si la ligne
+// référencée n'a pas été copiée (ex. chapitre d'une copie "monde seul").
+func ref(kind, col string) string {
+	return `(SELECT new_id FROM dup_ids WHERE kind = '` + kind + `' AND old_id = ` + col + `)`
+}
+
+// entityRef : comme ref pour un personnage, lieu ou faction, mais une
+// entité partagée (monde de la série, copiée seulement pour figer un
+// instantané) garde son id.
+func entityRef(kind, col string) string {
+	return `COALESCE(` + ref(kind, col) + `, ` + col + `)`
+}
+
+// copyStep : list renvoie les ids à copier ($1 = projet source), insert
+// copie une ligne ($1 = ancien id, $2 = nouveau projet si project est vrai)
+// et renvoie son id. Les tables sans project_id retrouvent leur parent par
+// dup_ids. Les listes joignent les entités référencées : un lien vers une
+// entité à la corbeille n'est pas copié.
+type copyStep struct {
+	kind    string
+	project bool
+	list    string
+	insert  string
+}
+
+var chapterSteps = []copyStep{
+	{"chapter", true,
+		`SELECT id FROM chapters WHERE project_id = $1 ORDER BY id`,
+		`INSERT INTO chapters (public_id, project_id, title, synopsis, story_phase_id, order_index)
+		SELECT gen_random_uuid(), $2, title, synopsis, story_phase_id, order_index
+		FROM chapters WHERE id = $1 RETURNING id`},
+}
+
+// Personnages, lieux et factions : aussi les entités du monde de la série
+// figées dans la copie d'un instantané (freezeShared).
+var entitySteps = []copyStep{
+	{"character", true,
+		`SELECT id FROM characters WHERE project_id = $1 ORDER BY id`,
+		`INSERT INTO characters (public_id, project_id, name, role, bio, background, personality,
+		                         objective, internal_conflict, arc_type, notes, avatar_url, custom_fields)
+		SELECT gen_random_uuid(), $2, name, role, bio, background, personality,
+		       objective, internal_conflict, arc_type, notes, avatar_url, custom_fields
+		FROM characters WHERE id = $1 RETURNING id`},
+	// parent_id est reporté une fois tous les lieux copiés
+	{"location", true,
+		`SELECT id FROM locations WHERE project_id = $1 ORDER BY id`,
+		`INSERT INTO locations (public_id, project_id, name, description, map_reference, image_url, custom_fields)
+		SELECT gen_random_uuid(), $2, name, description, map_reference, image_url, custom_fields
+		FROM locations WHERE id = $1 RETURNING id`},
+	{"faction", true,
+		`SELECT id FROM factions WHERE project_id = $1 ORDER BY id`,
+		`INSERT INTO factions (public_id, project_id, name, description, color, custom_fields)
+		SELECT gen_random_uuid(), $2, name, description, color, custom_fields
+		FROM factions WHERE id = $1 RETURNING id`},
+}
+
+// Les bornes en chapitres des appartenances et relations restent vides
+// quand les chapitres ne sont pas copiés.
+var worldSteps = []copyStep{
+	{"faction_member", false,
+		`SELECT m.id FROM faction_members m
+		JOIN factions f ON f.id = m.faction_id
+		JOIN characters c ON c.id = m.character_id
+		WHERE f.project_id = $1 ORDER BY m.id`,
+		`INSERT INTO faction_members (public_id, faction_id, character_id, rank, title,
+		                              start_chapter_id, end_chapter_id)
+		SELECT gen_random_uuid(), ` + entityRef("faction", "o.faction_id") + `, ` + entityRef("character", "o.character_id") + `,
+		       o.rank, o.title, ` + ref("chapter", "o.start_chapter_id") + `, ` + ref("chapter", "o.end_chapter_id") + `
+		FROM faction_members o WHERE o.id = $1 RETURNING id`},
+	{"relationship", true,
+		`SELECT rel.id FROM character_relationships rel
+		JOIN characters fc ON fc.id = rel.from_character_id
+		JOIN characters tc ON tc.id = rel.to_character_id
+		WHERE rel.project_id = $1 ORDER BY rel.id`,
+		`INSERT INTO character_relationships (public_id, project_id, from_character_id, to_character_id,
+		                                      type, notes, change_chapter_id)
+		SELECT gen_random_uuid(), $2, ` + entityRef("character", "o.from_character_id") + `,
+		       ` + entityRef("character", "o.to_character_id") + `, o.type, o.notes, ` + ref("chapter", "o.change_chapter_id") + `
+		FROM character_relationships o WHERE o.id = $1 RETURNING id`},
+	{"custom_field", true,
+		`SELECT id FROM custom_field_definitions WHERE project_id = $1 ORDER BY id`,
+		`INSERT INTO custom_field_definitions (public_id, project_id, entity_type, key, label, field_type,
+		                                      options, ref_type, required, order_index)
+		SELECT gen_random_uuid(), $2, entity_type, key, label, field_type, options, ref_type, required, order_index
+		FROM custom_field_definitions WHERE id = $1 RETURNING id`},
+	{"tag", true,
+		`SELECT id FROM tags WHERE project_id = $1 ORDER BY id`,
+		`INSERT INTO tags (public_id, project_id, name, color)
+		SELECT gen_random_uuid(), $2, name, color
+		FROM tags WHERE id = $1 RETURNING id`},
+	{"codex_term", true,
+		`SELECT id FROM codex_terms WHERE project_id = $1 ORDER BY id`,
+		`INSERT INTO codex_terms (public_id, project_id, term, definition, category, aliases)
+		SELECT gen_random_uuid(), $2, term, definition, category, aliases
+		FROM codex_terms WHERE id = $1 RETURNING id`},
+	{"calendar", true,
+		`SELECT id FROM calendars WHERE project_id = $1 ORDER BY id`,
+		`INSERT INTO calendars (public_id, project_id, name, months, weekdays, eras, epoch_offset, weekday_offset)
+		SELECT gen_random_uuid(), $2, name, months, weekdays, eras, epoch_offset, weekday_offset
+		FROM calendars WHERE id = $1 RETURNING id`},
+	{"timeline_event", true,
+		`SELECT id FROM timeline_events WHERE project_id = $1 ORDER BY id`,
+		`INSERT INTO timeline_events (public_id, project_id, title, description, day, calendar_id)
+		SELECT gen_random_uuid(), $2, o.title, o.description, o.day, ` + ref("calendar", "o.calendar_id") + `
+		FROM timeline_events o WHERE o.id = $1 RETURNING id`},
+}
+
+// Après les images (copiées à part, avec leurs fichiers). Une carte garde
+// son lieu partagé du monde de la série, pas un lieu à la corbeille.
+var mapSteps = []copyStep{
+	{"map", true,
+		`SELECT id FROM maps WHERE project_id = $1 ORDER BY id`,
+		`INSERT INTO maps (public_id, project_id, name, image_id, location_id)
+		SELECT gen_random_uuid(), $2, o.name, ` + ref("image", "o.image_id") + `,
+		       COALESCE(` + ref("location", "o.location_id") + `,
+		                (SELECT l.id FROM locations l WHERE l.id = o.location_id AND l.project_id <> o.project_id))
+		FROM maps o WHERE o.id = $1 RETURNING id`},
+	{"map_pin", false,
+		`SELECT pin.id FROM map_pins pin
+		JOIN maps m ON m.id = pin.map_id
+		JOIN locations l ON l.id = pin.location_id
+		WHERE m.project_id = $1 ORDER BY pin.id`,
+		`INSERT INTO map_pins (public_id, map_id, location_id, x, y, label)
+		SELECT gen_random_uuid(), ` + ref("map", "o.map_id") + `, ` + entityRef("location", "o.location_id") + `,
+		       o.x, o.y, o.label
+		FROM map_pins o WHERE o.id = $1 RETURNING id`},
+	{"map_region", false,
+		`SELECT rg.id FROM map_regions rg
+		JOIN maps m ON m.id = rg.map_id
+		JOIN factions f ON f.id = rg.faction_id
+		WHERE m.project_id = $1 ORDER BY rg.id`,
+		`INSERT INTO map_regions (public_id, map_id, faction_id, points, color, label)
+		SELECT gen_random_uuid(), ` + ref("map", "o.map_id") + `, ` + entityRef("faction", "o.faction_id") + `,
+		       o.points, o.color, o.label
+		FROM map_regions o WHERE o.id = $1 RETURNING id`},
+}
+
+var storySteps = []copyStep{
+	{"scene", false,
+		`SELECT s.id FROM scenes s JOIN chapters c ON c.id = s.chapter_id
+		WHERE c.project_id = $1 ORDER BY s.id`,
+		`INSERT INTO scenes (public_id, chapter_id, chapter_uuid, title, content, summary,
+		                     location_id, order_index, story_day)
+		SELECT gen_random_uuid(), nc.id, nc.public_id, o.title, o.content, o.summary,
+		       ` + entityRef("location", "o.location_id") + `, o.order_index, o.story_day
+		FROM scenes o
+		JOIN chapters nc ON nc.id = ` + ref("chapter", "o.chapter_id") + `
+		WHERE o.id = $1 RETURNING id`},
+	{"plot_thread", true,
+		`SELECT id FROM plot_threads WHERE project_id = $1 ORDER BY id`,
+		`INSERT INTO plot_threads (public_id, project_id, name, kind, description, color)
+		SELECT gen_random_uuid(), $2, name, kind, description, color
+		FROM plot_threads WHERE id = $1 RETURNING id`},
+	{"setup", true,
+		`SELECT st.id FROM setups st JOIN scenes s ON s.id = st.setup_scene_id
+		WHERE st.project_id = $1 ORDER BY st.id`,
+		`INSERT INTO setups (public_id, project_id, title, notes, setup_scene_id, payoff_scene_id, payoff_notes)
+		SELECT gen_random_uuid(), $2, o.title, o.notes, ` + ref("scene", "o.setup_scene_id") + `,
+		       ` + ref("scene", "o.payoff_scene_id") + `, o.payoff_notes
+		FROM setups o WHERE o.id = $1 RETURNING id`},
+	{"arc_checkpoint", false,
+		`SELECT a.id FROM character_arc_checkpoints a
+		JOIN chapters c ON c.id = a.chapter_id
+		JOIN characters ch ON ch.id = a.character_id
+		WHERE c.project_id = $1 ORDER BY a.id`,
+		`INSERT INTO character_arc_checkpoints (public_id, character_id, chapter_id, belief, want, need, state, notes)
+		SELECT gen_random_uuid(), ` + entityRef("character", "o.character_id") + `, ` + ref("chapter", "o.chapter_id") + `,
+		       o.belief, o.want, o.need, o.state, o.notes
+		FROM character_arc_checkpoints o WHERE o.id = $1 RETURNING id`},
+}
+
+// Tables de liaison, copiées d'un bloc une fois les deux côtés copiés
+// ($1 = projet source).
+var worldLinks = []string{
+	`INSERT INTO character_tags (tag_id, character_id)
+	SELECT ` + ref("tag", "x.tag_id") + `, ` + ref("character", "x.character_id") + `
+	FROM character_tags x JOIN characters e ON e.id = x.character_id
+	WHERE e.project_id = $1`,
+	`INSERT INTO location_tags (tag_id, location_id)
+	SELECT ` + ref("tag", "x.tag_id") + `, ` + ref("location", "x.location_id") + `
+	FROM location_tags x JOIN locations e ON e.id = x.location_id
+	WHERE e.project_id = $1`,
+	`INSERT INTO faction_tags (tag_id, faction_id)
+	SELECT ` + ref("tag", "x.tag_id") + `, ` + ref("faction", "x.faction_id") + `
+	FROM faction_tags x JOIN factions e ON e.id = x.faction_id
+	WHERE e.project_id = $1`,
+}
+
+var storyLinks = []string{
+	`INSERT INTO chapter_tags (tag_id, chapter_id)
+	SELECT ` + ref("tag", "x.tag_id") + `, ` + ref("chapter", "x.chapter_id") + `
+	FROM chapter_tags x JOIN chapters e ON e.id = x.chapter_id
+	WHERE e.project_id = $1`,
+	`INSERT INTO scene_tags (tag_id, scene_id)
+	SELECT ` + ref("tag", "x.tag_id") + `, ` + ref("scene", "x.scene_id") + `
+	FROM scene_tags x JOIN scenes e ON e.id = x.scene_id JOIN chapters c ON c.id = e.chapter_id
+	WHERE c.project_id = $1`,
+	`INSERT INTO scene_characters (scene_id, character_id, role)
+	SELECT ` + ref("scene", "x.scene_id") + `, ` + entityRef("character", "x.character_id") + `, x.role
+	FROM scene_characters x JOIN scenes e ON e.id = x.scene_id JOIN chapters c ON c.id = e.chapter_id
+	JOIN characters ch ON ch.id = x.character_id
+	WHERE c.project_id = $1`,
+	`INSERT INTO scene_plot_threads (scene_id, thread_id, status, notes)
+	SELECT ` + ref("scene", "x.scene_id") + `, ` + ref("plot_thread", "x.thread_id") + `, x.status, x.notes
+	FROM scene_plot_threads x JOIN plot_threads t ON t.id = x.thread_id
+	JOIN scenes e ON e.id = x.scene_id
+	WHERE t.project_id = $1`,
+}
+
+// Tables des entités pouvant porter des champs personnalisés, et de celles
+// qu'un champ "reference" peut désigner (par public_id).
+var customFieldTables = map[string]string{
+	"character": "characters",
+	"location":  "locations",
+	"faction":   "factions",
+	"chapter":   "chapters",
+	"scene":     "scenes",
+}
+
+type duplicator struct {
+	tx    pgx.Tx
+	srcID int
+	dstID int
+	// Instantané : monde de la série à figer dans la copie (0 sinon) ;
+	// restauration : entités figées à rapprocher du monde (thaw)
+	freezeWorld int
+	thaw        bool
+	// Clés écrites dans le stockage, à supprimer si la copie échoue
+	written []string
+}
+
+func (d *duplicator) run(ctx context.Context, steps []copyStep) error {
+	for _, s := range steps {
+		rows, err := d.tx.Query(ctx, s.list, d.srcID)
+		if err != nil {
+			return err
+		}
+		oldIDs, err := pgx.CollectRows(rows, pgx.RowTo[int])
+		if err != nil {
+			return err
+		}
+		if d.thaw {
+			if oldIDs, err = d.unmatched(ctx, s.kind, oldIDs); err != nil {
+				return err
+			}
+		}
+
+		newIDs := make([]int, 0, len(oldIDs))
+		for _, old := range oldIDs {
+			args := []any{old}
+			if s.project {
+				args = append(args, d.dstID)
+			}
+			var id int
+			if err := d.tx.QueryRow(ctx, s.insert, args...).Scan(&id); err != nil {
+				return err
+			}
+			newIDs = append(newIDs, id)
+		}
+		if err := d.record(ctx, s.kind, oldIDs, newIDs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmatched : ids de oldIDs sans correspondance dans dup_ids (les entités
+// rapprochées du monde par thawShared ne sont pas recopiées).
+func (d *duplicator) unmatched(ctx context.Context, kind string, oldIDs []int) ([]int, error) {
+	rows, err := d.tx.Query(ctx, `
+		SELECT o FROM unnest($2::int[]) WITH ORDINALITY AS v(o, n)
+		WHERE NOT EXISTS (SELECT 1 FROM dup_ids WHERE kind = $1 AND old_id = o)
+		ORDER BY n
+	`, kind, oldIDs)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+// freezeShared copie les personnages, lieux et factions du monde de la série
+// dans la copie d'un instantané, avant le reste : les liens du livre vers
+// eux pointent ensuite vers ces copies. snapshot_shared garde l'origine.
+func (d *duplicator) freezeShared(ctx context.Context) error {
+	world := &duplicator{tx: d.tx, srcID: d.freezeWorld, dstID: d.dstID}
+	if err := world.run(ctx, entitySteps); err != nil {
+		return err
+	}
+	_, err := d.tx.Exec(ctx, `
+		INSERT INTO snapshot_shared (copy_project_id, kind, frozen_id, shared_id)
+		SELECT $1, kind, new_id, old_id FROM dup_ids
+	`, d.dstID)
+	return err
+}
+
+// thawShared rapproche les entités figées de la copie source des entités du
+// monde encore visibles depuis le projet restauré, qui y renvoie de nouveau
+// au lieu d'en recevoir des copies.
+func (d *duplicator) thawShared(ctx context.Context) error {
+	_, err := d.tx.Exec(ctx, `
+		INSERT INTO dup_ids (kind, old_id, new_id)
+		SELECT s.kind, s.frozen_id, s.shared_id
+		FROM snapshot_shared s
+		WHERE s.copy_project_id = $1 AND s.shared_id IN (
+			SELECT id FROM characters WHERE s.kind = 'character' AND project_id = ANY (project_scope($2))
+			UNION ALL
+			SELECT id FROM locations WHERE s.kind = 'location' AND project_id = ANY (project_scope($2))
+			UNION ALL
+			SELECT id FROM factions WHERE s.kind = 'faction' AND project_id = ANY (project_scope($2))
+		)
+	`, d.srcID, d.dstID)
+	return err
+}
+
+func (d *duplicator) record(ctx context.Context, kind string, oldIDs, newIDs []int) error {
+	_, err := d.tx.Exec(ctx, `
+		INSERT INTO dup_ids (kind, old_id, new_id)
+		SELECT $1, o, n FROM unnest($2::int[], $3::int[]) AS v(o, n)
+	`, kind, oldIDs, newIDs)
+	return err
+}
+
+func (d *duplicator) links(ctx context.Context, stmts []string) error {
+	for _, stmt := range stmts {
+		if _, err := d.tx.Exec(ctx, stmt, d.srcID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyImages duplique les images et leurs fichiers, puis fait pointer
+// avatar_url / image_url des copies vers les nouvelles images.
+func (d *duplicator) copyImages(ctx context.Context) error {
+	list, err := images.ByProject(ctx, d.tx, d.srcID)
+	if err != nil {
+		return err
+	}
+
+	oldIDs := make([]int, 0, len(list))
+	newIDs := make([]int, 0, len(list))
+	for _, img := range list {
+		copied, written, err := images.CopyToProject(ctx, d.tx, img, d.dstID)
+		d.written = append(d.written, written...)
+		if err != nil {
+			return err
+		}
+		oldIDs = append(oldIDs, img.ID)
+		newIDs = append(newIDs, copied.ID)
+
+		for _, u := range [][2]string{{img.URL, copied.URL}, {img.ThumbURL, copied.ThumbURL}} {
+			if _, err := d.tx.Exec(ctx, `
+				UPDATE characters SET avatar_url = $3 WHERE project_id = $1 AND avatar_url = $2
+			`, d.dstID, u[0], u[1]); err != nil {
+				return err
+			}
+			if _, err := d.tx.Exec(ctx, `
+				UPDATE locations SET image_url = $3 WHERE project_id = $1 AND image_url = $2
+			`, d.dstID, u[0], u[1]); err != nil {
+				return err
+			}
+		}
+	}
+	return d.record(ctx, "image", oldIDs, newIDs)
+}
+
+// seedRevisions ouvre l'historique de chaque scène copiée par une révision
+// de départ, attribuée au propriétaire de la copie (comme à la création d'une
+// scène, un texte vide n'en a pas).
+func (d *duplicator) seedRevisions(ctx context.Context) error {
+	rows, err := d.tx.Query(ctx, `
+		SELECT s.id, s.content
+		FROM dup_ids m
+		JOIN scenes_all s ON s.id = m.new_id
+		WHERE m.kind = 'scene' AND s.content <> ''
+		ORDER BY s.id
+	`)
+	if err != nil {
+		return err
+	}
+	type copied struct {
+		id      int
+		content string
+	}
+	list, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (copied, error) {
+		var c copied
+		err := row.Scan(&c.id, &c.content)
+		return c, err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, c := range list {
+		words := textutil.WordCount(c.content)
+		if _, err := d.tx.Exec(ctx, `
+			INSERT INTO scene_revisions (scene_id, user_id, content, word_count, word_delta)
+			SELECT $1, p.user_id, $3, $4, $4
+			FROM projects_all p WHERE p.id = $2
+		`, c.id, d.dstID, c.content, words); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remapReferences réécrit les valeurs des champs "reference" vers les
+// public_id des copies. Une valeur dont la cible n'a pas été copiée est
+// retirée (chapitre, scène d'une copie "monde seul"), sauf pour une entité
+// partagée de la série, qui reste visible depuis la copie.
+func (d *duplicator) remapReferences(ctx context.Context) error {
+	rows, err := d.tx.Query(ctx, `
+		SELECT entity_type, key, ref_type FROM custom_field_definitions
+		WHERE project_id = $1 AND field_type = 'reference'
+	`, d.dstID)
+	if err != nil {
+		return err
+	}
+	type refField struct{ entityType, key, refType string }
+	fields, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (refField, error) {
+		var f refField
+		err := row.Scan(&f.entityType, &f.key, &f.refType)
+		return f, err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		table, refTable := customFieldTables[f.entityType], customFieldTables[f.refType]
+		if table == "" || refTable == "" {
+			continue
+		}
+		fallback := "e.custom_fields->>$2::text"
+		if f.refType == "chapter" || f.refType == "scene" {
+			fallback = "NULL"
+		}
+		if _, err := d.tx.Exec(ctx, `
+			UPDATE `+table+` e
+			SET custom_fields = COALESCE(
+				jsonb_set(e.custom_fields, ARRAY[$2::text], to_jsonb(COALESCE((
+					SELECT n.public_id::text
+					FROM `+refTable+` o
+					JOIN dup_ids m ON m.kind = $3 AND m.old_id = o.id
+					JOIN `+refTable+` n ON n.id = m.new_id
+					WHERE o.public_id::text = e.custom_fields->>$2::text
+				), `+fallback+`))),
+				e.custom_fields - $2::text)
+			WHERE e.project_id = $1 AND e.custom_fields ? $2::text
+		`, d.dstID, f.key, f.refType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *duplicator) copyAll(ctx context.Context, worldOnly bool) error {
+	if _, err := d.tx.Exec(ctx, `
+		CREATE TEMP TABLE dup_ids (
+			kind   text NOT NULL,
+			old_id integer NOT NULL,
+			new_id integer NOT NULL,
+			PRIMARY KEY (kind, old_id)
+		) ON COMMIT DROP
+	`); err != nil {
+		return err
+	}
+	if d.freezeWorld != 0 {
+		if err := d.freezeShared(ctx); err != nil {
+			return err
+		}
+	}
+	if d.thaw {
+		if err := d.thawShared(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Chapitres d'abord : appartenances et relations y font référence
+	if !worldOnly {
+		if err := d.run(ctx, chapterSteps); err != nil {
+			return err
+		}
+	}
+	if err := d.run(ctx, entitySteps); err != nil {
+		return err
+	}
+	if err := d.run(ctx, worldSteps); err != nil {
+		return err
+	}
+	// Seuls les lieux copiés : un lieu rapproché du monde garde son parent
+	if _, err := d.tx.Exec(ctx, `
+		UPDATE locations n
+		SET parent_id = `+entityRef("location", "o.parent_id")+`
+		FROM dup_ids m
+		JOIN locations o ON o.id = m.old_id
+		WHERE m.kind = 'location' AND n.id = m.new_id AND n.project_id = $1 AND o.parent_id IS NOT NULL
+	`, d.dstID); err != nil {
+		return err
+	}
+	if err := d.links(ctx, worldLinks); err != nil {
+		return err
+	}
+	if err := d.copyImages(ctx); err != nil {
+		return err
+	}
+	if err := d.run(ctx, mapSteps); err != nil {
+		return err
+	}
+
+	if !worldOnly {
+		if err := d.run(ctx, storySteps); err != nil {
+			return err
+		}
+		if err := d.links(ctx, storyLinks); err != nil {
+			return err
+		}
+		if err := d.seedRevisions(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Surcharges des entités partagées : la copie reste dans la même série
+	// (celles des entités figées dans un instantané les suivent)
+	for _, o := range [][3]string{
+		{"character", "character_overrides", "character_id"},
+		{"location", "location_overrides", "location_id"},
+		{"faction", "faction_overrides", "faction_id"},
+	} {
+		if _, err := d.tx.Exec(ctx, `
+			INSERT INTO `+o[1]+` (project_id, `+o[2]+`, fields)
+			SELECT $2, `+entityRef(o[0], "o."+o[2])+`, o.fields FROM `+o[1]+` o WHERE o.project_id = $1
+		`, d.srcID, d.dstID); err != nil {
+			return err
+		}
+	}
+
+	return d.remapReferences(ctx)
+}
+
+// duplicateProject : POST /projects/public/{uuid}/duplicate. Renvoie le
+// nouveau projet, qui n'est jamais un modèle.
+func duplicateProject(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body duplicateInput
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "bad json", http.StatusBadRequest)
+			return
+		}
+	}
+	body.Title = strings.TrimSpace(body.Title)
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var src models.Project
+	var seriesID *int
+	err = tx.QueryRow(ctx, `
+		SELECT id, title, description, story_model_id, is_template, series_id
+		FROM projects WHERE public_id = $1 AND user_id = $2
+		FOR SHARE
+	`, pub, userID).Scan(&src.ID, &src.Title, &src.Description, &src.StoryModelID, &src.IsTemplate, &seriesID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "project not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	worldOnly := src.IsTemplate
+	if body.WorldOnly != nil {
+		worldOnly = *body.WorldOnly
+	}
+	if body.Title == "" {
+		body.Title = src.Title + " (copie)"
+	}
+
+	var p models.Project
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO projects (public_id, user_id, title, description, story_model_id, series_id, created_at)
+		VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, now())
+		RETURNING id, public_id, user_id, title, description, story_model_id, is_template, created_at
+	`, userID, body.Title, src.Description, src.StoryModelID, seriesID).
+		Scan(&p.ID, &p.PublicID, &p.UserID, &p.Title, &p.Description, &p.StoryModelID, &p.IsTemplate, &p.CreatedAt); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	d := &duplicator{tx: tx, srcID: src.ID, dstID: p.ID}
+	err = d.copyAll(ctx, worldOnly)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		// Pas de fichiers orphelins si la copie n'aboutit pas
+		for _, key := range d.written {
+			_ = storage.Default.Delete(ctx, key)
+		}
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, p)
+}
+
+type templateInput struct {
+	IsTemplate bool `json:"is_template"`
+}
+
+// setTemplate : PUT /projects/public/{uuid}/template.
+func setTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body templateInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	var p models.Project
+	err := db.Pool.QueryRow(ctx, `
+		UPDATE projects SET is_template = $3
+		WHERE public_id = $1 AND user_id = $2
+		RETURNING id, public_id, user_id, title, description, story_model_id, is_template, created_at
+	`, pub, userID, body.IsTemplate).
+		Scan(&p.ID, &p.PublicID, &p.UserID, &p.Title, &p.Description, &p.StoryModelID, &p.IsTemplate, &p.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "project not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, p)
+}
+
+// getTemplates : GET /projects/templates, les modèles de l'utilisateur.
+func getTemplates(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, err := auth.SessionUserID(ctx, r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, public_id, user_id, title, description, story_model_id, is_template, created_at
+		FROM projects
+		WHERE user_id = $1 AND is_template
+		ORDER BY lower(title) ASC`, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := []models.Project{}
+	for rows.Next() {
+		var p models.Project
+		if err := rows.Scan(&p.ID, &p.PublicID, &p.UserID, &p.Title, &p.Description,
+			&p.StoryModelID, &p.IsTemplate, &p.CreatedAt); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		list = append(list, p)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -5,7 +5,8 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -13,9 +14,22 @@ import (
 
 	"backend/db"
 	"backend/models"
+	"backend/routes/arcs"
+	"backend/routes/auth"
+	"backend/routes/codex"
+	"backend/routes/customfields"
+	"backend/routes/factions"
+	"backend/routes/plotthreads"
+	"backend/routes/relationships"
+	"backend/routes/scenes"
+	"backend/routes/series"
+	"backend/routes/setups"
+	"backend/routes/storymodels"
+	"backend/routes/tags"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
 func Routes() *chi.Mux {
@@ -31,6 +45,19 @@ func Routes() *chi.Mux {
 	r.Get("/public/{uuid}/full", getFullProjectByUUID)
 	r.Get("/user/{userID}/full", getFullProjectsByUser)
 
+	// Duplication et modèles de projet (voir duplicate.go)
+	r.Get("/templates", getTemplates)
+	r.Post("/public/{uuid}/duplicate", duplicateProject)
+	r.Put("/public/{uuid}/template", setTemplate)
+
+	// Instantanés nommés (voir snapshots.go)
+	r.Get("/public/{uuid}/snapshots", getSnapshots)
+	r.Post("/public/{uuid}/snapshots", createSnapshot)
+	r.Get("/snapshots/{uuid}", getSnapshot)
+	r.Get("/snapshots/{uuid}/diff", getSnapshotDiff)
+	r.Post("/snapshots/{uuid}/restore", restoreSnapshot)
+	r.Delete("/snapshots/{uuid}", deleteSnapshot)
+
 	return r
 }
 
@@ -66,16 +93,32 @@ func deleteProjectByUUID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 3) Delete scoping: seulement le propriétaire peut supprimer
+	// 3) Delete scoping: seulement le propriétaire peut supprimer. Le monde
+	// d'une série se supprime avec elle (DELETE /series/{uuid}). Le projet
+	// part à la corbeille (routes/trash), purgé après la rétention.
 	tag, err := db.Pool.Exec(ctx, `
-		DELETE FROM projects
-		WHERE public_id = $1 AND user_id = $2
+		UPDATE projects p SET deleted_at = now()
+		WHERE p.public_id = $1 AND p.user_id = $2
+		  AND NOT EXISTS (SELECT 1 FROM series s WHERE s.world_project_id = p.id)
 	`, pub, userID)
 	if err != nil {
 		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 	if tag.RowsAffected() == 0 {
+		var world bool
+		if err := db.Pool.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM series s JOIN projects p ON p.id = s.world_project_id
+				WHERE p.public_id = $1 AND p.user_id = $2
+			)`, pub, userID).Scan(&world); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if world {
+			http.Error(w, "project is the world of a series", http.StatusConflict)
+			return
+		}
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
@@ -176,6 +219,8 @@ func createProject(w http.ResponseWriter, r *http.Request) {
 		Title        string `json:"title"`
 		Description  string `json:"description"`
 		StoryModelID *int64 `json:"story_model_id,omitempty"`
+		// Opt-in : un chapitre par phase du modèle, dans la même transaction
+		ScaffoldChapters bool `json:"scaffold_chapters"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
@@ -185,18 +230,43 @@ func createProject(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "title requis", http.StatusBadRequest)
 		return
 	}
+	// Modèle intégré ou modèle personnel de l'utilisateur uniquement
+	if body.StoryModelID != nil {
+		ok, err := storymodels.Visible(ctx, db.Pool, int(*body.StoryModelID), userID)
+		if err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "invalid story_model_id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if body.ScaffoldChapters && body.StoryModelID == nil {
+		http.Error(w, "scaffold_chapters requires story_model_id", http.StatusBadRequest)
+		return
+	}
 
 	// 3) Insert côté DB en générant public_id
 	var p struct {
-		ID           int64     `json:"id"`
-		PublicID     uuid.UUID `json:"public_id"`
-		UserID       int64     `json:"user_id"`
-		Title        string    `json:"title"`
-		Description  string    `json:"description"`
-		StoryModelID *int64    `json:"story_model_id,omitempty"`
-		CreatedAt    time.Time `json:"created_at"`
-	}
-	err = db.Pool.QueryRow(ctx, `
+		ID           int64            `json:"id"`
+		PublicID     uuid.UUID        `json:"public_id"`
+		UserID       int64            `json:"user_id"`
+		Title        string           `json:"title"`
+		Description  string           `json:"description"`
+		StoryModelID *int64           `json:"story_model_id,omitempty"`
+		CreatedAt    time.Time        `json:"created_at"`
+		Chapters     []models.Chapter `json:"chapters,omitempty"`
+	}
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
 		INSERT INTO projects (public_id, user_id, title, description, story_model_id, created_at)
 		VALUES (gen_random_uuid(), $1, $2, COALESCE($3,''), $4, now())
 		RETURNING id, public_id, user_id, title, description, story_model_id, created_at
@@ -207,13 +277,56 @@ func createProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 3bis) Plan de départ : un chapitre par phase (titre/synopsis pré-remplis)
+	if body.ScaffoldChapters {
+		p.Chapters, err = scaffoldChapters(ctx, tx, int(p.ID), int(*body.StoryModelID))
+		if err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// 4) Réponse
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	_ = json.NewEncoder(w).Encode(p)
 }
 
+// scaffoldChapters crée un chapitre par phase du modèle, dans l'ordre des phases.
+func scaffoldChapters(ctx context.Context, tx pgx.Tx, projectID, storyModelID int) ([]models.Chapter, error) {
+	phases, err := storymodels.PhasesByModel(ctx, tx, storyModelID)
+	if err != nil {
+		return nil, err
+	}
+
+	chapters := make([]models.Chapter, 0, len(phases))
+	for i, ph := range phases {
+		var c models.Chapter
+		if err := tx.QueryRow(ctx, `
+			INSERT INTO chapters (public_id, project_id, title, synopsis, story_phase_id, order_index)
+			VALUES (gen_random_uuid(), $1, $2, $3, $4, $5)
+			RETURNING id, public_id, project_id, title, synopsis, story_phase_id, order_index`,
+			projectID, ph.Name, ph.Description, ph.ID, i+1).
+			Scan(&c.ID, &c.PublicID, &c.ProjectID, &c.Title, &c.Synopsis, &c.StoryPhaseID, &c.OrderIndex); err != nil {
+			return nil, err
+		}
+		chapters = append(chapters, c)
+	}
+	return chapters, nil
+}
+
 func updateProject(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	userID, err := auth.SessionUserID(ctx, r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	id := chi.URLParam(r, "id")
 	var p models.Project
 	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
@@ -221,13 +334,59 @@ func updateProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := db.Pool.Exec(context.Background(),
-		`UPDATE projects SET title = $1, description = $2, story_model_id = $3 WHERE id = $4`,
-		p.Title, p.Description, p.StoryModelID, id)
+	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Seul le propriétaire modifie son projet
+	var projectID int
+	err = tx.QueryRow(ctx, `
+		SELECT id FROM projects WHERE id = $1 AND user_id = $2 FOR UPDATE
+	`, id, userID).Scan(&projectID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Même règle qu'à la création : modèle intégré ou modèle du propriétaire
+	if p.StoryModelID != nil {
+		ok, err := storymodels.Visible(ctx, tx, *p.StoryModelID, userID)
+		if err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "invalid story_model_id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if _, err := tx.Exec(ctx,
+		`UPDATE projects SET title = $1, description = $2, story_model_id = $3 WHERE id = $4 AND user_id = $5`,
+		p.Title, p.Description, p.StoryModelID, projectID, userID); err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
+	// Changement de modèle : les chapitres perdent les phases de l'ancien
+	if _, err := tx.Exec(ctx, `
+		UPDATE chapters c SET story_phase_id = NULL
+		FROM story_phases ph
+		WHERE ph.id = c.story_phase_id AND c.project_id = $1
+		  AND ph.story_model_id IS DISTINCT FROM $2
+	`, projectID, p.StoryModelID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -235,82 +394,116 @@ func updateProject(w http.ResponseWriter, r *http.Request) {
 func getFullProject(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
 	projectID := chi.URLParam(r, "id")
-	fmt.Println("🔍 getFullProject ID =", projectID)
-
-	var full models.FullProject
 
 	// Chargement du projet
+	var p models.Project
 	err := db.Pool.QueryRow(ctx,
-		`SELECT id, public_id, user_id, title, description, story_model_id, created_at
+		`SELECT id, public_id, user_id, title, description, story_model_id, is_template, created_at
 		FROM projects WHERE id = $1`, projectID).
-		Scan(&full.Project.ID, &full.Project.PublicID, &full.Project.UserID,
-			&full.Project.Title, &full.Project.Description,
-			&full.Project.StoryModelID, &full.Project.CreatedAt)
+		Scan(&p.ID, &p.PublicID, &p.UserID, &p.Title, &p.Description,
+			&p.StoryModelID, &p.IsTemplate, &p.CreatedAt)
 	if err != nil {
 		http.Error(w, "Project not found", 404)
-		fmt.Println("❌ project query failed:", err)
 		return
 	}
-	fmt.Println("✅ Project loaded:", full.Project.Title)
 
-	// Characters
-	full.Characters, err = getCharactersByProjectID(ctx, projectID)
+	full, err := loadFull(ctx, db.Pool, p)
 	if err != nil {
-		http.Error(w, "Error loading characters", 500)
-		fmt.Println("❌ getCharactersByProjectID error:", err)
+		log.Printf("getFullProject %d: %v", p.ID, err)
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	fmt.Println("✅ Characters loaded:", len(full.Characters))
 
-	// Locations
-	full.Locations, err = getLocationsByProjectID(ctx, projectID)
-	if err != nil {
-		http.Error(w, "Error loading locations", 500)
-		fmt.Println("❌ getLocationsByProjectID error:", err)
-		return
+	// Encode JSON
+	if err := json.NewEncoder(w).Encode(full); err != nil {
+		log.Printf("getFullProject %d: %v", p.ID, err)
 	}
-	fmt.Println("✅ Locations loaded:", len(full.Locations))
+}
 
-	// Chapters
-	full.Chapters, err = getChaptersByProjectID(ctx, projectID)
-	if err != nil {
-		http.Error(w, "Error loading chapters", 500)
-		fmt.Println("❌ getChaptersByProjectID error:", err)
-		return
-	}
-	fmt.Println("✅ Chapters loaded:", len(full.Chapters))
+// loadFull : état complet du projet p (GET /projects/{id}/full), lu via q
+// pour qu'un instantané le lise dans sa transaction.
+func loadFull(ctx context.Context, q db.Querier, p models.Project) (models.FullProject, error) {
+	full := models.FullProject{Project: p}
+	var err error
 
-	// Scenes
-	full.Scenes, err = getScenesByProjectID(ctx, projectID)
-	if err != nil {
-		http.Error(w, "Error loading scenes", 500)
-		fmt.Println("❌ getScenesByProjectID error:", err)
-		return
+	if full.Characters, err = getCharactersByProjectID(ctx, q, p.ID); err != nil {
+		return full, err
 	}
-	fmt.Println("✅ Scenes loaded:", len(full.Scenes))
-
-	// Factions
-	full.Factions, err = getFactionsByProjectID(ctx, projectID)
-	if err != nil {
-		http.Error(w, "Error loading factions", 500)
-		fmt.Println("❌ getFactionsByProjectID error:", err)
-		return
+	if full.Locations, err = getLocationsByProjectID(ctx, q, p.ID); err != nil {
+		return full, err
 	}
-	fmt.Println("✅ Factions loaded:", len(full.Factions))
-
-	// Encode JSON
-	err = json.NewEncoder(w).Encode(full)
-	if err != nil {
-		http.Error(w, "JSON encoding failed", 500)
-		fmt.Println("❌ JSON encode error:", err)
+	if full.Chapters, err = getChaptersByProjectID(ctx, q, p.ID); err != nil {
+		return full, err
+	}
+	if full.Scenes, err = getScenesByProjectID(ctx, q, p.ID); err != nil {
+		return full, err
+	}
+	if full.Factions, err = getFactionsByProjectID(ctx, q, p.ID); err != nil {
+		return full, err
+	}
+	if full.FactionMembers, err = factions.MembersByProject(ctx, q, p.ID); err != nil {
+		return full, err
+	}
+	if full.Relationships, err = relationships.ByProject(ctx, q, p.ID); err != nil {
+		return full, err
+	}
+	if full.SceneParticipants, err = scenes.ParticipantsByProject(ctx, q, p.ID); err != nil {
+		return full, err
+	}
+	if full.StoryModel, err = getStoryModel(ctx, q, p.StoryModelID); err != nil {
+		return full, err
+	}
+	if full.CustomFields, err = customfields.ByProject(ctx, q, p.ID); err != nil {
+		return full, err
 	}
+	if full.Tags, err = tags.ByProject(ctx, q, p.ID); err != nil {
+		return full, err
+	}
+	if full.EntityTags, err = tags.EntityTagsByProject(ctx, q, p.ID); err != nil {
+		return full, err
+	}
+	if full.PlotThreads, err = plotthreads.ByProject(ctx, q, p.ID); err != nil {
+		return full, err
+	}
+	if full.ScenePlotThreads, err = plotthreads.ScenesByProject(ctx, q, p.ID); err != nil {
+		return full, err
+	}
+	if full.Setups, err = setups.ByProject(ctx, q, p.ID); err != nil {
+		return full, err
+	}
+	if full.ArcCheckpoints, err = arcs.CheckpointsByProject(ctx, q, p.ID); err != nil {
+		return full, err
+	}
+	if full.CodexTerms, err = codex.ByProject(ctx, q, p.ID); err != nil {
+		return full, err
+	}
+	// Série (les entités partagées sont fusionnées plus haut)
+	full.Series, err = series.ByProject(ctx, q, p.ID)
+	return full, err
 }
 
-func getCharactersByProjectID(ctx context.Context, projectID string) ([]models.Character, error) {
-	rows, err := db.Pool.Query(ctx, `
-		SELECT id, public_id, project_id, name, role, bio, background, personality,
-		       objective, internal_conflict, arc_type, notes, avatar_url
-		FROM characters WHERE project_id = $1`, projectID)
+// Les loaders de personnages, lieux et factions fusionnent les entités du
+// projet et celles du monde de sa série, surcharges du projet appliquées
+// (champs remplacés, custom_fields fusionnés clé par clé).
+
+func getCharactersByProjectID(ctx context.Context, q db.Querier, projectID int) ([]models.Character, error) {
+	rows, err := q.Query(ctx, `
+		SELECT c.id, c.public_id, c.project_id,
+		       COALESCE(o.fields->>'name', c.name),
+		       COALESCE(o.fields->>'role', c.role),
+		       COALESCE(o.fields->>'bio', c.bio),
+		       COALESCE(o.fields->>'background', c.background),
+		       COALESCE(o.fields->>'personality', c.personality),
+		       COALESCE(o.fields->>'objective', c.objective),
+		       COALESCE(o.fields->>'internal_conflict', c.internal_conflict),
+		       COALESCE(o.fields->>'arc_type', c.arc_type),
+		       COALESCE(o.fields->>'notes', c.notes),
+		       COALESCE(o.fields->>'avatar_url', c.avatar_url),
+		       c.custom_fields || COALESCE(o.fields->'custom_fields', '{}'),
+		       c.project_id <> $1, o.fields
+		FROM characters c
+		LEFT JOIN character_overrides o ON o.character_id = c.id AND o.project_id = $1
+		WHERE c.project_id = ANY (project_scope($1))`, projectID)
 	if err != nil {
 		return nil, err
 	}
@@ -321,7 +514,7 @@ func getCharactersByProjectID(ctx context.Context, projectID string) ([]models.C
 		var c models.Character
 		if err := rows.Scan(&c.ID, &c.PublicID, &c.ProjectID, &c.Name, &c.Role, &c.Bio,
 			&c.Background, &c.Personality, &c.Objective, &c.InternalConflict,
-			&c.ArcType, &c.Notes, &c.AvatarURL); err != nil {
+			&c.ArcType, &c.Notes, &c.AvatarURL, &c.CustomFields, &c.Shared, &c.Overrides); err != nil {
 			return nil, err
 		}
 		characters = append(characters, c)
@@ -329,10 +522,19 @@ func getCharactersByProjectID(ctx context.Context, projectID string) ([]models.C
 	return characters, nil
 }
 
-func getLocationsByProjectID(ctx context.Context, projectID string) ([]models.Location, error) {
-	rows, err := db.Pool.Query(ctx, `
-		SELECT id, public_id, project_id, name, description, map_reference, image_url
-		FROM locations WHERE project_id = $1`, projectID)
+func getLocationsByProjectID(ctx context.Context, q db.Querier, projectID int) ([]models.Location, error) {
+	rows, err := q.Query(ctx, `
+		SELECT l.id, l.public_id, l.project_id,
+		       COALESCE(o.fields->>'name', l.name),
+		       COALESCE(o.fields->>'description', l.description),
+		       COALESCE(o.fields->>'map_reference', l.map_reference),
+		       COALESCE(o.fields->>'image_url', l.image_url),
+		       (SELECT pl.public_id FROM locations_all pl WHERE pl.id = l.parent_id),
+		       l.custom_fields || COALESCE(o.fields->'custom_fields', '{}'),
+		       l.project_id <> $1, o.fields
+		FROM locations l
+		LEFT JOIN location_overrides o ON o.location_id = l.id AND o.project_id = $1
+		WHERE l.project_id = ANY (project_scope($1))`, projectID)
 	if err != nil {
 		return nil, err
 	}
@@ -342,7 +544,8 @@ func getLocationsByProjectID(ctx context.Context, projectID string) ([]models.Lo
 	for rows.Next() {
 		var l models.Location
 		if err := rows.Scan(&l.ID, &l.PublicID, &l.ProjectID, &l.Name,
-			&l.Description, &l.MapReference, &l.ImageURL); err != nil {
+			&l.Description, &l.MapReference, &l.ImageURL, &l.ParentID, &l.CustomFields,
+			&l.Shared, &l.Overrides); err != nil {
 			return nil, err
 		}
 		list = append(list, l)
@@ -350,8 +553,8 @@ func getLocationsByProjectID(ctx context.Context, projectID string) ([]models.Lo
 	return list, nil
 }
 
-func getChaptersByProjectID(ctx context.Context, projectID string) ([]models.Chapter, error) {
-	rows, err := db.Pool.Query(ctx, `
+func getChaptersByProjectID(ctx context.Context, q db.Querier, projectID int) ([]models.Chapter, error) {
+	rows, err := q.Query(ctx, `
 		SELECT id, public_id, project_id, title, synopsis, story_phase_id, order_index
 		FROM chapters WHERE project_id = $1 ORDER BY order_index ASC`, projectID)
 	if err != nil {
@@ -371,9 +574,9 @@ func getChaptersByProjectID(ctx context.Context, projectID string) ([]models.Cha
 	return list, nil
 }
 
-func getScenesByProjectID(ctx context.Context, projectID string) ([]models.Scene, error) {
-	rows, err := db.Pool.Query(ctx, `
-		SELECT s.id, s.public_id, s.chapter_uuid, s.title, s.content, s.summary, s.location_id, s.order_index
+func getScenesByProjectID(ctx context.Context, q db.Querier, projectID int) ([]models.Scene, error) {
+	rows, err := q.Query(ctx, `
+		SELECT s.id, s.public_id, s.chapter_uuid, s.title, s.content, s.summary, s.location_id, s.order_index, s.story_day
 		FROM scenes s
 		INNER JOIN chapters c ON s.chapter_id = c.id
 		WHERE c.project_id = $1 ORDER BY s.order_index ASC`, projectID)
@@ -386,7 +589,7 @@ func getScenesByProjectID(ctx context.Context, projectID string) ([]models.Scene
 	for rows.Next() {
 		var s models.Scene
 		if err := rows.Scan(&s.ID, &s.PublicID, &s.ChapterUUID, &s.Title,
-			&s.Content, &s.Summary, &s.LocationID, &s.OrderIndex); err != nil {
+			&s.Content, &s.Summary, &s.LocationID, &s.OrderIndex, &s.StoryDay); err != nil {
 			return nil, err
 		}
 		list = append(list, s)
@@ -394,10 +597,17 @@ func getScenesByProjectID(ctx context.Context, projectID string) ([]models.Scene
 	return list, nil
 }
 
-func getFactionsByProjectID(ctx context.Context, projectID string) ([]models.Faction, error) {
-	rows, err := db.Pool.Query(ctx, `
-		SELECT id, public_id, project_id, name, description, color
-		FROM factions WHERE project_id = $1`, projectID)
+func getFactionsByProjectID(ctx context.Context, q db.Querier, projectID int) ([]models.Faction, error) {
+	rows, err := q.Query(ctx, `
+		SELECT f.id, f.public_id, f.project_id,
+		       COALESCE(o.fields->>'name', f.name),
+		       COALESCE(o.fields->>'description', f.description),
+		       COALESCE(o.fields->>'color', f.color),
+		       f.custom_fields || COALESCE(o.fields->'custom_fields', '{}'),
+		       f.project_id <> $1, o.fields
+		FROM factions f
+		LEFT JOIN faction_overrides o ON o.faction_id = f.id AND o.project_id = $1
+		WHERE f.project_id = ANY (project_scope($1))`, projectID)
 	if err != nil {
 		return nil, err
 	}
@@ -407,7 +617,7 @@ func getFactionsByProjectID(ctx context.Context, projectID string) ([]models.Fac
 	for rows.Next() {
 		var f models.Faction
 		if err := rows.Scan(&f.ID, &f.PublicID, &f.ProjectID, &f.Name,
-			&f.Description, &f.Color); err != nil {
+			&f.Description, &f.Color, &f.CustomFields, &f.Shared, &f.Overrides); err != nil {
 			return nil, err
 		}
 		list = append(list, f)
@@ -415,15 +625,26 @@ func getFactionsByProjectID(ctx context.Context, projectID string) ([]models.Fac
 	return list, nil
 }
 
+// getStoryModel : modèle du projet avec ses phases ; nil si aucun modèle
+// ou si l'id ne correspond plus à rien.
+func getStoryModel(ctx context.Context, q db.Querier, storyModelID *int) (*models.StoryModel, error) {
+	if storyModelID == nil {
+		return nil, nil
+	}
+	m, err := storymodels.ByID(ctx, q, *storyModelID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return m, err
+}
+
 func getFullProjectByUUID(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
 	uuidStr := chi.URLParam(r, "uuid")
-	fmt.Println("▶️ UUID reçu :", uuidStr)
 
 	publicID, err := uuid.Parse(uuidStr)
 	if err != nil {
 		http.Error(w, "Invalid UUID", 400)
-		fmt.Println("❌ UUID parsing error:", err)
 		return
 	}
 
@@ -432,10 +653,8 @@ func getFullProjectByUUID(w http.ResponseWriter, r *http.Request) {
 		`SELECT id FROM projects WHERE public_id = $1`, publicID).Scan(&projectID)
 	if err != nil {
 		http.Error(w, "Project not found", 404)
-		fmt.Println("❌ DB lookup error:", err)
 		return
 	}
-	fmt.Println("✅ Projet trouvé, ID =", projectID)
 
 	// Appel du handler "normal"
 	rctx := chi.NewRouteContext()
@@ -448,25 +667,21 @@ func getFullProjectByUUID(w http.ResponseWriter, r *http.Request) {
 func getFullProjectsByUser(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
 	userID := chi.URLParam(r, "userID")
-	fmt.Println("🔍 Chargement projets complets pour userID:", userID)
 
 	var userDbId int
 	err := db.Pool.QueryRow(ctx,
 		`SELECT id FROM users WHERE public_id = $1`, userID).Scan(&userDbId)
 	if err != nil {
 		http.Error(w, "User not found", 404)
-		fmt.Println("❌ User not found:", err)
 		return
 	}
 
-	fmt.Println("✅ User found, DB ID =", userDbId)
-
 	rows, err := db.Pool.Query(ctx,
-		`SELECT id, public_id, user_id, title, description, story_model_id, created_at
+		`SELECT id, public_id, user_id, title, description, story_model_id, is_template, created_at
 		 FROM projects WHERE user_id = $1`, userDbId)
 	if err != nil {
+		log.Printf("getFullProjectsByUser %d: %v", userDbId, err)
 		http.Error(w, "DB error", 500)
-		fmt.Println("❌ DB error:", err)
 		return
 	}
 	defer rows.Close()
@@ -475,47 +690,17 @@ func getFullProjectsByUser(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var p models.Project
-		err := rows.Scan(&p.ID, &p.PublicID, &p.UserID, &p.Title, &p.Description, &p.StoryModelID, &p.CreatedAt)
+		err := rows.Scan(&p.ID, &p.PublicID, &p.UserID, &p.Title, &p.Description, &p.StoryModelID, &p.IsTemplate, &p.CreatedAt)
 		if err != nil {
+			log.Printf("getFullProjectsByUser %d: %v", userDbId, err)
 			http.Error(w, "Scan error", 500)
-			fmt.Println("❌ Scan project error:", err)
 			return
 		}
 
-		full := models.FullProject{Project: p}
-
-		full.Characters, err = getCharactersByProjectID(ctx, fmt.Sprint(p.ID))
+		full, err := loadFull(ctx, db.Pool, p)
 		if err != nil {
-			http.Error(w, "Characters error", 500)
-			fmt.Println("❌ getCharacters:", err)
-			return
-		}
-
-		full.Locations, err = getLocationsByProjectID(ctx, fmt.Sprint(p.ID))
-		if err != nil {
-			http.Error(w, "Locations error", 500)
-			fmt.Println("❌ getLocations:", err)
-			return
-		}
-
-		full.Chapters, err = getChaptersByProjectID(ctx, fmt.Sprint(p.ID))
-		if err != nil {
-			http.Error(w, "Chapters error", 500)
-			fmt.Println("❌ getChapters:", err)
-			return
-		}
-
-		full.Scenes, err = getScenesByProjectID(ctx, fmt.Sprint(p.ID))
-		if err != nil {
-			http.Error(w, "Scenes error", 500)
-			fmt.Println("❌ getScenes:", err)
-			return
-		}
-
-		full.Factions, err = getFactionsByProjectID(ctx, fmt.Sprint(p.ID))
-		if err != nil {
-			http.Error(w, "Factions error", 500)
-			fmt.Println("❌ getFactions:", err)
+			log.Printf("getFullProjectsByUser %d: project %d: %v", userDbId, p.ID, err)
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -523,7 +708,7 @@ func getFullProjectsByUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	fmt.Println("✅ Résultat retourné :", fullProjects)
-
-	json.NewEncoder(w).Encode(fullProjects)
+	if err := json.NewEncoder(w).Encode(fullProjects); err != nil {
+		log.Printf("getFullProjectsByUser %d: %v", userDbId, err)
+	}
 }
@@ -0,0 +1,606 @@
+package projects
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+	"backend/routes/images"
+	"backend/routes/maps"
+	"backend/routes/scenes"
+	"backend/routes/series"
+	"backend/routes/timeline"
+	"backend/storage"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Instantanés : une copie figée du projet (duplicator, cachée par la vue
+// projects) sert à la restauration, l'état ProjectState enregistré à côté
+// sert à la comparaison avec l'état courant.
+
+type snapshotInput struct {
+	Name string `json:"name"`
+}
+
+// loadState : état enregistré d'un instantané, loadFull complété des tables
+// que FullProject ne porte pas.
+func loadState(ctx context.Context, q db.Querier, p models.Project) (models.ProjectState, error) {
+	var st models.ProjectState
+	var err error
+
+	if st.FullProject, err = loadFull(ctx, q, p); err != nil {
+		return st, err
+	}
+	if st.Calendars, err = timeline.CalendarsByProject(ctx, q, p.ID); err != nil {
+		return st, err
+	}
+	if st.TimelineEvents, err = timeline.EventsByProject(ctx, q, p.ID); err != nil {
+		return st, err
+	}
+	if st.Maps, err = maps.ByProject(ctx, q, p.ID); err != nil {
+		return st, err
+	}
+	if st.MapPins, err = maps.PinsByProject(ctx, q, p.ID); err != nil {
+		return st, err
+	}
+	if st.MapRegions, err = maps.RegionsByProject(ctx, q, p.ID); err != nil {
+		return st, err
+	}
+	if st.Images, err = images.ByProject(ctx, q, p.ID); err != nil {
+		return st, err
+	}
+	if st.SceneRevisions, err = scenes.RevisionsByProject(ctx, q, p.ID); err != nil {
+		return st, err
+	}
+	st.Overrides, err = series.OverridesByProject(ctx, q, p.ID)
+	return st, err
+}
+
+const snapshotSelect = `
+	SELECT s.id, s.public_id, o.public_id, s.name, s.created_at, c.id, o.id
+	FROM project_snapshots s
+	JOIN projects_all c ON c.id = s.copy_project_id
+	JOIN projects o ON o.id = c.snapshot_of`
+
+// snapshotRef : instantané, avec sa copie figée et son projet d'origine.
+type snapshotRef struct {
+	models.ProjectSnapshot
+	CopyID    int
+	ProjectID int
+}
+
+func scanSnapshot(row pgx.Row) (snapshotRef, error) {
+	var s snapshotRef
+	err := row.Scan(&s.ID, &s.PublicID, &s.ProjectSnapshot.ProjectID, &s.Name, &s.CreatedAt, &s.CopyID, &s.ProjectID)
+	return s, err
+}
+
+// ownedSnapshot : instantané d'un projet actif du propriétaire.
+func ownedSnapshot(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (snapshotRef, error) {
+	return scanSnapshot(q.QueryRow(ctx, snapshotSelect+`
+		WHERE s.public_id = $1 AND o.user_id = $2`, pub, userID))
+}
+
+// getSnapshots : GET /projects/public/{uuid}/snapshots, plus récents d'abord.
+func getSnapshots(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+	projectID, err := auth.OwnedProjectID(ctx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "project not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.Pool.Query(ctx, snapshotSelect+`
+		WHERE o.id = $1
+		ORDER BY s.created_at DESC, s.id DESC`, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	list, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.ProjectSnapshot, error) {
+		s, err := scanSnapshot(row)
+		return s.ProjectSnapshot, err
+	})
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// createSnapshot : POST /projects/public/{uuid}/snapshots, {name}.
+func createSnapshot(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body snapshotInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		http.Error(w, "name requis", http.StatusBadRequest)
+		return
+	}
+
+	// Lecture répétable : l'état enregistré et la copie figée voient le
+	// projet au même instant, même si on l'édite pendant la copie
+	tx, err := db.Pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Verrou partagé : pas de suppression du projet pendant la copie
+	var p models.Project
+	var seriesID, worldID *int
+	err = tx.QueryRow(ctx, `
+		SELECT p.id, p.public_id, p.user_id, p.title, p.description, p.story_model_id, p.is_template,
+		       p.created_at, p.series_id, s.world_project_id
+		FROM projects p
+		LEFT JOIN series s ON s.id = p.series_id
+		WHERE p.public_id = $1 AND p.user_id = $2
+		FOR SHARE OF p
+	`, pub, userID).Scan(&p.ID, &p.PublicID, &p.UserID, &p.Title, &p.Description,
+		&p.StoryModelID, &p.IsTemplate, &p.CreatedAt, &seriesID, &worldID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "project not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	state, err := loadState(ctx, tx, p)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var copyID int
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO projects_all (public_id, user_id, title, description, story_model_id, series_id, snapshot_of, created_at)
+		VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, now())
+		RETURNING id
+	`, userID, p.Title, p.Description, p.StoryModelID, seriesID, p.ID).Scan(&copyID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	snap := models.ProjectSnapshot{ProjectID: p.PublicID, Name: body.Name}
+	d := &duplicator{tx: tx, srcID: p.ID, dstID: copyID}
+	// Livre d'une série : les entités partagées sont figées avec la copie
+	if worldID != nil {
+		d.freezeWorld = *worldID
+	}
+	err = d.copyAll(ctx, false)
+	if err == nil {
+		err = tx.QueryRow(ctx, `
+			INSERT INTO project_snapshots (copy_project_id, name, state)
+			VALUES ($1, $2, $3)
+			RETURNING id, public_id, created_at
+		`, copyID, body.Name, state).Scan(&snap.ID, &snap.PublicID, &snap.CreatedAt)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		// Pas de fichiers orphelins si la copie n'aboutit pas
+		for _, key := range d.written {
+			_ = storage.Default.Delete(ctx, key)
+		}
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, snap)
+}
+
+// snapshotState : instantané de l'URL avec son état enregistré.
+func snapshotState(ctx context.Context, w http.ResponseWriter, r *http.Request) (snapshotRef, bool) {
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return snapshotRef{}, false
+	}
+	s, err := ownedSnapshot(ctx, db.Pool, pub, userID)
+	if err == nil {
+		err = db.Pool.QueryRow(ctx, `SELECT state FROM project_snapshots WHERE id = $1`, s.ID).Scan(&s.State)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return snapshotRef{}, false
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return snapshotRef{}, false
+	}
+	return s, true
+}
+
+// getSnapshot : GET /projects/snapshots/{uuid}, état complet compris.
+func getSnapshot(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	s, ok := snapshotState(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.ProjectSnapshot)
+}
+
+// entityChange : entité ajoutée, retirée ou modifiée depuis l'instantané.
+// Type est la clé de la liste dans ProjectState (characters, maps...). Les
+// liens sans identifiant (participants, tags posés...) sont rendus tels quels
+// dans Link.
+type entityChange struct {
+	Type   string         `json:"type"`
+	ID     string         `json:"id,omitempty"`
+	Name   string         `json:"name,omitempty"`
+	Fields []string       `json:"fields,omitempty"`
+	Link   map[string]any `json:"link,omitempty"`
+}
+
+type snapshotDiff struct {
+	Snapshot      models.ProjectSnapshot `json:"snapshot"`
+	ProjectFields []string               `json:"project_fields"`
+	Added         []entityChange         `json:"added"`
+	Removed       []entityChange         `json:"removed"`
+	Changed       []entityChange         `json:"changed"`
+}
+
+// getSnapshotDiff : GET /projects/snapshots/{uuid}/diff, de l'instantané
+// vers l'état courant du projet.
+func getSnapshotDiff(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	s, ok := snapshotState(ctx, w, r)
+	if !ok {
+		return
+	}
+	var p models.Project
+	if err := db.Pool.QueryRow(ctx, `
+		SELECT id, public_id, user_id, title, description, story_model_id, is_template, created_at
+		FROM projects WHERE id = $1
+	`, s.ProjectID).Scan(&p.ID, &p.PublicID, &p.UserID, &p.Title, &p.Description,
+		&p.StoryModelID, &p.IsTemplate, &p.CreatedAt); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	current, err := loadState(ctx, db.Pool, p)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	d, err := diffFull(*s.State, current)
+	if err != nil {
+		http.Error(w, "diff error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.State = nil
+	d.Snapshot = s.ProjectSnapshot
+
+	writeJSON(w, http.StatusOK, d)
+}
+
+// diffFull compare deux états champ par champ, sur leur forme JSON : les
+// listes d'entités sont appariées par id, les autres listes comparées comme
+// des ensembles.
+func diffFull(before, after models.ProjectState) (snapshotDiff, error) {
+	d := snapshotDiff{
+		ProjectFields: []string{},
+		Added:         []entityChange{},
+		Removed:       []entityChange{},
+		Changed:       []entityChange{},
+	}
+	b, err := toJSONMap(before)
+	if err != nil {
+		return d, err
+	}
+	a, err := toJSONMap(after)
+	if err != nil {
+		return d, err
+	}
+
+	bp, _ := b["project"].(map[string]any)
+	ap, _ := a["project"].(map[string]any)
+	d.ProjectFields = changedFields(bp, ap)
+
+	keys := make([]string, 0, len(a))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		bl, bok := objects(b[key])
+		al, aok := objects(a[key])
+		if !bok || !aok {
+			continue // project, story_model, series : pas des listes
+		}
+
+		bIdx, withIDs := indexByID(bl)
+		aIdx, _ := indexByID(al)
+		if !withIDs {
+			bIdx, aIdx = indexByValue(bl), indexByValue(al)
+		}
+
+		for _, o := range al {
+			k := itemKey(o, withIDs)
+			if _, found := bIdx[k]; !found {
+				d.Added = append(d.Added, change(key, o, withIDs))
+			}
+		}
+		for _, o := range bl {
+			k := itemKey(o, withIDs)
+			now, found := aIdx[k]
+			if !found {
+				d.Removed = append(d.Removed, change(key, o, withIDs))
+				continue
+			}
+			if withIDs {
+				if fields := changedFields(o, now); len(fields) > 0 {
+					c := change(key, now, true)
+					c.Fields = fields
+					d.Changed = append(d.Changed, c)
+				}
+			}
+		}
+	}
+	return d, nil
+}
+
+func toJSONMap(v any) (map[string]any, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	err = json.Unmarshal(raw, &m)
+	return m, err
+}
+
+// objects : v comme liste d'objets (null compte pour une liste vide).
+func objects(v any) ([]map[string]any, bool) {
+	if v == nil {
+		return nil, true
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, false
+	}
+	out := make([]map[string]any, 0, len(list))
+	for _, e := range list {
+		o, ok := e.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		out = append(out, o)
+	}
+	return out, true
+}
+
+// indexByID indexe les objets par id ; false si l'un d'eux n'en a pas.
+func indexByID(list []map[string]any) (map[string]map[string]any, bool) {
+	idx := make(map[string]map[string]any, len(list))
+	for _, o := range list {
+		id, ok := o["id"].(string)
+		if !ok {
+			return nil, false
+		}
+		idx[id] = o
+	}
+	return idx, true
+}
+
+func indexByValue(list []map[string]any) map[string]map[string]any {
+	idx := make(map[string]map[string]any, len(list))
+	for _, o := range list {
+		idx[itemKey(o, false)] = o
+	}
+	return idx
+}
+
+func itemKey(o map[string]any, withIDs bool) string {
+	if withIDs {
+		id, _ := o["id"].(string)
+		return id
+	}
+	raw, _ := json.Marshal(o) // clés triées : forme canonique
+	return string(raw)
+}
+
+func change(key string, o map[string]any, withIDs bool) entityChange {
+	if !withIDs {
+		return entityChange{Type: key, Link: o}
+	}
+	c := entityChange{Type: key}
+	c.ID, _ = o["id"].(string)
+	if name, ok := o["name"].(string); ok {
+		c.Name = name
+	} else if title, ok := o["title"].(string); ok {
+		c.Name = title
+	}
+	return c
+}
+
+// changedFields : champs dont la valeur diffère, triés.
+func changedFields(before, after map[string]any) []string {
+	fields := []string{}
+	for k, v := range before {
+		if !reflect.DeepEqual(v, after[k]) {
+			fields = append(fields, k)
+		}
+	}
+	for k := range after {
+		if _, found := before[k]; !found {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+type restoreInput struct {
+	Title string `json:"title"`
+}
+
+// restoreSnapshot : POST /projects/snapshots/{uuid}/restore. Crée un nouveau
+// projet à partir de la copie figée ; le projet d'origine n'est pas touché.
+// Les entités partagées figées renvoient de nouveau au monde de la série
+// s'il les contient encore.
+func restoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body restoreInput
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "bad json", http.StatusBadRequest)
+			return
+		}
+	}
+	body.Title = strings.TrimSpace(body.Title)
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	s, err := ownedSnapshot(ctx, tx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var src models.Project
+	var seriesID *int
+	if err := tx.QueryRow(ctx, `
+		SELECT title, description, story_model_id, series_id
+		FROM projects_all WHERE id = $1
+		FOR SHARE
+	`, s.CopyID).Scan(&src.Title, &src.Description, &src.StoryModelID, &seriesID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if body.Title == "" {
+		body.Title = src.Title + " (" + s.Name + ")"
+	}
+
+	var p models.Project
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO projects (public_id, user_id, title, description, story_model_id, series_id, created_at)
+		VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, now())
+		RETURNING id, public_id, user_id, title, description, story_model_id, is_template, created_at
+	`, userID, body.Title, src.Description, src.StoryModelID, seriesID).
+		Scan(&p.ID, &p.PublicID, &p.UserID, &p.Title, &p.Description, &p.StoryModelID, &p.IsTemplate, &p.CreatedAt); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	d := &duplicator{tx: tx, srcID: s.CopyID, dstID: p.ID, thaw: true}
+	err = d.copyAll(ctx, false)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		for _, key := range d.written {
+			_ = storage.Default.Delete(ctx, key)
+		}
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, p)
+}
+
+// deleteSnapshot : DELETE /projects/snapshots/{uuid}, copie figée et images
+// comprises.
+func deleteSnapshot(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	s, err := ownedSnapshot(ctx, tx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	imgs, err := images.ByProject(ctx, tx, s.CopyID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// project_snapshots suit sa copie en cascade
+	if _, err := tx.Exec(ctx, `DELETE FROM projects_all WHERE id = $1`, s.CopyID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Fichiers supprimés après le commit : au pire un orphelin
+	for _, img := range imgs {
+		for _, key := range []string{img.StorageKey, img.ThumbKey} {
+			if err := storage.Default.Delete(ctx, key); err != nil {
+				log.Printf("deleteSnapshot: storage delete %s: %v", key, err)
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,163 @@
+package relationships
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/routes/auth"
+
+	"github.com/google/uuid"
+)
+
+// Graphe des personnages : nœuds = personnages, arêtes = relations.
+// Rendu JSON pour le front, DOT (Graphviz) ou GraphML pour les outils externes.
+
+type graphNode struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	AvatarURL string    `json:"avatar_url"`
+}
+
+type graphEdge struct {
+	ID              uuid.UUID  `json:"id"`
+	Source          uuid.UUID  `json:"source"`
+	Target          uuid.UUID  `json:"target"`
+	Type            string     `json:"type"`
+	Notes           string     `json:"notes"`
+	ChangeChapterID *uuid.UUID `json:"change_chapter_id,omitempty"`
+}
+
+type graph struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+}
+
+func loadGraph(ctx context.Context, q db.Querier, projectID int) (graph, error) {
+	g := graph{Nodes: []graphNode{}, Edges: []graphEdge{}}
+
+	rows, err := q.Query(ctx, `
+		SELECT public_id, name, role, avatar_url
+		FROM characters
+		WHERE project_id = ANY (project_scope($1))
+		ORDER BY name ASC`, projectID)
+	if err != nil {
+		return g, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n graphNode
+		if err := rows.Scan(&n.ID, &n.Name, &n.Role, &n.AvatarURL); err != nil {
+			return g, err
+		}
+		g.Nodes = append(g.Nodes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return g, err
+	}
+
+	rels, err := ByProject(ctx, q, projectID)
+	if err != nil {
+		return g, err
+	}
+	for _, rel := range rels {
+		g.Edges = append(g.Edges, graphEdge{
+			ID:              rel.PublicID,
+			Source:          rel.FromCharacterID,
+			Target:          rel.ToCharacterID,
+			Type:            rel.Type,
+			Notes:           rel.Notes,
+			ChangeChapterID: rel.ChangeChapterID,
+		})
+	}
+	return g, nil
+}
+
+func getGraph(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	g, err := loadGraph(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		writeJSON(w, http.StatusOK, g)
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="relationships.dot"`)
+		_, _ = w.Write(toDOT(g))
+	case "graphml":
+		w.Header().Set("Content-Type", "application/graphml+xml; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="relationships.graphml"`)
+		_, _ = w.Write(toGraphML(g))
+	default:
+		http.Error(w, "format must be json, dot or graphml", http.StatusBadRequest)
+	}
+}
+
+// dotQuote échappe une chaîne pour un identifiant/label DOT entre guillemets.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+func toDOT(g graph) []byte {
+	var b bytes.Buffer
+	b.WriteString("digraph relationships {\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "\t%s [label=%s];\n", dotQuote(n.ID.String()), dotQuote(n.Name))
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "\t%s -> %s [label=%s];\n",
+			dotQuote(e.Source.String()), dotQuote(e.Target.String()), dotQuote(e.Type))
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func toGraphML(g graph) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	b.WriteString(`  <key id="name" for="node" attr.name="name" attr.type="string"/>` + "\n")
+	b.WriteString(`  <key id="role" for="node" attr.name="role" attr.type="string"/>` + "\n")
+	b.WriteString(`  <key id="type" for="edge" attr.name="type" attr.type="string"/>` + "\n")
+	b.WriteString(`  <key id="notes" for="edge" attr.name="notes" attr.type="string"/>` + "\n")
+	b.WriteString(`  <graph id="relationships" edgedefault="directed">` + "\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "    <node id=\"%s\">\n", n.ID)
+		fmt.Fprintf(&b, "      <data key=\"name\">%s</data>\n", xmlEscape(n.Name))
+		fmt.Fprintf(&b, "      <data key=\"role\">%s</data>\n", xmlEscape(n.Role))
+		b.WriteString("    </node>\n")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "    <edge id=\"%s\" source=\"%s\" target=\"%s\">\n", e.ID, e.Source, e.Target)
+		fmt.Fprintf(&b, "      <data key=\"type\">%s</data>\n", xmlEscape(e.Type))
+		fmt.Fprintf(&b, "      <data key=\"notes\">%s</data>\n", xmlEscape(e.Notes))
+		b.WriteString("    </edge>\n")
+	}
+	b.WriteString("  </graph>\n</graphml>\n")
+	return b.Bytes()
+}
@@ -0,0 +1,322 @@
+package relationships
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/project/{projectUUID}", getRelationshipsByProject)
+	r.Post("/project/{projectUUID}", createRelationship)
+	r.Get("/project/{projectUUID}/graph", getGraph) // ?format=json|dot|graphml
+	r.Get("/{uuid}", getRelationship)
+	r.Put("/{uuid}", updateRelationship)
+	r.Delete("/{uuid}", deleteRelationship)
+
+	return r
+}
+
+// Types acceptés : une relation est orientée (from est le mentor de to...)
+var validTypes = map[string]bool{
+	"sibling":  true,
+	"parent":   true,
+	"child":    true,
+	"spouse":   true,
+	"lover":    true,
+	"friend":   true,
+	"ally":     true,
+	"rival":    true,
+	"enemy":    true,
+	"mentor":   true,
+	"student":  true,
+	"employer": true,
+	"employee": true,
+	"other":    true,
+}
+
+type relationshipInput struct {
+	FromCharacterID uuid.UUID  `json:"from_character_id"`
+	ToCharacterID   uuid.UUID  `json:"to_character_id"`
+	Type            string     `json:"type"`
+	Notes           string     `json:"notes"`
+	ChangeChapterID *uuid.UUID `json:"change_chapter_id,omitempty"`
+}
+
+func (in *relationshipInput) validate() error {
+	in.Type = strings.ToLower(strings.TrimSpace(in.Type))
+	if !validTypes[in.Type] {
+		return errors.New("invalid type")
+	}
+	if in.FromCharacterID == in.ToCharacterID {
+		return errors.New("a character cannot be related to itself")
+	}
+	return nil
+}
+
+var (
+	errInvalidCharacter = errors.New("invalid from_character_id or to_character_id")
+	errInvalidChapter   = errors.New("invalid change_chapter_id")
+)
+
+const relationshipSelect = `
+	SELECT rel.id, rel.public_id, fc.public_id, tc.public_id, rel.type, rel.notes, ch.public_id
+	FROM character_relationships rel
+	JOIN characters fc ON fc.id = rel.from_character_id
+	JOIN characters tc ON tc.id = rel.to_character_id
+	LEFT JOIN chapters ch ON ch.id = rel.change_chapter_id`
+
+func scanRelationship(row pgx.Row) (models.Relationship, error) {
+	var rel models.Relationship
+	err := row.Scan(&rel.ID, &rel.PublicID, &rel.FromCharacterID, &rel.ToCharacterID,
+		&rel.Type, &rel.Notes, &rel.ChangeChapterID)
+	return rel, err
+}
+
+// ByProject : relations du projet et du monde de sa série (payload /full et
+// graphe).
+func ByProject(ctx context.Context, q db.Querier, projectID int) ([]models.Relationship, error) {
+	rows, err := q.Query(ctx, relationshipSelect+`
+		WHERE rel.project_id = ANY (project_scope($1))
+		ORDER BY fc.name ASC, tc.name ASC, rel.id ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Relationship{}
+	for rows.Next() {
+		rel, err := scanRelationship(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, rel)
+	}
+	return list, rows.Err()
+}
+
+// resolve traduit les public_id du corps en ids internes du projet.
+func resolve(ctx context.Context, q db.Querier, in relationshipInput, projectID int) (from, to int, chapter *int, err error) {
+	var fromID, toID *int
+	err = q.QueryRow(ctx, `
+		SELECT
+			(SELECT id FROM characters WHERE public_id = $1 AND project_id = ANY (project_scope($3))),
+			(SELECT id FROM characters WHERE public_id = $2 AND project_id = ANY (project_scope($3)))
+	`, in.FromCharacterID, in.ToCharacterID, projectID).Scan(&fromID, &toID)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if fromID == nil || toID == nil {
+		return 0, 0, nil, errInvalidCharacter
+	}
+	from, to = *fromID, *toID
+	if in.ChangeChapterID != nil {
+		var id int
+		err = q.QueryRow(ctx, `
+			SELECT id FROM chapters WHERE public_id = $1 AND project_id = $2
+		`, *in.ChangeChapterID, projectID).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, 0, nil, errInvalidChapter
+		}
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		chapter = &id
+	}
+	return from, to, chapter, nil
+}
+
+func writeResolveError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidCharacter) || errors.Is(err, errInvalidChapter) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+}
+
+// ownedRelationship retrouve (id, project_id) d'une relation du propriétaire.
+func ownedRelationship(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (id, projectID int, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT rel.id, rel.project_id
+		FROM character_relationships rel
+		JOIN projects p ON p.id = rel.project_id
+		WHERE rel.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&id, &projectID)
+	return id, projectID, err
+}
+
+func getRelationshipsByProject(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	list, err := ByProject(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createRelationship(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body relationshipInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, to, chapter, err := resolve(ctx, db.Pool, body, projectID)
+	if err != nil {
+		writeResolveError(w, err)
+		return
+	}
+
+	var id int
+	if err := db.Pool.QueryRow(ctx, `
+		INSERT INTO character_relationships (project_id, from_character_id, to_character_id, type, notes, change_chapter_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		projectID, from, to, body.Type, body.Notes, chapter).Scan(&id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rel, err := scanRelationship(db.Pool.QueryRow(ctx, relationshipSelect+` WHERE rel.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, rel)
+}
+
+func getRelationship(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	rel, err := scanRelationship(db.Pool.QueryRow(ctx, relationshipSelect+`
+		JOIN projects p ON p.id = rel.project_id
+		WHERE rel.public_id = $1 AND p.user_id = $2`, pub, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rel)
+}
+
+func updateRelationship(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body relationshipInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, projectID, err := ownedRelationship(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	from, to, chapter, err := resolve(ctx, db.Pool, body, projectID)
+	if err != nil {
+		writeResolveError(w, err)
+		return
+	}
+
+	if _, err := db.Pool.Exec(ctx, `
+		UPDATE character_relationships
+		SET from_character_id = $2, to_character_id = $3, type = $4, notes = $5, change_chapter_id = $6
+		WHERE id = $1`,
+		id, from, to, body.Type, body.Notes, chapter); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rel, err := scanRelationship(db.Pool.QueryRow(ctx, relationshipSelect+` WHERE rel.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rel)
+}
+
+func deleteRelationship(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM character_relationships rel
+		USING projects p
+		WHERE p.id = rel.project_id AND rel.public_id = $1 AND p.user_id = $2
+	`, pub, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
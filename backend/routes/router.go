@@ -6,9 +6,27 @@ import (
 	"strings"
 	"time"
 
+	"backend/routes/analysis"
+	"backend/routes/arcs"
 	"backend/routes/auth"
+	"backend/routes/chapters"
 	"backend/routes/characters"
+	"backend/routes/codex"
+	"backend/routes/customfields"
+	"backend/routes/factions"
+	"backend/routes/images"
+	"backend/routes/locations"
+	"backend/routes/maps"
+	"backend/routes/plotthreads"
 	"backend/routes/projects"
+	"backend/routes/relationships"
+	"backend/routes/scenes"
+	"backend/routes/series"
+	"backend/routes/setups"
+	"backend/routes/storymodels"
+	"backend/routes/tags"
+	"backend/routes/timeline"
+	"backend/routes/trash"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -48,6 +66,24 @@ func Router() *chi.Mux {
 	r.Route("/api", func(api chi.Router) {
 		api.Mount("/projects", projects.Routes())
 		api.Mount("/characters", characters.Routes())
+		api.Mount("/chapters", chapters.Routes())
+		api.Mount("/scenes", scenes.Routes())
+		api.Mount("/locations", locations.Routes())
+		api.Mount("/factions", factions.Routes())
+		api.Mount("/relationships", relationships.Routes())
+		api.Mount("/custom-fields", customfields.Routes())
+		api.Mount("/tags", tags.Routes())
+		api.Mount("/plot-threads", plotthreads.Routes())
+		api.Mount("/setups", setups.Routes())
+		api.Mount("/arcs", arcs.Routes())
+		api.Mount("/codex", codex.Routes())
+		api.Mount("/series", series.Routes())
+		api.Mount("/trash", trash.Routes())
+		api.Mount("/images", images.Routes())
+		api.Mount("/maps", maps.Routes())
+		api.Mount("/story-models", storymodels.Routes())
+		api.Mount("/analysis", analysis.Routes())
+		api.Mount("/timeline", timeline.Routes())
 		api.Mount("/auth", auth.Routes())
 	})
 
@@ -0,0 +1,345 @@
+package scenes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Participants d'une scène : qui est le point de vue, qui est présent, qui
+// est seulement mentionné.
+
+var validParticipantRoles = map[string]bool{
+	"pov":       true,
+	"present":   true,
+	"mentioned": true,
+}
+
+var (
+	errInvalidParticipant = errors.New("invalid character_id")
+	errInvalidRole        = errors.New("role must be pov, present or mentioned")
+	errSeveralPOV         = errors.New("a scene has at most one pov")
+)
+
+type participantInput struct {
+	CharacterID uuid.UUID `json:"character_id"`
+	Role        string    `json:"role"`
+}
+
+// Appearance : une scène où apparaît un personnage, dans l'ordre de lecture.
+type Appearance struct {
+	SceneID      uuid.UUID `json:"scene_id"`
+	SceneTitle   string    `json:"scene_title"`
+	ChapterID    uuid.UUID `json:"chapter_id"`
+	ChapterTitle string    `json:"chapter_title"`
+	ChapterOrder int       `json:"chapter_order"`
+	SceneOrder   int       `json:"scene_order"`
+	Role         string    `json:"role"`
+}
+
+const participantSelect = `
+	SELECT s.public_id, ch.public_id, sc.role
+	FROM scene_characters sc
+	JOIN scenes s ON s.id = sc.scene_id
+	JOIN characters ch ON ch.id = sc.character_id`
+
+func listParticipants(ctx context.Context, q db.Querier, where string, arg any) ([]models.SceneParticipant, error) {
+	rows, err := q.Query(ctx, participantSelect+`
+		WHERE `+where+`
+		ORDER BY s.id ASC, CASE sc.role WHEN 'pov' THEN 0 WHEN 'present' THEN 1 ELSE 2 END, ch.name ASC`, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.SceneParticipant{}
+	for rows.Next() {
+		var p models.SceneParticipant
+		if err := rows.Scan(&p.SceneID, &p.CharacterID, &p.Role); err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// ParticipantsByProject : toutes les participations du projet (payload /full).
+func ParticipantsByProject(ctx context.Context, q db.Querier, projectID int) ([]models.SceneParticipant, error) {
+	return listParticipants(ctx, q, `s.chapter_id IN (SELECT id FROM chapters WHERE project_id = $1)`, projectID)
+}
+
+// AppearancesByCharacter : scènes où apparaît le personnage, dans l'ordre de
+// lecture (ordre des chapitres puis des scènes).
+func AppearancesByCharacter(ctx context.Context, q db.Querier, characterID int) ([]Appearance, error) {
+	rows, err := q.Query(ctx, `
+		SELECT s.public_id, s.title, c.public_id, c.title, c.order_index, s.order_index, sc.role
+		FROM scene_characters sc
+		JOIN scenes s ON s.id = sc.scene_id
+		JOIN chapters c ON c.id = s.chapter_id
+		WHERE sc.character_id = $1
+		ORDER BY c.order_index ASC, s.order_index ASC`, characterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Appearance{}
+	for rows.Next() {
+		var a Appearance
+		if err := rows.Scan(&a.SceneID, &a.SceneTitle, &a.ChapterID, &a.ChapterTitle,
+			&a.ChapterOrder, &a.SceneOrder, &a.Role); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+func getParticipants(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+	id, _, err := ownedScene(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list, err := listParticipants(ctx, db.Pool, "sc.scene_id = $1", id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// setParticipants remplace la liste complète des participants de la scène.
+func setParticipants(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body []participantInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	povs := 0
+	for i := range body {
+		body[i].Role = strings.ToLower(strings.TrimSpace(body[i].Role))
+		if !validParticipantRoles[body[i].Role] {
+			http.Error(w, errInvalidRole.Error(), http.StatusBadRequest)
+			return
+		}
+		if body[i].Role == "pov" {
+			povs++
+		}
+	}
+	if povs > 1 {
+		http.Error(w, errSeveralPOV.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	id, ch, err := ownedScene(ctx, tx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM scene_characters WHERE scene_id = $1`, id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, p := range body {
+		if err := upsertParticipant(ctx, tx, id, ch.ProjectID, p); err != nil {
+			writeParticipantError(w, err)
+			return
+		}
+	}
+
+	list, err := listParticipants(ctx, tx, "sc.scene_id = $1", id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// addParticipant ajoute un personnage (ou change son rôle s'il y est déjà).
+func addParticipant(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body participantInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	body.Role = strings.ToLower(strings.TrimSpace(body.Role))
+	if !validParticipantRoles[body.Role] {
+		http.Error(w, errInvalidRole.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, ch, err := ownedScene(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := upsertParticipant(ctx, db.Pool, id, ch.ProjectID, body); err != nil {
+		writeParticipantError(w, err)
+		return
+	}
+
+	list, err := listParticipants(ctx, db.Pool, "sc.scene_id = $1", id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func removeParticipant(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+	characterPub, err := uuid.Parse(chi.URLParam(r, "characterUUID"))
+	if err != nil {
+		http.Error(w, "invalid uuid", http.StatusBadRequest)
+		return
+	}
+
+	id, _, err := ownedScene(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM scene_characters sc
+		USING characters ch
+		WHERE ch.id = sc.character_id AND sc.scene_id = $1 AND ch.public_id = $2
+	`, id, characterPub)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// upsertParticipant : le personnage doit être du projet de la scène ou du
+// monde de sa série.
+func upsertParticipant(ctx context.Context, q db.Querier, sceneID, projectID int, p participantInput) error {
+	var characterID int
+	err := q.QueryRow(ctx, `
+		SELECT id FROM characters WHERE public_id = $1 AND project_id = ANY (project_scope($2))
+	`, p.CharacterID, projectID).Scan(&characterID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errInvalidParticipant
+	}
+	if err != nil {
+		return err
+	}
+
+	if p.Role == "pov" {
+		var other bool
+		if err := q.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM scene_characters sc
+				JOIN characters c ON c.id = sc.character_id
+				WHERE sc.scene_id = $1 AND sc.role = 'pov' AND sc.character_id <> $2
+			)`, sceneID, characterID).Scan(&other); err != nil {
+			return err
+		}
+		if other {
+			return errSeveralPOV
+		}
+		// Un point de vue à la corbeille cède sa place (il reste présent)
+		if _, err := q.Exec(ctx, `
+			UPDATE scene_characters sc SET role = 'present'
+			FROM characters_all c
+			WHERE c.id = sc.character_id AND c.deleted_at IS NOT NULL
+			  AND sc.scene_id = $1 AND sc.role = 'pov'
+		`, sceneID); err != nil {
+			return err
+		}
+	}
+
+	_, err = q.Exec(ctx, `
+		INSERT INTO scene_characters (scene_id, character_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (scene_id, character_id) DO UPDATE SET role = EXCLUDED.role
+	`, sceneID, characterID, p.Role)
+	return err
+}
+
+func writeParticipantError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidParticipant) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, errSeveralPOV) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,292 @@
+package scenes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+	"backend/textutil"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Fenêtre de regroupement des sauvegardes automatiques
+// (REVISION_COALESCE_SECONDS, 5 minutes par défaut, 0 pour la désactiver) :
+// une modification du même auteur dans la fenêtre met à jour la dernière
+// révision au lieu d'en créer une.
+const defaultCoalesceSeconds = 300
+
+func coalesceSeconds() int {
+	if v, err := strconv.Atoi(os.Getenv("REVISION_COALESCE_SECONDS")); err == nil && v >= 0 {
+		return v
+	}
+	return defaultCoalesceSeconds
+}
+
+// recordRevision enregistre content comme nouvel état de la scène. Une
+// restauration (restoredFrom non nil) crée toujours une révision.
+func recordRevision(ctx context.Context, tx pgx.Tx, sceneID int, userID int64, content string, restoredFrom *int) error {
+	words := textutil.WordCount(content)
+
+	var lastID, lastWords int
+	var coalesce bool
+	err := tx.QueryRow(ctx, `
+		SELECT id, word_count,
+		       COALESCE(user_id = $2 AND restored_from IS NULL
+		                AND updated_at > now() - make_interval(secs => $3), false)
+		FROM scene_revisions
+		WHERE scene_id = $1
+		ORDER BY id DESC
+		LIMIT 1
+		FOR UPDATE
+	`, sceneID, userID, float64(coalesceSeconds())).Scan(&lastID, &lastWords, &coalesce)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	if coalesce && restoredFrom == nil {
+		_, err = tx.Exec(ctx, `
+			UPDATE scene_revisions
+			SET content = $2, word_delta = word_delta + ($3 - word_count), word_count = $3, updated_at = now()
+			WHERE id = $1
+		`, lastID, content, words)
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO scene_revisions (scene_id, user_id, content, word_count, word_delta, restored_from)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, sceneID, userID, content, words, words-lastWords, restoredFrom)
+	return err
+}
+
+const revisionFrom = `
+	FROM scene_revisions rv
+	JOIN scenes s ON s.id = rv.scene_id
+	LEFT JOIN users u ON u.id = rv.user_id
+	LEFT JOIN scene_revisions rr ON rr.id = rv.restored_from`
+
+// revisionSelect : content est vide dans les listes (le texte ne voyage qu'à
+// la demande).
+func revisionSelect(content string) string {
+	return `
+	SELECT rv.id, rv.public_id, s.public_id, u.public_id, COALESCE(u.username, ''), ` + content + `,
+	       rv.word_count, rv.word_delta, rr.public_id, rv.created_at, rv.updated_at` + revisionFrom
+}
+
+func scanRevision(row pgx.Row) (models.SceneRevision, error) {
+	var rv models.SceneRevision
+	err := row.Scan(&rv.ID, &rv.PublicID, &rv.SceneID, &rv.AuthorID, &rv.Author, &rv.Content,
+		&rv.WordCount, &rv.WordDelta, &rv.RestoredFrom, &rv.CreatedAt, &rv.UpdatedAt)
+	return rv, err
+}
+
+// RevisionsByProject : historique de toutes les scènes du projet, sans le
+// texte.
+func RevisionsByProject(ctx context.Context, q db.Querier, projectID int) ([]models.SceneRevision, error) {
+	rows, err := q.Query(ctx, revisionSelect("''")+`
+		JOIN chapters c ON c.id = s.chapter_id
+		WHERE c.project_id = $1
+		ORDER BY s.id ASC, rv.id ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.SceneRevision, error) {
+		return scanRevision(row)
+	})
+}
+
+// sceneRevision : révision revisionUUID (paramètre d'URL) de la scène.
+func sceneRevision(ctx context.Context, q db.Querier, sceneID int, param string) (models.SceneRevision, error) {
+	pub, err := uuid.Parse(param)
+	if err != nil {
+		return models.SceneRevision{}, pgx.ErrNoRows
+	}
+	return scanRevision(q.QueryRow(ctx, revisionSelect("rv.content")+`
+		WHERE rv.public_id = $1 AND rv.scene_id = $2`, pub, sceneID))
+}
+
+// ownedSceneID : scène de l'URL ; écrit la réponse d'erreur sinon.
+func ownedSceneID(ctx context.Context, w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return 0, false
+	}
+	id, _, err := ownedScene(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return 0, false
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return 0, false
+	}
+	return id, true
+}
+
+// getRevisions : historique de la scène, plus récent d'abord, sans le texte.
+func getRevisions(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	id, ok := ownedSceneID(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := db.Pool.Query(ctx, revisionSelect("''")+`
+		WHERE rv.scene_id = $1
+		ORDER BY rv.id DESC`, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	list, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.SceneRevision, error) {
+		return scanRevision(row)
+	})
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func getRevision(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	id, ok := ownedSceneID(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	rv, err := sceneRevision(ctx, db.Pool, id, chi.URLParam(r, "revisionUUID"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "revision not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rv)
+}
+
+type revisionDiff struct {
+	From         models.SceneRevision `json:"from"`
+	To           models.SceneRevision `json:"to"`
+	WordsAdded   int                  `json:"words_added"`
+	WordsRemoved int                  `json:"words_removed"`
+	Ops          []textutil.DiffOp    `json:"ops"`
+}
+
+// getRevisionDiff : diff mot à mot entre deux révisions de la scène
+// (?from=<uuid>&to=<uuid>, dans n'importe quel ordre chronologique).
+func getRevisionDiff(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	id, ok := ownedSceneID(ctx, w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("from") == "" || q.Get("to") == "" {
+		http.Error(w, "from and to requis", http.StatusBadRequest)
+		return
+	}
+
+	var d revisionDiff
+	for _, side := range []struct {
+		param string
+		rv    *models.SceneRevision
+	}{{"from", &d.From}, {"to", &d.To}} {
+		rv, err := sceneRevision(ctx, db.Pool, id, q.Get(side.param))
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "invalid "+side.param, http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		*side.rv = rv
+	}
+
+	d.Ops = textutil.DiffWords(d.From.Content, d.To.Content)
+	for _, op := range d.Ops {
+		switch op.Op {
+		case textutil.DiffInsert:
+			d.WordsAdded += op.Words
+		case textutil.DiffDelete:
+			d.WordsRemoved += op.Words
+		}
+	}
+	d.From.Content, d.To.Content = "", ""
+
+	writeJSON(w, http.StatusOK, d)
+}
+
+// restoreRevision remet le texte d'une ancienne révision dans la scène, en
+// créant une nouvelle révision : l'historique n'est jamais réécrit.
+func restoreRevision(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	id, _, err := ownedScene(ctx, tx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rv, err := sceneRevision(ctx, tx, id, chi.URLParam(r, "revisionUUID"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "revision not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE scenes SET content = $2 WHERE id = $1`, id, rv.Content); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := recordRevision(ctx, tx, id, userID, rv.Content, &rv.ID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s, err := sceneByID(ctx, tx, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s)
+}
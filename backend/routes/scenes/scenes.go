@@ -0,0 +1,526 @@
+package scenes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/chapter/{chapterUUID}", getScenesByChapter)
+	r.Post("/chapter/{chapterUUID}", createScene)
+	r.Get("/{uuid}", getScene)
+	r.Put("/{uuid}", updateScene)
+	r.Delete("/{uuid}", deleteScene)
+	r.Post("/{uuid}/move", moveScene)
+
+	// Historique du texte (voir revisions.go)
+	r.Get("/{uuid}/revisions", getRevisions)
+	r.Get("/{uuid}/revisions/diff", getRevisionDiff)
+	r.Get("/{uuid}/revisions/{revisionUUID}", getRevision)
+	r.Post("/{uuid}/revisions/{revisionUUID}/restore", restoreRevision)
+
+	// Participants (voir participants.go)
+	r.Get("/{uuid}/participants", getParticipants)
+	r.Put("/{uuid}/participants", setParticipants)
+	r.Post("/{uuid}/participants", addParticipant)
+	r.Delete("/{uuid}/participants/{characterUUID}", removeParticipant)
+
+	return r
+}
+
+type sceneInput struct {
+	Title      string `json:"title"`
+	Content    string `json:"content"`
+	Summary    string `json:"summary"`
+	LocationID *int   `json:"location_id,omitempty"`
+}
+
+func (in *sceneInput) validate() error {
+	in.Title = strings.TrimSpace(in.Title)
+	if in.Title == "" {
+		return errors.New("title requis")
+	}
+	return nil
+}
+
+const sceneColumns = `s.id, s.public_id, s.chapter_uuid, c.public_id::text, s.title, s.content,
+	s.summary, s.location_id, s.order_index, s.story_day`
+
+func scanScene(row pgx.Row) (models.Scene, error) {
+	var s models.Scene
+	err := row.Scan(&s.ID, &s.PublicID, &s.ChapterUUID, &s.ChapterPublicID, &s.Title,
+		&s.Content, &s.Summary, &s.LocationID, &s.OrderIndex, &s.StoryDay)
+	return s, err
+}
+
+type chapterRef struct {
+	ID        int
+	PublicID  uuid.UUID
+	ProjectID int
+}
+
+// ownedChapter retrouve un chapitre par public_id, si son projet appartient à userID.
+func ownedChapter(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (chapterRef, error) {
+	var c chapterRef
+	err := q.QueryRow(ctx, `
+		SELECT c.id, c.public_id, c.project_id
+		FROM chapters c
+		JOIN projects p ON p.id = c.project_id
+		WHERE c.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&c.ID, &c.PublicID, &c.ProjectID)
+	return c, err
+}
+
+// ownedScene retrouve (id, chapitre) d'une scène du propriétaire.
+func ownedScene(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (int, chapterRef, error) {
+	var id int
+	var c chapterRef
+	err := q.QueryRow(ctx, `
+		SELECT s.id, c.id, c.public_id, c.project_id
+		FROM scenes s
+		JOIN chapters c ON c.id = s.chapter_id
+		JOIN projects p ON p.id = c.project_id
+		WHERE s.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&id, &c.ID, &c.PublicID, &c.ProjectID)
+	return id, c, err
+}
+
+// checkLocation vérifie que location_id appartient bien au même projet.
+func checkLocation(ctx context.Context, q db.Querier, locationID *int, projectID int) error {
+	if locationID == nil {
+		return nil
+	}
+	var ok bool
+	if err := q.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM locations WHERE id = $1 AND project_id = ANY (project_scope($2)))
+	`, *locationID, projectID).Scan(&ok); err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidLocation
+	}
+	return nil
+}
+
+var errInvalidLocation = errors.New("invalid location_id")
+
+func listScenes(ctx context.Context, q db.Querier, chapterID int) ([]models.Scene, error) {
+	rows, err := q.Query(ctx, `
+		SELECT `+sceneColumns+`
+		FROM scenes s
+		JOIN chapters c ON c.id = s.chapter_id
+		WHERE s.chapter_id = $1
+		ORDER BY s.order_index ASC, s.id ASC`, chapterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Scene{}
+	for rows.Next() {
+		s, err := scanScene(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+func sceneIDs(list []models.Scene) []int {
+	ids := make([]int, len(list))
+	for i, s := range list {
+		ids[i] = s.ID
+	}
+	return ids
+}
+
+// renumber referme les trous d'order_index dans un chapitre.
+func renumber(ctx context.Context, tx pgx.Tx, chapterID int) error {
+	list, err := listScenes(ctx, tx, chapterID)
+	if err != nil {
+		return err
+	}
+	return db.RewriteOrder(ctx, tx, "scenes", sceneIDs(list))
+}
+
+func getScenesByChapter(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, err := auth.SessionUserID(ctx, r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	pub, err := uuid.Parse(chi.URLParam(r, "chapterUUID"))
+	if err != nil {
+		http.Error(w, "invalid uuid", http.StatusBadRequest)
+		return
+	}
+	ch, err := ownedChapter(ctx, db.Pool, pub, userID)
+	if err != nil {
+		http.Error(w, "chapter not found", http.StatusNotFound)
+		return
+	}
+
+	list, err := listScenes(ctx, db.Pool, ch.ID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createScene(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, err := auth.SessionUserID(ctx, r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	pub, err := uuid.Parse(chi.URLParam(r, "chapterUUID"))
+	if err != nil {
+		http.Error(w, "invalid uuid", http.StatusBadRequest)
+		return
+	}
+
+	var body sceneInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	ch, err := ownedChapter(ctx, tx, pub, userID)
+	if err != nil {
+		http.Error(w, "chapter not found", http.StatusNotFound)
+		return
+	}
+	if err := checkLocation(ctx, tx, body.LocationID, ch.ProjectID); err != nil {
+		if errors.Is(err, errInvalidLocation) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if err := db.LockProject(ctx, tx, ch.ProjectID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var id int
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO scenes (public_id, chapter_id, chapter_uuid, title, content, summary, location_id, order_index)
+		VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6,
+		        (SELECT COALESCE(MAX(order_index), 0) + 1 FROM scenes WHERE chapter_id = $1))
+		RETURNING id`,
+		ch.ID, ch.PublicID, body.Title, body.Content, body.Summary, body.LocationID).Scan(&id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if body.Content != "" {
+		if err := recordRevision(ctx, tx, id, userID, body.Content, nil); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	s, err := sceneByID(ctx, tx, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, s)
+}
+
+func sceneByID(ctx context.Context, q db.Querier, id int) (models.Scene, error) {
+	return scanScene(q.QueryRow(ctx, `
+		SELECT `+sceneColumns+`
+		FROM scenes s
+		JOIN chapters c ON c.id = s.chapter_id
+		WHERE s.id = $1`, id))
+}
+
+func getScene(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	s, err := scanScene(db.Pool.QueryRow(ctx, `
+		SELECT `+sceneColumns+`
+		FROM scenes s
+		JOIN chapters c ON c.id = s.chapter_id
+		JOIN projects p ON p.id = c.project_id
+		WHERE s.public_id = $1 AND p.user_id = $2`, pub, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s)
+}
+
+func updateScene(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body sceneInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	id, ch, err := ownedScene(ctx, tx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := checkLocation(ctx, tx, body.LocationID, ch.ProjectID); err != nil {
+		if errors.Is(err, errInvalidLocation) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Verrou sur la scène : deux sauvegardes simultanées ne se disputent pas
+	// la même révision
+	var previous string
+	if err := tx.QueryRow(ctx, `SELECT content FROM scenes WHERE id = $1 FOR UPDATE`, id).Scan(&previous); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// chapter_id / order_index ne bougent que via /move
+	if _, err := tx.Exec(ctx, `
+		UPDATE scenes
+		SET title = $2, content = $3, summary = $4, location_id = $5
+		WHERE id = $1`,
+		id, body.Title, body.Content, body.Summary, body.LocationID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if body.Content != previous {
+		if err := recordRevision(ctx, tx, id, userID, body.Content, nil); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	s, err := sceneByID(ctx, tx, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s)
+}
+
+func deleteScene(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	id, ch, err := ownedScene(ctx, tx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := db.LockProject(ctx, tx, ch.ProjectID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Mise à la corbeille, hors de la numérotation du chapitre
+	if _, err := tx.Exec(ctx, `UPDATE scenes SET deleted_at = now(), order_index = -id WHERE id = $1`, id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := renumber(ctx, tx, ch.ID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// moveScene déplace une scène à la position N (1-based), éventuellement dans
+// un autre chapitre du même projet. chapter_id et chapter_uuid sont mis à jour
+// ensemble et les deux chapitres sont renumérotés dans la même transaction.
+func moveScene(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		ChapterID *uuid.UUID `json:"chapter_id,omitempty"` // public_id du chapitre cible
+		Position  int        `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if body.Position < 1 {
+		http.Error(w, "position must be >= 1", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	id, from, err := ownedScene(ctx, tx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	to := from
+	if body.ChapterID != nil && *body.ChapterID != from.PublicID {
+		to, err = ownedChapter(ctx, tx, *body.ChapterID, userID)
+		if err != nil || to.ProjectID != from.ProjectID {
+			http.Error(w, "target chapter not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	if err := db.LockProject(ctx, tx, from.ProjectID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if to.ID != from.ID {
+		if _, err := tx.Exec(ctx, `
+			UPDATE scenes SET chapter_id = $2, chapter_uuid = $3 WHERE id = $1
+		`, id, to.ID, to.PublicID); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := renumber(ctx, tx, from.ID); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	list, err := listScenes(ctx, tx, to.ID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ids := db.MoveID(sceneIDs(list), id, body.Position)
+	if err := db.RewriteOrder(ctx, tx, "scenes", ids); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s, err := sceneByID(ctx, tx, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
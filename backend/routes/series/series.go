@@ -0,0 +1,646 @@
+package series
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+	"backend/routes/images"
+	"backend/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Séries : des livres (projets) partageant un monde. Les personnages, lieux
+// et factions partagés appartiennent au projet "monde" de la série, créé
+// avec elle et modifiable avec les routes habituelles ; chaque livre les voit
+// en plus des siens (project_scope) et peut en surcharger des champs
+// (voir shared.go).
+
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/", getSeriesList)
+	r.Post("/", createSeries)
+	r.Get("/{uuid}", getSeries)
+	r.Put("/{uuid}", updateSeries)
+	r.Delete("/{uuid}", deleteSeries)
+
+	// Livres de la série
+	r.Post("/{uuid}/projects", addProject)
+	r.Delete("/{uuid}/projects/{projectUUID}", removeProject)
+	// Entité d'un livre versée dans le monde de la série
+	r.Post("/{uuid}/share", shareEntity)
+
+	// Surcharges par livre (voir shared.go)
+	r.Get("/project/{projectUUID}/overrides", getOverrides)
+	r.Put("/project/{projectUUID}/overrides/{entityType}/{entityUUID}", putOverride)
+	r.Delete("/project/{projectUUID}/overrides/{entityType}/{entityUUID}", deleteOverride)
+
+	return r
+}
+
+type seriesInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func (in *seriesInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		return errors.New("name requis")
+	}
+	return nil
+}
+
+var (
+	errWorldProject   = errors.New("project is the world of a series")
+	errInOtherSeries  = errors.New("project already belongs to a series")
+	errNotInSeries    = errors.New("project does not belong to this series")
+	errSharedInUse    = errors.New("project still uses shared entities")
+	errInvalidEntity  = errors.New("invalid entity_type")
+	errAlreadyShared  = errors.New("entity is already shared")
+	errParentNotShare = errors.New("parent location must be shared first")
+)
+
+func writeSeriesError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, errInvalidEntity), errors.Is(err, errNotInSeries):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errWorldProject), errors.Is(err, errInOtherSeries),
+		errors.Is(err, errSharedInUse), errors.Is(err, errAlreadyShared),
+		errors.Is(err, errParentNotShare):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+const seriesSelect = `
+	SELECT s.id, s.public_id, s.user_id, s.name, s.description, wp.public_id, s.created_at
+	FROM series s
+	JOIN projects wp ON wp.id = s.world_project_id`
+
+func scanSeries(row pgx.Row) (models.Series, error) {
+	var s models.Series
+	err := row.Scan(&s.ID, &s.PublicID, &s.UserID, &s.Name, &s.Description, &s.WorldProjectID, &s.CreatedAt)
+	return s, err
+}
+
+// withProjects complète s avec ses livres, du plus ancien au plus récent.
+func withProjects(ctx context.Context, q db.Querier, s models.Series) (models.Series, error) {
+	rows, err := q.Query(ctx, `
+		SELECT public_id FROM projects
+		WHERE series_id = $1
+		ORDER BY created_at ASC, id ASC`, s.ID)
+	if err != nil {
+		return s, err
+	}
+	s.Projects, err = pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	return s, err
+}
+
+// ByProject : série d'un livre ou de son monde (payload /full) ; nil si le
+// projet n'en fait pas partie.
+func ByProject(ctx context.Context, q db.Querier, projectID int) (*models.Series, error) {
+	s, err := scanSeries(q.QueryRow(ctx, seriesSelect+`
+		WHERE s.world_project_id = $1
+		   OR s.id = (SELECT series_id FROM projects WHERE id = $1)`, projectID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s, err = withProjects(ctx, q, s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// IsWorld : le projet est-il le monde d'une série ?
+func IsWorld(ctx context.Context, q db.Querier, projectID int) (bool, error) {
+	var ok bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM series WHERE world_project_id = $1)
+	`, projectID).Scan(&ok)
+	return ok, err
+}
+
+// ownedSeries retrouve (id, world_project_id) d'une série du propriétaire.
+func ownedSeries(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (id, worldID int, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT id, world_project_id FROM series
+		WHERE public_id = $1 AND user_id = $2
+	`, pub, userID).Scan(&id, &worldID)
+	return id, worldID, err
+}
+
+func getSeriesList(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, err := auth.SessionUserID(ctx, r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := db.Pool.Query(ctx, seriesSelect+`
+		WHERE s.user_id = $1
+		ORDER BY lower(s.name) ASC`, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	list, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Series, error) {
+		return scanSeries(row)
+	})
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range list {
+		if list[i], err = withProjects(ctx, db.Pool, list[i]); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// createSeries crée la série et son projet monde (même nom).
+func createSeries(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, err := auth.SessionUserID(ctx, r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body seriesInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var worldID int
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO projects (public_id, user_id, title, description, created_at)
+		VALUES (gen_random_uuid(), $1, $2, $3, now())
+		RETURNING id
+	`, userID, body.Name, body.Description).Scan(&worldID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var id int
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO series (user_id, name, description, world_project_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, userID, body.Name, body.Description, worldID).Scan(&id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s, err := scanSeries(tx.QueryRow(ctx, seriesSelect+` WHERE s.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.Projects = []uuid.UUID{}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, s)
+}
+
+func getSeries(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	s, err := scanSeries(db.Pool.QueryRow(ctx, seriesSelect+`
+		WHERE s.public_id = $1 AND s.user_id = $2`, pub, userID))
+	if err == nil {
+		s, err = withProjects(ctx, db.Pool, s)
+	}
+	if err != nil {
+		writeSeriesError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s)
+}
+
+func updateSeries(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body seriesInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var id int
+	err := db.Pool.QueryRow(ctx, `
+		UPDATE series SET name = $3, description = $4
+		WHERE public_id = $1 AND user_id = $2
+		RETURNING id
+	`, pub, userID, body.Name, body.Description).Scan(&id)
+	if err != nil {
+		writeSeriesError(w, err)
+		return
+	}
+
+	s, err := scanSeries(db.Pool.QueryRow(ctx, seriesSelect+` WHERE s.id = $1`, id))
+	if err == nil {
+		s, err = withProjects(ctx, db.Pool, s)
+	}
+	if err != nil {
+		writeSeriesError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s)
+}
+
+// ReleaseShared détache des livres les entités du monde worldID avant sa
+// suppression : les scènes et sous-lieux des livres qui y renvoient perdent
+// ce lien (comme à la suppression d'un lieu), corbeille comprise ; le reste
+// suit les cascades.
+func ReleaseShared(ctx context.Context, tx pgx.Tx, worldID int) error {
+	if _, err := tx.Exec(ctx, `
+		UPDATE scenes_all SET location_id = NULL
+		WHERE location_id IN (SELECT id FROM locations_all WHERE project_id = $1)
+	`, worldID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+		UPDATE locations_all SET parent_id = NULL
+		WHERE project_id <> $1
+		  AND parent_id IN (SELECT id FROM locations_all WHERE project_id = $1)
+	`, worldID)
+	return err
+}
+
+// deleteSeries supprime la série et son monde ; les livres sont conservés,
+// sans les entités partagées. Les fichiers des images du monde (et des
+// copies figées de ses instantanés, supprimées en cascade) partent après le
+// commit, comme à la purge de la corbeille.
+func deleteSeries(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	_, worldID, err := ownedSeries(ctx, tx, pub, userID)
+	if err != nil {
+		writeSeriesError(w, err)
+		return
+	}
+	if err := db.LockProject(ctx, tx, worldID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := ReleaseShared(ctx, tx, worldID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	keys, err := worldImageKeys(ctx, tx, worldID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// La série suit son monde (ON DELETE CASCADE)
+	if _, err := tx.Exec(ctx, `DELETE FROM projects WHERE id = $1`, worldID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Au pire un fichier orphelin, jamais une ligne qui pointe vers un
+	// fichier absent
+	for _, key := range keys {
+		if err := storage.Default.Delete(ctx, key); err != nil {
+			log.Printf("deleteSeries: storage delete %s: %v", key, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// worldImageKeys : fichiers des images du monde et des copies figées de ses
+// instantanés.
+func worldImageKeys(ctx context.Context, tx pgx.Tx, worldID int) ([]string, error) {
+	rows, err := tx.Query(ctx, `SELECT id FROM projects_all WHERE snapshot_of = $1`, worldID)
+	if err != nil {
+		return nil, err
+	}
+	copies, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, id := range append(copies, worldID) {
+		list, err := images.ByProject(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, img := range list {
+			keys = append(keys, img.StorageKey, img.ThumbKey)
+		}
+	}
+	return keys, nil
+}
+
+type projectInput struct {
+	ProjectID uuid.UUID `json:"project_id"`
+}
+
+// addProject rattache un livre du propriétaire à la série.
+func addProject(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body projectInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	seriesID, _, err := ownedSeries(ctx, tx, pub, userID)
+	if err != nil {
+		writeSeriesError(w, err)
+		return
+	}
+
+	var projectID int
+	var current *int
+	err = tx.QueryRow(ctx, `
+		SELECT id, series_id FROM projects
+		WHERE public_id = $1 AND user_id = $2
+		FOR UPDATE
+	`, body.ProjectID, userID).Scan(&projectID, &current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "invalid project_id", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	world, err := IsWorld(ctx, tx, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if world {
+		writeSeriesError(w, errWorldProject)
+		return
+	}
+	if current != nil && *current != seriesID {
+		writeSeriesError(w, errInOtherSeries)
+		return
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE projects SET series_id = $2 WHERE id = $1`, projectID, seriesID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s, err := scanSeries(tx.QueryRow(ctx, seriesSelect+` WHERE s.id = $1`, seriesID))
+	if err == nil {
+		s, err = withProjects(ctx, tx, s)
+	}
+	if err != nil {
+		writeSeriesError(w, err)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s)
+}
+
+// sharedInUse : le livre $1 renvoie-t-il encore à des entités du monde $2
+// (ou le monde à des personnages du livre) ? Les cartes de lieux et les
+// valeurs des champs « reference » du livre comptent aussi.
+const sharedInUse = `
+	SELECT EXISTS (
+		SELECT 1 FROM scenes s
+		JOIN chapters c ON c.id = s.chapter_id
+		JOIN locations l ON l.id = s.location_id
+		WHERE c.project_id = $1 AND l.project_id = $2
+		UNION ALL
+		SELECT 1 FROM scene_characters sc
+		JOIN scenes s ON s.id = sc.scene_id
+		JOIN chapters c ON c.id = s.chapter_id
+		JOIN characters ch ON ch.id = sc.character_id
+		WHERE c.project_id = $1 AND ch.project_id = $2
+		UNION ALL
+		SELECT 1 FROM locations l
+		JOIN locations pl ON pl.id = l.parent_id
+		WHERE l.project_id = $1 AND pl.project_id = $2
+		UNION ALL
+		SELECT 1 FROM faction_members m
+		JOIN factions f ON f.id = m.faction_id
+		JOIN characters ch ON ch.id = m.character_id
+		WHERE (f.project_id = $1 AND ch.project_id = $2) OR (f.project_id = $2 AND ch.project_id = $1)
+		UNION ALL
+		SELECT 1 FROM character_relationships rel
+		JOIN characters ch ON ch.id IN (rel.from_character_id, rel.to_character_id)
+		WHERE rel.project_id = $1 AND ch.project_id = $2
+		UNION ALL
+		SELECT 1 FROM character_arc_checkpoints a
+		JOIN chapters c ON c.id = a.chapter_id
+		JOIN characters ch ON ch.id = a.character_id
+		WHERE c.project_id = $1 AND ch.project_id = $2
+		UNION ALL
+		SELECT 1 FROM map_pins pin
+		JOIN maps m ON m.id = pin.map_id
+		JOIN locations l ON l.id = pin.location_id
+		WHERE m.project_id = $1 AND l.project_id = $2
+		UNION ALL
+		SELECT 1 FROM map_regions rg
+		JOIN maps m ON m.id = rg.map_id
+		JOIN factions f ON f.id = rg.faction_id
+		WHERE m.project_id = $1 AND f.project_id = $2
+		UNION ALL
+		SELECT 1 FROM maps m
+		JOIN locations l ON l.id = m.location_id
+		WHERE m.project_id = $1 AND l.project_id = $2
+		UNION ALL
+		SELECT 1 FROM custom_field_definitions d
+		JOIN (
+			SELECT 'character' AS entity_type, custom_fields FROM characters WHERE project_id = $1
+			UNION ALL
+			SELECT 'location', custom_fields FROM locations WHERE project_id = $1
+			UNION ALL
+			SELECT 'faction', custom_fields FROM factions WHERE project_id = $1
+		) v ON v.entity_type = d.entity_type
+		JOIN (
+			SELECT 'character' AS ref_type, public_id FROM characters WHERE project_id = $2
+			UNION ALL
+			SELECT 'location', public_id FROM locations WHERE project_id = $2
+			UNION ALL
+			SELECT 'faction', public_id FROM factions WHERE project_id = $2
+		) x ON x.ref_type = d.ref_type AND x.public_id::text = v.custom_fields->>d.key
+		WHERE d.project_id = $1 AND d.field_type = 'reference'
+	)`
+
+// removeProject détache un livre de la série. Refusé tant que le livre
+// renvoie à des entités partagées ; ses surcharges et les tags du livre posés
+// sur des entités partagées sont retirés.
+func removeProject(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+	projectPub, err := uuid.Parse(chi.URLParam(r, "projectUUID"))
+	if err != nil {
+		http.Error(w, "invalid project uuid", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	seriesID, worldID, err := ownedSeries(ctx, tx, pub, userID)
+	if err != nil {
+		writeSeriesError(w, err)
+		return
+	}
+
+	var projectID int
+	err = tx.QueryRow(ctx, `
+		SELECT id FROM projects
+		WHERE public_id = $1 AND user_id = $2 AND series_id = $3
+	`, projectPub, userID, seriesID).Scan(&projectID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeSeriesError(w, errNotInSeries)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := db.LockProject(ctx, tx, projectID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var inUse bool
+	if err := tx.QueryRow(ctx, sharedInUse, projectID, worldID).Scan(&inUse); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if inUse {
+		writeSeriesError(w, errSharedInUse)
+		return
+	}
+
+	for _, e := range sharedTypes {
+		if _, err := tx.Exec(ctx, `DELETE FROM `+e.overrides+` WHERE project_id = $1`, projectID); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if _, err := tx.Exec(ctx, `
+			DELETE FROM `+e.tags+` x USING tags t, `+e.table+` e
+			WHERE t.id = x.tag_id AND e.id = x.`+e.column+`
+			  AND t.project_id = $1 AND e.project_id = $2
+		`, projectID, worldID); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if _, err := tx.Exec(ctx, `UPDATE projects SET series_id = NULL WHERE id = $1`, projectID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,392 @@
+package series
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+	"backend/routes/characters"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// sharedType : entités partageables, avec leur table de surcharges, leur
+// table de tags et les champs texte qu'un livre peut surcharger (en plus de
+// custom_fields).
+type sharedType struct {
+	table     string
+	column    string
+	overrides string
+	tags      string
+	fields    map[string]bool
+}
+
+var sharedTypes = map[string]sharedType{
+	"character": {"characters", "character_id", "character_overrides", "character_tags", map[string]bool{
+		"name": true, "role": true, "bio": true, "background": true, "personality": true,
+		"objective": true, "internal_conflict": true, "arc_type": true, "notes": true, "avatar_url": true,
+	}},
+	"location": {"locations", "location_id", "location_overrides", "location_tags", map[string]bool{
+		"name": true, "description": true, "map_reference": true, "image_url": true,
+	}},
+	"faction": {"factions", "faction_id", "faction_overrides", "faction_tags", map[string]bool{
+		"name": true, "description": true, "color": true,
+	}},
+}
+
+type shareInput struct {
+	EntityType string    `json:"entity_type"`
+	EntityID   uuid.UUID `json:"entity_id"`
+}
+
+// shareEntity verse une entité d'un livre dans le monde de la série : les
+// liens du livre vers elle sont conservés, les autres livres la voient. Ses
+// tags et champs personnalisés propres au livre sont déplacés (moveBookLinks).
+func shareEntity(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body shareInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	e, ok := sharedTypes[strings.ToLower(strings.TrimSpace(body.EntityType))]
+	if !ok {
+		writeSeriesError(w, errInvalidEntity)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	seriesID, worldID, err := ownedSeries(ctx, tx, pub, userID)
+	if err != nil {
+		writeSeriesError(w, err)
+		return
+	}
+
+	var id, projectID int
+	var projectSeries *int
+	err = tx.QueryRow(ctx, `
+		SELECT e.id, e.project_id, p.series_id
+		FROM `+e.table+` e
+		JOIN projects p ON p.id = e.project_id
+		WHERE e.public_id = $1 AND p.user_id = $2
+		FOR UPDATE OF e
+	`, body.EntityID, userID).Scan(&id, &projectID, &projectSeries)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "invalid entity_id", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if projectID == worldID {
+		writeSeriesError(w, errAlreadyShared)
+		return
+	}
+	if projectSeries == nil || *projectSeries != seriesID {
+		writeSeriesError(w, errNotInSeries)
+		return
+	}
+
+	// Un lieu partagé ne peut pas dépendre d'un lieu propre à un livre
+	if e.table == "locations" {
+		var localParent bool
+		if err := tx.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM locations l
+				JOIN locations pl ON pl.id = l.parent_id
+				WHERE l.id = $1 AND pl.project_id <> $2
+			)`, id, worldID).Scan(&localParent); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if localParent {
+			writeSeriesError(w, errParentNotShare)
+			return
+		}
+	}
+
+	if err := moveBookLinks(ctx, tx, e, id, projectID, worldID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(ctx, `UPDATE `+e.table+` SET project_id = $2 WHERE id = $1`, id, worldID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// moveBookLinks retire de l'entité ce qui n'a de sens que dans le livre
+// avant son passage au monde : ses tags passent sur les tags du monde de même
+// nom (créés au besoin) et ses valeurs de champs personnalisés, définies par
+// le livre, deviennent des surcharges du livre.
+func moveBookLinks(ctx context.Context, tx pgx.Tx, e sharedType, id, bookID, worldID int) error {
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO tags (project_id, name, color)
+		SELECT $3, t.name, t.color
+		FROM `+e.tags+` x
+		JOIN tags t ON t.id = x.tag_id
+		WHERE x.`+e.column+` = $1 AND t.project_id = $2
+		ON CONFLICT (project_id, lower(name)) DO NOTHING
+	`, id, bookID, worldID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO `+e.tags+` (tag_id, `+e.column+`)
+		SELECT wt.id, x.`+e.column+`
+		FROM `+e.tags+` x
+		JOIN tags t ON t.id = x.tag_id
+		JOIN tags wt ON wt.project_id = $3 AND lower(wt.name) = lower(t.name)
+		WHERE x.`+e.column+` = $1 AND t.project_id = $2
+		ON CONFLICT DO NOTHING
+	`, id, bookID, worldID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM `+e.tags+` x
+		USING tags t
+		WHERE t.id = x.tag_id AND x.`+e.column+` = $1 AND t.project_id = $2
+	`, id, bookID); err != nil {
+		return err
+	}
+
+	// Les surcharges déjà posées par le livre gardent la main
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO `+e.overrides+` (project_id, `+e.column+`, fields)
+		SELECT $2, e.id, jsonb_build_object('custom_fields', e.custom_fields)
+		FROM `+e.table+` e
+		WHERE e.id = $1 AND e.custom_fields <> '{}'::jsonb
+		ON CONFLICT (project_id, `+e.column+`) DO UPDATE
+		SET fields = jsonb_set(
+			`+e.overrides+`.fields, '{custom_fields}',
+			EXCLUDED.fields->'custom_fields' || COALESCE(`+e.overrides+`.fields->'custom_fields', '{}'::jsonb))
+	`, id, bookID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `UPDATE `+e.table+` SET custom_fields = '{}'::jsonb WHERE id = $1`, id)
+	return err
+}
+
+// cleanOverride contrôle les champs surchargés : champs texte connus du type
+// (name non vide, role / arc_type valides) et custom_fields objet, fusionné
+// clé par clé avec celui de l'entité.
+func cleanOverride(entityType string, in map[string]any) (map[string]any, error) {
+	e := sharedTypes[entityType]
+	out := make(map[string]any, len(in))
+	for key, v := range in {
+		if key == "custom_fields" {
+			cf, ok := v.(map[string]any)
+			if !ok {
+				return nil, errors.New("custom_fields must be an object")
+			}
+			out[key] = cf
+			continue
+		}
+		if !e.fields[key] {
+			return nil, fmt.Errorf("unknown field %q", key)
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a string", key)
+		}
+		s = strings.TrimSpace(s)
+		switch key {
+		case "name":
+			if s == "" {
+				return nil, errors.New("name requis")
+			}
+		case "role":
+			s = strings.ToLower(s)
+			if !characters.ValidRole(s) {
+				return nil, errors.New("invalid role")
+			}
+		case "arc_type":
+			s = strings.ToLower(s)
+			if !characters.ValidArcType(s) {
+				return nil, errors.New("invalid arc_type")
+			}
+		}
+		out[key] = s
+	}
+	return out, nil
+}
+
+// sharedEntity : id d'une entité du monde de la série du projet.
+func sharedEntity(ctx context.Context, q db.Querier, e sharedType, pub uuid.UUID, projectID int) (int, error) {
+	var id int
+	err := q.QueryRow(ctx, `
+		SELECT id FROM `+e.table+`
+		WHERE public_id = $1 AND project_id = ANY (project_scope($2)) AND project_id <> $2
+	`, pub, projectID).Scan(&id)
+	return id, err
+}
+
+// overrideParams : projet de la session, type et entité partagée de l'URL.
+func overrideParams(ctx context.Context, w http.ResponseWriter, r *http.Request) (projectID int, entityType string, pub uuid.UUID, ok bool) {
+	projectID, _, ok = auth.RequireProject(ctx, w, r)
+	if !ok {
+		return 0, "", uuid.Nil, false
+	}
+	entityType = strings.ToLower(chi.URLParam(r, "entityType"))
+	if _, known := sharedTypes[entityType]; !known {
+		writeSeriesError(w, errInvalidEntity)
+		return 0, "", uuid.Nil, false
+	}
+	pub, err := uuid.Parse(chi.URLParam(r, "entityUUID"))
+	if err != nil {
+		http.Error(w, "invalid uuid", http.StatusBadRequest)
+		return 0, "", uuid.Nil, false
+	}
+	return projectID, entityType, pub, true
+}
+
+// getOverrides : surcharges du livre, par type puis entité.
+func getOverrides(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	list, err := OverridesByProject(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// OverridesByProject : surcharges posées par le projet, par type puis entité.
+func OverridesByProject(ctx context.Context, q db.Querier, projectID int) ([]models.EntityOverride, error) {
+	list := []models.EntityOverride{}
+	for _, entityType := range []string{"character", "location", "faction"} {
+		e := sharedTypes[entityType]
+		rows, err := q.Query(ctx, `
+			SELECT e.public_id, o.fields
+			FROM `+e.overrides+` o
+			JOIN `+e.table+` e ON e.id = o.`+e.column+`
+			WHERE o.project_id = $1
+			ORDER BY e.name ASC, e.id ASC`, projectID)
+		if err != nil {
+			return nil, err
+		}
+		found, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.EntityOverride, error) {
+			o := models.EntityOverride{EntityType: entityType}
+			err := row.Scan(&o.EntityID, &o.Fields)
+			return o, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, found...)
+	}
+	return list, nil
+}
+
+// putOverride remplace les surcharges du livre pour l'entité ; un objet vide
+// les supprime.
+func putOverride(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, entityType, pub, ok := overrideParams(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	fields, err := cleanOverride(entityType, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e := sharedTypes[entityType]
+	id, err := sharedEntity(ctx, db.Pool, e, pub, projectID)
+	if err != nil {
+		writeSeriesError(w, err)
+		return
+	}
+
+	if len(fields) == 0 {
+		if _, err := db.Pool.Exec(ctx, `
+			DELETE FROM `+e.overrides+` WHERE project_id = $1 AND `+e.column+` = $2
+		`, projectID, id); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	o := models.EntityOverride{EntityType: entityType, EntityID: pub}
+	if err := db.Pool.QueryRow(ctx, `
+		INSERT INTO `+e.overrides+` (project_id, `+e.column+`, fields)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (project_id, `+e.column+`) DO UPDATE SET fields = EXCLUDED.fields
+		RETURNING fields
+	`, projectID, id, fields).Scan(&o.Fields); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, o)
+}
+
+func deleteOverride(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, entityType, pub, ok := overrideParams(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	e := sharedTypes[entityType]
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM `+e.overrides+` o
+		USING `+e.table+` e
+		WHERE e.id = o.`+e.column+` AND o.project_id = $1 AND e.public_id = $2
+	`, projectID, pub)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,127 @@
+package setups
+
+import (
+	"context"
+	"net/http"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/google/uuid"
+)
+
+// scenePosition : place d'une scène dans l'ordre de lecture.
+type scenePosition struct {
+	SceneID      uuid.UUID `json:"scene_id"`
+	SceneTitle   string    `json:"scene_title"`
+	ChapterID    uuid.UUID `json:"chapter_id"`
+	ChapterTitle string    `json:"chapter_title"`
+	ChapterOrder int       `json:"chapter_order"`
+	SceneOrder   int       `json:"scene_order"`
+}
+
+// before : a se lit-elle avant b ?
+func (a scenePosition) before(b scenePosition) bool {
+	if a.ChapterOrder != b.ChapterOrder {
+		return a.ChapterOrder < b.ChapterOrder
+	}
+	return a.SceneOrder < b.SceneOrder
+}
+
+type reportEntry struct {
+	Setup  models.Setup   `json:"setup"`
+	At     scenePosition  `json:"at"`     // scène du setup
+	Payoff *scenePosition `json:"payoff"` // scène du payoff, nil si non payée
+}
+
+type report struct {
+	Unpaid []reportEntry `json:"unpaid"`
+	// Payoffs placés avant leur setup dans l'ordre de lecture
+	PayoffBeforeSetup []reportEntry `json:"payoff_before_setup"`
+	Total             int           `json:"total"`
+	Paid              int           `json:"paid"`
+}
+
+func reportEntries(ctx context.Context, q db.Querier, projectID int) ([]reportEntry, error) {
+	rows, err := q.Query(ctx, `
+		SELECT st.id, st.public_id, st.project_id, st.title, st.notes, st.payoff_notes,
+		       ss.public_id, ss.title, sc.public_id, sc.title, sc.order_index, ss.order_index,
+		       ps.public_id, ps.title, pc.public_id, pc.title, pc.order_index, ps.order_index
+		FROM setups st
+		JOIN scenes ss ON ss.id = st.setup_scene_id
+		JOIN chapters sc ON sc.id = ss.chapter_id
+		LEFT JOIN scenes ps ON ps.id = st.payoff_scene_id
+		LEFT JOIN chapters pc ON pc.id = ps.chapter_id
+		WHERE st.project_id = $1
+		ORDER BY sc.order_index ASC, ss.order_index ASC, st.id ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []reportEntry
+	for rows.Next() {
+		var e reportEntry
+		var payoffScene, payoffChapter *uuid.UUID
+		var payoffSceneTitle, payoffChapterTitle *string
+		var payoffChapterOrder, payoffSceneOrder *int
+		if err := rows.Scan(&e.Setup.ID, &e.Setup.PublicID, &e.Setup.ProjectID, &e.Setup.Title,
+			&e.Setup.Notes, &e.Setup.PayoffNotes,
+			&e.At.SceneID, &e.At.SceneTitle, &e.At.ChapterID, &e.At.ChapterTitle,
+			&e.At.ChapterOrder, &e.At.SceneOrder,
+			&payoffScene, &payoffSceneTitle, &payoffChapter, &payoffChapterTitle,
+			&payoffChapterOrder, &payoffSceneOrder); err != nil {
+			return nil, err
+		}
+		e.Setup.SetupSceneID = e.At.SceneID
+		e.Setup.PayoffSceneID = payoffScene
+		if payoffScene != nil {
+			e.Payoff = &scenePosition{
+				SceneID:      *payoffScene,
+				SceneTitle:   *payoffSceneTitle,
+				ChapterID:    *payoffChapter,
+				ChapterTitle: *payoffChapterTitle,
+				ChapterOrder: *payoffChapterOrder,
+				SceneOrder:   *payoffSceneOrder,
+			}
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+// getReport : préfigurations jamais payées, et payoffs qui arrivent avant
+// leur setup dans l'ordre de lecture.
+func getReport(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := reportEntries(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rep := report{
+		Unpaid:            []reportEntry{},
+		PayoffBeforeSetup: []reportEntry{},
+		Total:             len(entries),
+	}
+	for _, e := range entries {
+		if e.Payoff == nil {
+			rep.Unpaid = append(rep.Unpaid, e)
+			continue
+		}
+		rep.Paid++
+		if e.Payoff.before(e.At) {
+			rep.PayoffBeforeSetup = append(rep.PayoffBeforeSetup, e)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, rep)
+}
@@ -0,0 +1,305 @@
+package setups
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/project/{projectUUID}", getSetupsByProject)
+	r.Post("/project/{projectUUID}", createSetup)
+	r.Get("/project/{projectUUID}/report", getReport) // voir report.go
+	r.Get("/{uuid}", getSetup)
+	r.Put("/{uuid}", updateSetup)
+	r.Delete("/{uuid}", deleteSetup)
+
+	return r
+}
+
+type setupInput struct {
+	Title         string     `json:"title"`
+	Notes         string     `json:"notes"`
+	SetupSceneID  uuid.UUID  `json:"setup_scene_id"`
+	PayoffSceneID *uuid.UUID `json:"payoff_scene_id,omitempty"`
+	PayoffNotes   string     `json:"payoff_notes"`
+}
+
+func (in *setupInput) validate() error {
+	in.Title = strings.TrimSpace(in.Title)
+	if in.Title == "" {
+		return errors.New("title requis")
+	}
+	if in.PayoffSceneID != nil && *in.PayoffSceneID == in.SetupSceneID {
+		return errors.New("setup and payoff must be in different scenes")
+	}
+	return nil
+}
+
+var (
+	errInvalidSetupScene  = errors.New("invalid setup_scene_id")
+	errInvalidPayoffScene = errors.New("invalid payoff_scene_id")
+)
+
+const setupSelect = `
+	SELECT st.id, st.public_id, st.project_id, st.title, st.notes, ss.public_id, ps.public_id, st.payoff_notes
+	FROM setups st
+	JOIN scenes ss ON ss.id = st.setup_scene_id
+	LEFT JOIN scenes ps ON ps.id = st.payoff_scene_id`
+
+func scanSetup(row pgx.Row) (models.Setup, error) {
+	var s models.Setup
+	err := row.Scan(&s.ID, &s.PublicID, &s.ProjectID, &s.Title, &s.Notes,
+		&s.SetupSceneID, &s.PayoffSceneID, &s.PayoffNotes)
+	return s, err
+}
+
+// ByProject : préfigurations du projet (payload /full).
+func ByProject(ctx context.Context, q db.Querier, projectID int) ([]models.Setup, error) {
+	rows, err := q.Query(ctx, setupSelect+`
+		WHERE st.project_id = $1
+		ORDER BY st.id ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Setup{}
+	for rows.Next() {
+		s, err := scanSetup(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// ownedSetup retrouve (id, project_id) d'une préfiguration du propriétaire.
+func ownedSetup(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (id, projectID int, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT st.id, st.project_id
+		FROM setups st
+		JOIN projects p ON p.id = st.project_id
+		WHERE st.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&id, &projectID)
+	return id, projectID, err
+}
+
+// projectScene : id interne d'une scène du projet, notFound sinon.
+func projectScene(ctx context.Context, q db.Querier, pub uuid.UUID, projectID int, notFound error) (int, error) {
+	var id int
+	err := q.QueryRow(ctx, `
+		SELECT s.id
+		FROM scenes s
+		JOIN chapters c ON c.id = s.chapter_id
+		WHERE s.public_id = $1 AND c.project_id = $2
+	`, pub, projectID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, notFound
+	}
+	return id, err
+}
+
+// resolveScenes : ids internes des scènes de setup et de payoff (nil si
+// pas encore payée).
+func resolveScenes(ctx context.Context, q db.Querier, in setupInput, projectID int) (int, *int, error) {
+	setupID, err := projectScene(ctx, q, in.SetupSceneID, projectID, errInvalidSetupScene)
+	if err != nil {
+		return 0, nil, err
+	}
+	if in.PayoffSceneID == nil {
+		return setupID, nil, nil
+	}
+	payoffID, err := projectScene(ctx, q, *in.PayoffSceneID, projectID, errInvalidPayoffScene)
+	if err != nil {
+		return 0, nil, err
+	}
+	return setupID, &payoffID, nil
+}
+
+func writeSceneError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidSetupScene) || errors.Is(err, errInvalidPayoffScene) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+}
+
+func getSetupsByProject(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	list, err := ByProject(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createSetup(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body setupInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	setupSceneID, payoffSceneID, err := resolveScenes(ctx, db.Pool, body, projectID)
+	if err != nil {
+		writeSceneError(w, err)
+		return
+	}
+
+	var id int
+	if err := db.Pool.QueryRow(ctx, `
+		INSERT INTO setups (project_id, title, notes, setup_scene_id, payoff_scene_id, payoff_notes)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		projectID, body.Title, body.Notes, setupSceneID, payoffSceneID, body.PayoffNotes).Scan(&id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s, err := scanSetup(db.Pool.QueryRow(ctx, setupSelect+` WHERE st.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, s)
+}
+
+func getSetup(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	s, err := scanSetup(db.Pool.QueryRow(ctx, setupSelect+`
+		JOIN projects p ON p.id = st.project_id
+		WHERE st.public_id = $1 AND p.user_id = $2`, pub, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s)
+}
+
+// updateSetup remplace tous les champs ; payoff_scene_id absent = non payée.
+func updateSetup(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body setupInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, projectID, err := ownedSetup(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setupSceneID, payoffSceneID, err := resolveScenes(ctx, db.Pool, body, projectID)
+	if err != nil {
+		writeSceneError(w, err)
+		return
+	}
+
+	if _, err := db.Pool.Exec(ctx, `
+		UPDATE setups
+		SET title = $2, notes = $3, setup_scene_id = $4, payoff_scene_id = $5, payoff_notes = $6
+		WHERE id = $1
+	`, id, body.Title, body.Notes, setupSceneID, payoffSceneID, body.PayoffNotes); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s, err := scanSetup(db.Pool.QueryRow(ctx, setupSelect+` WHERE st.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s)
+}
+
+func deleteSetup(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM setups st
+		USING projects p
+		WHERE p.id = st.project_id AND st.public_id = $1 AND p.user_id = $2
+	`, pub, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
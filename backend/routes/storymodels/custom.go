@@ -0,0 +1,674 @@
+package storymodels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/db"
+	"backend/routes/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Modèles narratifs personnels : créés ou clonés par un utilisateur, seuls
+// ceux-ci sont modifiables. Les modèles intégrés (user_id NULL) sont en lecture seule.
+
+type phaseInput struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Color       string  `json:"color"`
+	Position    float64 `json:"position"`
+}
+
+func (in *phaseInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Color = strings.TrimSpace(in.Color)
+	if in.Name == "" {
+		return errors.New("phase name requis")
+	}
+	if in.Position < 0 || in.Position > 100 {
+		return errors.New("position must be between 0 and 100")
+	}
+	return nil
+}
+
+type modelInput struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Phases      []phaseInput `json:"phases"`
+}
+
+func (in *modelInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		return errors.New("name requis")
+	}
+	for i := range in.Phases {
+		if err := in.Phases[i].validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chapterConflict : chapitre dont la phase n'est plus dans l'ordre du récit.
+type chapterConflict struct {
+	ChapterID    uuid.UUID `json:"chapter_id"`
+	Title        string    `json:"title"`
+	StoryPhaseID int       `json:"story_phase_id"`
+}
+
+// ownedModelFromRequest : session + {id} d'un modèle personnel de l'utilisateur.
+func ownedModelFromRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) (int, int64, bool) {
+	userID, err := auth.SessionUserID(ctx, r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	var ok bool
+	if err := db.Pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM story_models WHERE id = $1 AND user_id = $2)
+	`, id, userID).Scan(&ok); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return 0, 0, false
+	}
+	if !ok {
+		// Modèle intégré ou d'un autre utilisateur : non modifiable
+		http.Error(w, "not found", http.StatusNotFound)
+		return 0, 0, false
+	}
+	return id, userID, true
+}
+
+// ownedPhaseFromRequest : session + {phaseID} d'une phase d'un modèle personnel.
+func ownedPhaseFromRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) (phaseID, modelID int, ok bool) {
+	userID, err := auth.SessionUserID(ctx, r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+	phaseID, err = strconv.Atoi(chi.URLParam(r, "phaseID"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	err = db.Pool.QueryRow(ctx, `
+		SELECT ph.story_model_id
+		FROM story_phases ph
+		JOIN story_models sm ON sm.id = ph.story_model_id
+		WHERE ph.id = $1 AND sm.user_id = $2
+	`, phaseID, userID).Scan(&modelID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return 0, 0, false
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return 0, 0, false
+	}
+	return phaseID, modelID, true
+}
+
+// lockModel sérialise les modifications de phases d'un même modèle.
+func lockModel(ctx context.Context, tx pgx.Tx, modelID int) error {
+	_, err := tx.Exec(ctx, `SELECT 1 FROM story_models WHERE id = $1 FOR UPDATE`, modelID)
+	return err
+}
+
+func phaseIDs(ctx context.Context, q db.Querier, modelID int) ([]int, error) {
+	phases, err := PhasesByModel(ctx, q, modelID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, len(phases))
+	for i, ph := range phases {
+		ids[i] = ph.ID
+	}
+	return ids, nil
+}
+
+func insertPhases(ctx context.Context, tx pgx.Tx, modelID int, phases []phaseInput) error {
+	for i, ph := range phases {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO story_phases (story_model_id, name, description, color, position_percent, order_index)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			modelID, ph.Name, ph.Description, ph.Color, ph.Position, i+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createStoryModel(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, err := auth.SessionUserID(ctx, r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body modelInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO story_models (user_id, name, description)
+		VALUES ($1, $2, $3)
+		RETURNING id`, userID, body.Name, body.Description).Scan(&id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := insertPhases(ctx, tx, id, body.Phases); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	m, err := ByID(ctx, tx, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, m)
+}
+
+// cloneStoryModel copie un modèle visible (intégré ou personnel) et ses
+// phases dans un nouveau modèle personnel, modifiable.
+func cloneStoryModel(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, err := auth.SessionUserID(ctx, r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	srcID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	// Nom facultatif, sinon "<source> (copie)"
+	var body struct {
+		Name string `json:"name"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "bad json", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ok, err := Visible(ctx, db.Pool, srcID, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO story_models (user_id, name, description)
+		SELECT $2, COALESCE(NULLIF($3, ''), name || ' (copie)'), description
+		FROM story_models WHERE id = $1
+		RETURNING id`, srcID, userID, strings.TrimSpace(body.Name)).Scan(&id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO story_phases (story_model_id, name, description, color, position_percent, order_index)
+		SELECT $2, name, description, color, position_percent, order_index
+		FROM story_phases WHERE story_model_id = $1`, srcID, id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	m, err := ByID(ctx, tx, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, m)
+}
+
+// updateStoryModel renomme le modèle ; les phases se modifient une à une.
+func updateStoryModel(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	id, _, ok := ownedModelFromRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body modelInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	body.Phases = nil
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := db.Pool.Exec(ctx, `
+		UPDATE story_models SET name = $2, description = $3 WHERE id = $1
+	`, id, body.Name, body.Description); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	m, err := ByID(ctx, db.Pool, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, m)
+}
+
+// deleteStoryModel refuse la suppression tant qu'un projet utilise le modèle
+// ou qu'un chapitre pointe vers l'une de ses phases. Les projets et chapitres
+// à la corbeille et les copies figées des instantanés comptent aussi : une
+// restauration ne doit pas retrouver un modèle disparu.
+func deleteStoryModel(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	id, _, ok := ownedModelFromRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockModel(ctx, tx, id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var projects, chapters int
+	if err := tx.QueryRow(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM projects_all WHERE story_model_id = $1),
+			(SELECT COUNT(*) FROM chapters_all c
+			 JOIN story_phases ph ON ph.id = c.story_phase_id
+			 WHERE ph.story_model_id = $1)
+	`, id).Scan(&projects, &chapters); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if projects > 0 || chapters > 0 {
+		http.Error(w, fmt.Sprintf("story model in use by %d project(s) and %d chapter(s)", projects, chapters),
+			http.StatusConflict)
+		return
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM story_phases WHERE story_model_id = $1`, id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM story_models WHERE id = $1`, id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addPhase ajoute une phase en fin de modèle (utiliser /move pour la placer).
+func addPhase(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	id, _, ok := ownedModelFromRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body phaseInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockModel(ctx, tx, id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ph, err := scanPhase(tx.QueryRow(ctx, `
+		INSERT INTO story_phases AS ph (story_model_id, name, description, color, position_percent, order_index)
+		VALUES ($1, $2, $3, $4, $5,
+		        (SELECT COALESCE(MAX(order_index), 0) + 1 FROM story_phases WHERE story_model_id = $1))
+		RETURNING `+phaseColumns,
+		id, body.Name, body.Description, body.Color, body.Position))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, ph)
+}
+
+func updatePhase(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	phaseID, _, ok := ownedPhaseFromRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body phaseInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ph, err := scanPhase(db.Pool.QueryRow(ctx, `
+		UPDATE story_phases AS ph
+		SET name = $2, description = $3, color = $4, position_percent = $5
+		WHERE ph.id = $1
+		RETURNING `+phaseColumns,
+		phaseID, body.Name, body.Description, body.Color, body.Position))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ph)
+}
+
+// deletePhase : si des chapitres pointent vers la phase, il faut choisir
+// explicitement ?reassign=<phase_id> (autre phase du même modèle) ou
+// ?detach=true (story_phase_id remis à NULL).
+func deletePhase(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	phaseID, modelID, ok := ownedPhaseFromRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var reassign *int
+	if v := r.URL.Query().Get("reassign"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id == phaseID {
+			http.Error(w, "invalid reassign", http.StatusBadRequest)
+			return
+		}
+		reassign = &id
+	}
+	detach := r.URL.Query().Get("detach") == "true"
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockModel(ctx, tx, modelID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if reassign != nil {
+		var sameModel bool
+		if err := tx.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM story_phases WHERE id = $1 AND story_model_id = $2)
+		`, *reassign, modelID).Scan(&sameModel); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !sameModel {
+			http.Error(w, "reassign must be a phase of the same story model", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Les chapitres à la corbeille suivent la même règle que les autres ; les
+	// copies figées des instantanés ne sont jamais réécrites, elles bloquent
+	// donc la suppression.
+	var used, frozen int
+	if err := tx.QueryRow(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE p.snapshot_of IS NULL),
+			COUNT(*) FILTER (WHERE p.snapshot_of IS NOT NULL)
+		FROM chapters_all c
+		JOIN projects_all p ON p.id = c.project_id
+		WHERE c.story_phase_id = $1
+	`, phaseID).Scan(&used, &frozen); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if frozen > 0 {
+		http.Error(w, fmt.Sprintf("phase used by %d chapter(s) in project snapshots", frozen),
+			http.StatusConflict)
+		return
+	}
+	if used > 0 && reassign == nil && !detach {
+		http.Error(w, fmt.Sprintf("phase used by %d chapter(s): use ?reassign=<phase_id> or ?detach=true", used),
+			http.StatusConflict)
+		return
+	}
+
+	// reassign nil => NULL (detach)
+	if _, err := tx.Exec(ctx, `
+		UPDATE chapters_all SET story_phase_id = $2 WHERE story_phase_id = $1
+	`, phaseID, reassign); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM story_phases WHERE id = $1`, phaseID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ids, err := phaseIDs(ctx, tx, modelID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := db.RewriteOrder(ctx, tx, "story_phases", ids); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// movePhase place la phase à la position N (1-based). Si des chapitres
+// rattachés au modèle se retrouvent hors de l'ordre des phases, la requête
+// est refusée (409 + liste) sauf avec "force": true.
+func movePhase(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	phaseID, modelID, ok := ownedPhaseFromRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Position int  `json:"position"`
+		Force    bool `json:"force"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if body.Position < 1 {
+		http.Error(w, "position must be >= 1", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockModel(ctx, tx, modelID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ids, err := phaseIDs(ctx, tx, modelID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ids = db.MoveID(ids, phaseID, body.Position)
+
+	conflicts, err := orderConflicts(ctx, tx, modelID, ids)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(conflicts) > 0 && !body.Force {
+		writeJSON(w, http.StatusConflict, map[string]any{
+			"error":    "reordering puts chapters out of phase order (send force=true to apply anyway)",
+			"chapters": conflicts,
+		})
+		return
+	}
+
+	if err := db.RewriteOrder(ctx, tx, "story_phases", ids); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	phases, err := PhasesByModel(ctx, tx, modelID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, phases)
+}
+
+// orderConflicts liste, projet par projet, les chapitres dont la phase
+// (selon le nouvel ordre ids) arrive avant celle d'un chapitre précédent.
+// Les chapitres à la corbeille comptent (ils reviennent à leur place), pas
+// les copies figées des instantanés.
+func orderConflicts(ctx context.Context, q db.Querier, modelID int, ids []int) ([]chapterConflict, error) {
+	rank := make(map[int]int, len(ids))
+	for i, id := range ids {
+		rank[id] = i
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT c.public_id, c.title, c.project_id, c.story_phase_id
+		FROM chapters_all c
+		JOIN projects_all p ON p.id = c.project_id
+		JOIN story_phases ph ON ph.id = c.story_phase_id
+		WHERE ph.story_model_id = $1 AND p.snapshot_of IS NULL
+		ORDER BY c.project_id ASC, c.order_index ASC`, modelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conflicts := []chapterConflict{}
+	lastProject, maxRank := -1, -1
+	for rows.Next() {
+		var c chapterConflict
+		var projectID int
+		if err := rows.Scan(&c.ChapterID, &c.Title, &projectID, &c.StoryPhaseID); err != nil {
+			return nil, err
+		}
+		if projectID != lastProject {
+			lastProject, maxRank = projectID, -1
+		}
+		if rank[c.StoryPhaseID] < maxRank {
+			conflicts = append(conflicts, c)
+			continue
+		}
+		maxRank = rank[c.StoryPhaseID]
+	}
+	return conflicts, rows.Err()
+}
@@ -0,0 +1,205 @@
+package storymodels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/", getStoryModels)
+	r.Get("/{id}", getStoryModel)
+
+	// Modèles personnels (voir custom.go)
+	r.Post("/", createStoryModel)
+	r.Post("/{id}/clone", cloneStoryModel)
+	r.Put("/{id}", updateStoryModel)
+	r.Delete("/{id}", deleteStoryModel)
+	r.Post("/{id}/phases", addPhase)
+	r.Put("/phases/{phaseID}", updatePhase)
+	r.Delete("/phases/{phaseID}", deletePhase)
+	r.Post("/phases/{phaseID}/move", movePhase)
+
+	return r
+}
+
+const modelColumns = `sm.id, sm.user_id, sm.name, sm.description`
+
+func scanModel(row pgx.Row) (models.StoryModel, error) {
+	var m models.StoryModel
+	err := row.Scan(&m.ID, &m.UserID, &m.Name, &m.Description)
+	return m, err
+}
+
+const phaseColumns = `ph.id, ph.story_model_id, ph.name, ph.description, ph.color,
+	ph.position_percent::float8, ph.order_index`
+
+func scanPhase(row pgx.Row) (models.StoryPhase, error) {
+	var ph models.StoryPhase
+	err := row.Scan(&ph.ID, &ph.StoryModelID, &ph.Name, &ph.Description, &ph.Color,
+		&ph.Position, &ph.OrderIndex)
+	return ph, err
+}
+
+// PhasesByModel : phases d'un modèle, dans l'ordre du récit.
+func PhasesByModel(ctx context.Context, q db.Querier, modelID int) ([]models.StoryPhase, error) {
+	rows, err := q.Query(ctx, `
+		SELECT `+phaseColumns+`
+		FROM story_phases ph
+		WHERE ph.story_model_id = $1
+		ORDER BY ph.order_index ASC, ph.id ASC`, modelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.StoryPhase{}
+	for rows.Next() {
+		ph, err := scanPhase(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, ph)
+	}
+	return list, rows.Err()
+}
+
+// ByID charge un modèle et ses phases. Renvoie pgx.ErrNoRows si absent.
+func ByID(ctx context.Context, q db.Querier, id int) (*models.StoryModel, error) {
+	m, err := scanModel(q.QueryRow(ctx, `
+		SELECT `+modelColumns+` FROM story_models sm WHERE sm.id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	m.Phases, err = PhasesByModel(ctx, q, id)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Visible : modèle intégré ou appartenant à userID (userID = 0 si pas de session).
+func Visible(ctx context.Context, q db.Querier, id int, userID int64) (bool, error) {
+	var ok bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM story_models
+			WHERE id = $1 AND (user_id IS NULL OR user_id = $2)
+		)`, id, userID).Scan(&ok)
+	return ok, err
+}
+
+// optionalUserID : la session est facultative pour lire le catalogue.
+func optionalUserID(ctx context.Context, r *http.Request) int64 {
+	userID, err := auth.SessionUserID(ctx, r)
+	if err != nil {
+		return 0
+	}
+	return userID
+}
+
+func getStoryModels(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	userID := optionalUserID(ctx, r)
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+modelColumns+`
+		FROM story_models sm
+		WHERE sm.user_id IS NULL OR sm.user_id = $1
+		ORDER BY sm.user_id NULLS FIRST, sm.id ASC`, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := []models.StoryModel{}
+	byID := map[int]int{}
+	for rows.Next() {
+		m, err := scanModel(rows)
+		if err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		m.Phases = []models.StoryPhase{}
+		byID[m.ID] = len(list)
+		list = append(list, m)
+	}
+	rows.Close()
+
+	// Toutes les phases en une requête, rangées sous leur modèle
+	phaseRows, err := db.Pool.Query(ctx, `
+		SELECT `+phaseColumns+`
+		FROM story_phases ph
+		JOIN story_models sm ON sm.id = ph.story_model_id
+		WHERE sm.user_id IS NULL OR sm.user_id = $1
+		ORDER BY ph.story_model_id ASC, ph.order_index ASC, ph.id ASC`, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer phaseRows.Close()
+
+	for phaseRows.Next() {
+		ph, err := scanPhase(phaseRows)
+		if err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if i, ok := byID[ph.StoryModelID]; ok {
+			list[i].Phases = append(list[i].Phases, ph)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func getStoryModel(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	ok, err := Visible(ctx, db.Pool, id, optionalUserID(ctx, r))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	m, err := ByID(ctx, db.Pool, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, m)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,387 @@
+package tags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// kind : un type d'entité taggable et sa table de liaison.
+type kind struct {
+	name      string // entity_type côté API
+	joinTable string
+	fk        string // colonne de l'entité dans la table de liaison
+	from      string // table de l'entité (alias e), avec jointure si besoin
+	project   string // expression du project_id de l'entité
+	label     string // colonne affichée
+	order     string
+}
+
+// Les scènes n'ont pas de project_id : on passe par leur chapitre.
+var kinds = []kind{
+	{"character", "character_tags", "character_id", "characters e", "e.project_id", "e.name", "e.name ASC"},
+	{"location", "location_tags", "location_id", "locations e", "e.project_id", "e.name", "e.name ASC"},
+	{"faction", "faction_tags", "faction_id", "factions e", "e.project_id", "e.name", "e.name ASC"},
+	{"chapter", "chapter_tags", "chapter_id", "chapters e", "e.project_id", "e.title", "e.order_index ASC"},
+	{"scene", "scene_tags", "scene_id", "scenes e JOIN chapters ec ON ec.id = e.chapter_id", "ec.project_id", "e.title",
+		"ec.order_index ASC, e.order_index ASC"},
+}
+
+func kindOf(name string) (kind, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, k := range kinds {
+		if k.name == name {
+			return k, true
+		}
+	}
+	return kind{}, false
+}
+
+var (
+	errInvalidEntityType = errors.New("invalid entity_type")
+	errInvalidEntity     = errors.New("invalid entity_id")
+	errInvalidTag        = errors.New("invalid tag_ids")
+)
+
+type taggedEntity struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// taggedEntities : entités portant le tag, groupées par type.
+func taggedEntities(ctx context.Context, q db.Querier, tagID int) (map[string][]taggedEntity, error) {
+	out := make(map[string][]taggedEntity, len(kinds))
+	for _, k := range kinds {
+		rows, err := q.Query(ctx, `
+			SELECT e.public_id, `+k.label+`
+			FROM `+k.from+`
+			JOIN `+k.joinTable+` jt ON jt.`+k.fk+` = e.id
+			WHERE jt.tag_id = $1
+			ORDER BY `+k.order, tagID)
+		if err != nil {
+			return nil, err
+		}
+		list := []taggedEntity{}
+		for rows.Next() {
+			var e taggedEntity
+			if err := rows.Scan(&e.ID, &e.Name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			list = append(list, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		out[k.name] = list
+	}
+	return out, nil
+}
+
+// EntityTagsByProject : toutes les poses de tags du projet (payload /full,
+// filtre de la Leftbar).
+func EntityTagsByProject(ctx context.Context, q db.Querier, projectID int) ([]models.EntityTag, error) {
+	parts := make([]string, 0, len(kinds))
+	for _, k := range kinds {
+		parts = append(parts, `
+			SELECT t.public_id, '`+k.name+`', e.public_id
+			FROM `+k.joinTable+` jt
+			JOIN tags t ON t.id = jt.tag_id
+			JOIN `+k.from+` ON e.id = jt.`+k.fk+`
+			WHERE t.project_id = $1`)
+	}
+	rows, err := q.Query(ctx, strings.Join(parts, " UNION ALL ")+` ORDER BY 2, 3`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.EntityTag{}
+	for rows.Next() {
+		var et models.EntityTag
+		if err := rows.Scan(&et.TagID, &et.EntityType, &et.EntityID); err != nil {
+			return nil, err
+		}
+		list = append(list, et)
+	}
+	return list, rows.Err()
+}
+
+// resolveEntity : id interne d'une entité du projet.
+func resolveEntity(ctx context.Context, q db.Querier, k kind, pub uuid.UUID, projectID int) (int, error) {
+	var id int
+	err := q.QueryRow(ctx, `
+		SELECT e.id FROM `+k.from+` WHERE e.public_id = $1 AND `+k.project+` = $2
+	`, pub, projectID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, errInvalidEntity
+	}
+	return id, err
+}
+
+// ownedEntity retrouve (id, project_id) d'une entité du propriétaire.
+func ownedEntity(ctx context.Context, q db.Querier, k kind, pub uuid.UUID, userID int64) (id, projectID int, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT e.id, `+k.project+`
+		FROM `+k.from+`
+		JOIN projects p ON p.id = `+k.project+`
+		WHERE e.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&id, &projectID)
+	return id, projectID, err
+}
+
+// tagsOfEntity : tags posés sur une entité.
+func tagsOfEntity(ctx context.Context, q db.Querier, k kind, entityID int) ([]models.Tag, error) {
+	rows, err := q.Query(ctx, tagSelect+`
+		JOIN `+k.joinTable+` jt ON jt.tag_id = t.id
+		WHERE jt.`+k.fk+` = $1
+		ORDER BY lower(t.name) ASC`, entityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Tag{}
+	for rows.Next() {
+		t, err := scanTag(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+func writeEntityError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidEntityType) || errors.Is(err, errInvalidEntity) || errors.Is(err, errInvalidTag) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+}
+
+type tagEntityInput struct {
+	EntityType string    `json:"entity_type"`
+	EntityID   uuid.UUID `json:"entity_id"`
+}
+
+// tagEntity pose le tag sur une entité du même projet (idempotent).
+func tagEntity(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body tagEntityInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	k, ok := kindOf(body.EntityType)
+	if !ok {
+		writeEntityError(w, errInvalidEntityType)
+		return
+	}
+
+	tagID, projectID, err := ownedTag(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entityID, err := resolveEntity(ctx, db.Pool, k, body.EntityID, projectID)
+	if err != nil {
+		writeEntityError(w, err)
+		return
+	}
+
+	if _, err := db.Pool.Exec(ctx, `
+		INSERT INTO `+k.joinTable+` (tag_id, `+k.fk+`) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, tagID, entityID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func untagEntity(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	k, ok := kindOf(chi.URLParam(r, "entityType"))
+	if !ok {
+		writeEntityError(w, errInvalidEntityType)
+		return
+	}
+	entityPub, err := uuid.Parse(chi.URLParam(r, "entityUUID"))
+	if err != nil {
+		http.Error(w, "invalid uuid", http.StatusBadRequest)
+		return
+	}
+
+	tagID, _, err := ownedTag(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM `+k.joinTable+`
+		WHERE tag_id = $1 AND `+k.fk+` = (SELECT e.id FROM `+k.from+` WHERE e.public_id = $2)
+	`, tagID, entityPub)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getEntityTags(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+	k, ok := kindOf(chi.URLParam(r, "entityType"))
+	if !ok {
+		writeEntityError(w, errInvalidEntityType)
+		return
+	}
+
+	id, _, err := ownedEntity(ctx, db.Pool, k, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list, err := tagsOfEntity(ctx, db.Pool, k, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+type entityTagsInput struct {
+	TagIDs []uuid.UUID `json:"tag_ids"`
+}
+
+// setEntityTags remplace l'ensemble des tags d'une entité.
+func setEntityTags(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+	k, ok := kindOf(chi.URLParam(r, "entityType"))
+	if !ok {
+		writeEntityError(w, errInvalidEntityType)
+		return
+	}
+
+	var body entityTagsInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if body.TagIDs == nil {
+		body.TagIDs = []uuid.UUID{}
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	id, projectID, err := ownedEntity(ctx, tx, k, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Tous les tags doivent appartenir au projet de l'entité
+	var found int
+	if err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM tags WHERE project_id = $1 AND public_id = ANY ($2)
+	`, projectID, body.TagIDs).Scan(&found); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	unique := map[uuid.UUID]bool{}
+	for _, t := range body.TagIDs {
+		unique[t] = true
+	}
+	if found != len(unique) {
+		writeEntityError(w, errInvalidTag)
+		return
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM `+k.joinTable+` WHERE `+k.fk+` = $1`, id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO `+k.joinTable+` (tag_id, `+k.fk+`)
+		SELECT id, $2 FROM tags WHERE project_id = $1 AND public_id = ANY ($3)
+	`, projectID, id, body.TagIDs); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list, err := tagsOfEntity(ctx, tx, k, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
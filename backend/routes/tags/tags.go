@@ -0,0 +1,403 @@
+package tags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/project/{projectUUID}", getTagsByProject)
+	r.Post("/project/{projectUUID}", createTag)
+	r.Get("/{uuid}", getTag) // tag + entités qui le portent
+	r.Put("/{uuid}", updateTag)
+	r.Delete("/{uuid}", deleteTag)
+	r.Post("/{uuid}/merge", mergeTag)
+
+	// Pose / retrait d'un tag (voir entities.go)
+	r.Post("/{uuid}/entities", tagEntity)
+	r.Delete("/{uuid}/entities/{entityType}/{entityUUID}", untagEntity)
+	r.Get("/entities/{entityType}/{uuid}", getEntityTags)
+	r.Put("/entities/{entityType}/{uuid}", setEntityTags)
+
+	return r
+}
+
+type tagInput struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+func (in *tagInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Color = strings.TrimSpace(in.Color)
+	if in.Name == "" {
+		return errors.New("name requis")
+	}
+	return nil
+}
+
+var errNameTaken = errors.New("a tag with this name already exists (use merge)")
+
+// tagSelect : colonnes du tag + un compteur par type d'entité (ordre de kinds)
+var tagSelect = func() string {
+	var b strings.Builder
+	b.WriteString(`SELECT t.id, t.public_id, t.project_id, t.name, t.color`)
+	for _, k := range kinds {
+		b.WriteString(`, (SELECT COUNT(*) FROM ` + k.joinTable + ` WHERE tag_id = t.id)`)
+	}
+	b.WriteString(` FROM tags t`)
+	return b.String()
+}()
+
+func scanTag(row pgx.Row) (models.Tag, error) {
+	var t models.Tag
+	counts := make([]int, len(kinds))
+	dest := []any{&t.ID, &t.PublicID, &t.ProjectID, &t.Name, &t.Color}
+	for i := range counts {
+		dest = append(dest, &counts[i])
+	}
+	if err := row.Scan(dest...); err != nil {
+		return t, err
+	}
+	t.Counts = make(map[string]int, len(kinds))
+	for i, k := range kinds {
+		t.Counts[k.name] = counts[i]
+		t.Count += counts[i]
+	}
+	return t, nil
+}
+
+// ByProject : tags du projet avec leurs compteurs (payload /full).
+func ByProject(ctx context.Context, q db.Querier, projectID int) ([]models.Tag, error) {
+	rows, err := q.Query(ctx, tagSelect+`
+		WHERE t.project_id = $1
+		ORDER BY lower(t.name) ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Tag{}
+	for rows.Next() {
+		t, err := scanTag(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// ownedTag retrouve (id, project_id) d'un tag du propriétaire.
+func ownedTag(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (id, projectID int, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT t.id, t.project_id
+		FROM tags t
+		JOIN projects p ON p.id = t.project_id
+		WHERE t.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&id, &projectID)
+	return id, projectID, err
+}
+
+// nameTaken : un autre tag du projet porte-t-il déjà ce nom (casse ignorée) ?
+func nameTaken(ctx context.Context, q db.Querier, projectID int, name string, selfID int) (bool, error) {
+	var taken bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM tags WHERE project_id = $1 AND lower(name) = lower($2) AND id <> $3
+		)`, projectID, name, selfID).Scan(&taken)
+	return taken, err
+}
+
+func getTagsByProject(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	list, err := ByProject(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createTag(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body tagInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	taken, err := nameTaken(ctx, db.Pool, projectID, body.Name, 0)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		http.Error(w, errNameTaken.Error(), http.StatusConflict)
+		return
+	}
+
+	// L'index unique (project_id, lower(name)) tranche entre deux créations
+	// simultanées qui ont passé nameTaken
+	var id int
+	err = db.Pool.QueryRow(ctx, `
+		INSERT INTO tags (project_id, name, color) VALUES ($1, $2, $3) RETURNING id
+	`, projectID, body.Name, body.Color).Scan(&id)
+	if db.IsUniqueViolation(err) {
+		http.Error(w, errNameTaken.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	t, err := scanTag(db.Pool.QueryRow(ctx, tagSelect+` WHERE t.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, t)
+}
+
+// getTag : le tag et tout ce qui le porte, groupé par type d'entité.
+func getTag(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	id, _, err := ownedTag(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	t, err := scanTag(db.Pool.QueryRow(ctx, tagSelect+` WHERE t.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entities, err := taggedEntities(ctx, db.Pool, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"tag":      t,
+		"entities": entities,
+	})
+}
+
+// updateTag renomme / recolore ; renommer vers un nom existant est refusé,
+// c'est le rôle de /merge.
+func updateTag(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body tagInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, projectID, err := ownedTag(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	taken, err := nameTaken(ctx, db.Pool, projectID, body.Name, id)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		http.Error(w, errNameTaken.Error(), http.StatusConflict)
+		return
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		UPDATE tags SET name = $2, color = $3 WHERE id = $1
+	`, id, body.Name, body.Color)
+	if db.IsUniqueViolation(err) {
+		http.Error(w, errNameTaken.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	t, err := scanTag(db.Pool.QueryRow(ctx, tagSelect+` WHERE t.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, t)
+}
+
+func deleteTag(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM tags t
+		USING projects p
+		WHERE p.id = t.project_id AND t.public_id = $1 AND p.user_id = $2
+	`, pub, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type mergeInput struct {
+	Into uuid.UUID `json:"into"`
+}
+
+// mergeTag reporte toutes les entités du tag sur le tag cible (même projet)
+// puis supprime le tag source. Renvoie le tag cible.
+func mergeTag(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body mergeInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if body.Into == pub {
+		http.Error(w, "cannot merge a tag into itself", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	srcID, projectID, err := ownedTag(ctx, tx, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	dstID, dstProjectID, err := ownedTag(ctx, tx, body.Into, userID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && dstProjectID != projectID) {
+		http.Error(w, "invalid into", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := db.LockProject(ctx, tx, projectID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, k := range kinds {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO `+k.joinTable+` (tag_id, `+k.fk+`)
+			SELECT $2, `+k.fk+` FROM `+k.joinTable+` WHERE tag_id = $1
+			ON CONFLICT DO NOTHING
+		`, srcID, dstID); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM tags WHERE id = $1`, srcID); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	t, err := scanTag(tx.QueryRow(ctx, tagSelect+` WHERE t.id = $1`, dstID))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, t)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,324 @@
+package timeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+
+	"backend/calendar"
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Chronologie : l'ordre in-world (story_day) est indépendant de l'ordre de
+// lecture (chapitres puis scènes, order_index).
+
+type datedScene struct {
+	PublicID       uuid.UUID
+	ChapterID      uuid.UUID
+	Title          string
+	StoryDay       *int64
+	NarrativeIndex int // 1-based, ordre de lecture
+}
+
+// scenesInReadingOrder : scènes du projet dans l'ordre de lecture.
+func scenesInReadingOrder(ctx context.Context, q db.Querier, projectID int) ([]datedScene, error) {
+	rows, err := q.Query(ctx, `
+		SELECT s.public_id, c.public_id, s.title, s.story_day
+		FROM scenes s
+		JOIN chapters c ON c.id = s.chapter_id
+		WHERE c.project_id = $1
+		ORDER BY c.order_index ASC, c.id ASC, s.order_index ASC, s.id ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []datedScene{}
+	for rows.Next() {
+		var s datedScene
+		if err := rows.Scan(&s.PublicID, &s.ChapterID, &s.Title, &s.StoryDay); err != nil {
+			return nil, err
+		}
+		s.NarrativeIndex = len(list) + 1
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// displayCalendar : calendrier demandé (?calendar=<uuid>) ou celui par défaut.
+func displayCalendar(r *http.Request, calendars []models.Calendar) (*models.Calendar, error) {
+	if v := r.URL.Query().Get("calendar"); v != "" {
+		pub, err := uuid.Parse(v)
+		if err != nil {
+			return nil, errInvalidCalendar
+		}
+		if cal := findCalendar(calendars, pub); cal != nil {
+			return cal, nil
+		}
+		return nil, errInvalidCalendar
+	}
+	if len(calendars) > 0 {
+		return &calendars[0], nil
+	}
+	return nil, nil
+}
+
+func dateIn(cal *models.Calendar, day int64) *models.StoryDate {
+	if cal == nil {
+		return nil
+	}
+	d := calendar.FromDay(*cal, day)
+	return &d
+}
+
+func setSceneDate(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body dateInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	var sceneID, projectID int
+	err := db.Pool.QueryRow(ctx, `
+		SELECT s.id, c.project_id
+		FROM scenes s
+		JOIN chapters c ON c.id = s.chapter_id
+		JOIN projects p ON p.id = c.project_id
+		WHERE s.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&sceneID, &projectID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	calendars, err := loadCalendars(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	day, cal, err := resolveDate(body, calendars)
+	if err != nil {
+		writeDateError(w, err)
+		return
+	}
+	if cal == nil && len(calendars) > 0 {
+		cal = &calendars[0]
+	}
+
+	if _, err := db.Pool.Exec(ctx, `
+		UPDATE scenes SET story_day = $2 WHERE id = $1
+	`, sceneID, day); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"scene_id":  pub,
+		"story_day": day,
+		"date":      dateIn(cal, day),
+	})
+}
+
+func clearSceneDate(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE scenes s
+		SET story_day = NULL
+		FROM chapters c, projects p
+		WHERE c.id = s.chapter_id AND p.id = c.project_id
+		  AND s.public_id = $1 AND p.user_id = $2
+	`, pub, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type chronologyEntry struct {
+	Kind           string            `json:"kind"` // "scene" ou "event"
+	ID             uuid.UUID         `json:"id"`
+	Title          string            `json:"title"`
+	Day            int64             `json:"day"`
+	Date           *models.StoryDate `json:"date,omitempty"`
+	ChapterID      *uuid.UUID        `json:"chapter_id,omitempty"`
+	NarrativeIndex *int              `json:"narrative_index,omitempty"`
+}
+
+// getChronology : scènes datées et événements, triés par jour in-world.
+// À jour égal : événements d'abord, puis scènes dans l'ordre de lecture.
+// Les scènes non datées sont listées à part.
+func getChronology(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	calendars, err := loadCalendars(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cal, err := displayCalendar(r, calendars)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	events, err := EventsByProject(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	scenes, err := scenesInReadingOrder(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entries := []chronologyEntry{}
+	for _, ev := range events {
+		entries = append(entries, chronologyEntry{
+			Kind:  "event",
+			ID:    ev.PublicID,
+			Title: ev.Title,
+			Day:   ev.Day,
+			Date:  dateIn(cal, ev.Day),
+		})
+	}
+	undated := []chronologyEntry{}
+	for _, s := range scenes {
+		e := chronologyEntry{
+			Kind:           "scene",
+			ID:             s.PublicID,
+			Title:          s.Title,
+			ChapterID:      &s.ChapterID,
+			NarrativeIndex: &s.NarrativeIndex,
+		}
+		if s.StoryDay == nil {
+			undated = append(undated, e)
+			continue
+		}
+		e.Day = *s.StoryDay
+		e.Date = dateIn(cal, e.Day)
+		entries = append(entries, e)
+	}
+
+	// Tri stable : les événements (déjà par jour) précèdent les scènes (déjà
+	// dans l'ordre de lecture)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Day < entries[j].Day
+	})
+
+	var calendarID *uuid.UUID
+	if cal != nil {
+		calendarID = &cal.PublicID
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"calendar_id":    calendarID,
+		"entries":        entries,
+		"undated_scenes": undated,
+	})
+}
+
+type sceneOrder struct {
+	ID             uuid.UUID         `json:"id"`
+	Title          string            `json:"title"`
+	ChapterID      uuid.UUID         `json:"chapter_id"`
+	NarrativeIndex int               `json:"narrative_index"`
+	ChronoIndex    *int              `json:"chrono_index"` // nil si la scène n'est pas datée
+	StoryDay       *int64            `json:"story_day"`
+	Date           *models.StoryDate `json:"date,omitempty"`
+}
+
+// getSceneOrders : ordre de lecture et ordre chronologique des scènes côte à
+// côte. Les scènes du même jour partagent le même rang chronologique.
+func getSceneOrders(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	calendars, err := loadCalendars(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cal, err := displayCalendar(r, calendars)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	scenes, err := scenesInReadingOrder(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	narrative := make([]sceneOrder, len(scenes))
+	dated := []int{}
+	for i, s := range scenes {
+		narrative[i] = sceneOrder{
+			ID:             s.PublicID,
+			Title:          s.Title,
+			ChapterID:      s.ChapterID,
+			NarrativeIndex: s.NarrativeIndex,
+			StoryDay:       s.StoryDay,
+		}
+		if s.StoryDay != nil {
+			narrative[i].Date = dateIn(cal, *s.StoryDay)
+			dated = append(dated, i)
+		}
+	}
+
+	sort.SliceStable(dated, func(a, b int) bool {
+		return *scenes[dated[a]].StoryDay < *scenes[dated[b]].StoryDay
+	})
+	chronological := make([]sceneOrder, 0, len(dated))
+	rank := 0
+	for k, i := range dated {
+		if k == 0 || *scenes[i].StoryDay != *scenes[dated[k-1]].StoryDay {
+			rank = k + 1
+		}
+		chrono := rank
+		narrative[i].ChronoIndex = &chrono
+		chronological = append(chronological, narrative[i])
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"narrative":     narrative,
+		"chronological": chronological,
+	})
+}
@@ -0,0 +1,253 @@
+package timeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/calendar"
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type eventInput struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	dateInput
+}
+
+func (in *eventInput) validate() error {
+	in.Title = strings.TrimSpace(in.Title)
+	if in.Title == "" {
+		return errors.New("title requis")
+	}
+	return nil
+}
+
+const eventSelect = `
+	SELECT ev.id, ev.public_id, ev.project_id, ev.title, ev.description, ev.day, cal.public_id
+	FROM timeline_events ev
+	LEFT JOIN calendars cal ON cal.id = ev.calendar_id`
+
+func scanEvent(row pgx.Row) (models.TimelineEvent, error) {
+	var ev models.TimelineEvent
+	err := row.Scan(&ev.ID, &ev.PublicID, &ev.ProjectID, &ev.Title, &ev.Description, &ev.Day, &ev.CalendarID)
+	return ev, err
+}
+
+// withDate renseigne la date lisible de l'événement dans son calendrier, ou à
+// défaut dans le calendrier par défaut du projet.
+func withDate(ev *models.TimelineEvent, calendars []models.Calendar) {
+	var cal *models.Calendar
+	if ev.CalendarID != nil {
+		cal = findCalendar(calendars, *ev.CalendarID)
+	}
+	if cal == nil && len(calendars) > 0 {
+		cal = &calendars[0]
+	}
+	if cal != nil {
+		d := calendar.FromDay(*cal, ev.Day)
+		ev.Date = &d
+	}
+}
+
+// EventsByProject : événements du projet triés par jour.
+func EventsByProject(ctx context.Context, q db.Querier, projectID int) ([]models.TimelineEvent, error) {
+	calendars, err := loadCalendars(ctx, q, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(ctx, eventSelect+`
+		WHERE ev.project_id = $1
+		ORDER BY ev.day ASC, ev.id ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.TimelineEvent{}
+	for rows.Next() {
+		ev, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		withDate(&ev, calendars)
+		list = append(list, ev)
+	}
+	return list, rows.Err()
+}
+
+// calendarIDOf : id interne du calendrier choisi (nil si aucun).
+func calendarIDOf(cal *models.Calendar) *int {
+	if cal == nil {
+		return nil
+	}
+	return &cal.ID
+}
+
+func getEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	list, err := EventsByProject(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createEvent(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body eventInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	calendars, err := loadCalendars(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	day, cal, err := resolveDate(body.dateInput, calendars)
+	if err != nil {
+		writeDateError(w, err)
+		return
+	}
+
+	var id int
+	if err := db.Pool.QueryRow(ctx, `
+		INSERT INTO timeline_events (project_id, title, description, day, calendar_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`,
+		projectID, body.Title, body.Description, day, calendarIDOf(cal)).Scan(&id); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ev, err := scanEvent(db.Pool.QueryRow(ctx, eventSelect+` WHERE ev.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	withDate(&ev, calendars)
+
+	writeJSON(w, http.StatusCreated, ev)
+}
+
+// ownedEvent retrouve (id, project_id) d'un événement du propriétaire.
+func ownedEvent(ctx context.Context, q db.Querier, pub uuid.UUID, userID int64) (id, projectID int, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT ev.id, ev.project_id
+		FROM timeline_events ev
+		JOIN projects p ON p.id = ev.project_id
+		WHERE ev.public_id = $1 AND p.user_id = $2
+	`, pub, userID).Scan(&id, &projectID)
+	return id, projectID, err
+}
+
+func updateEvent(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body eventInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, projectID, err := ownedEvent(ctx, db.Pool, pub, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	calendars, err := loadCalendars(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	day, cal, err := resolveDate(body.dateInput, calendars)
+	if err != nil {
+		writeDateError(w, err)
+		return
+	}
+
+	if _, err := db.Pool.Exec(ctx, `
+		UPDATE timeline_events
+		SET title = $2, description = $3, day = $4, calendar_id = $5
+		WHERE id = $1`,
+		id, body.Title, body.Description, day, calendarIDOf(cal)); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ev, err := scanEvent(db.Pool.QueryRow(ctx, eventSelect+` WHERE ev.id = $1`, id))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	withDate(&ev, calendars)
+
+	writeJSON(w, http.StatusOK, ev)
+}
+
+func deleteEvent(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM timeline_events ev
+		USING projects p
+		WHERE p.id = ev.project_id AND ev.public_id = $1 AND p.user_id = $2
+	`, pub, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
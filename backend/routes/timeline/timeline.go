@@ -0,0 +1,332 @@
+package timeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"backend/calendar"
+	"backend/db"
+	"backend/models"
+	"backend/routes/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	// Calendriers
+	r.Get("/project/{projectUUID}/calendars", getCalendars)
+	r.Post("/project/{projectUUID}/calendars", createCalendar)
+	r.Get("/calendars/{uuid}", getCalendar)
+	r.Put("/calendars/{uuid}", updateCalendar)
+	r.Delete("/calendars/{uuid}", deleteCalendar)
+	r.Post("/project/{projectUUID}/convert", convertDate)
+
+	// Événements (voir events.go)
+	r.Get("/project/{projectUUID}/events", getEvents)
+	r.Post("/project/{projectUUID}/events", createEvent)
+	r.Put("/events/{uuid}", updateEvent)
+	r.Delete("/events/{uuid}", deleteEvent)
+
+	// Dates des scènes et chronologie (voir chronology.go)
+	r.Put("/scenes/{uuid}/date", setSceneDate)
+	r.Delete("/scenes/{uuid}/date", clearSceneDate)
+	r.Get("/project/{projectUUID}", getChronology)
+	r.Get("/project/{projectUUID}/order", getSceneOrders)
+
+	return r
+}
+
+// dateInput : soit un jour absolu, soit une date dans l'un des calendriers du projet.
+type dateInput struct {
+	Day        *int64            `json:"day,omitempty"`
+	CalendarID *uuid.UUID        `json:"calendar_id,omitempty"`
+	Date       *models.StoryDate `json:"date,omitempty"`
+}
+
+var (
+	errInvalidCalendar = errors.New("invalid calendar_id")
+	errMissingDate     = errors.New("day or calendar_id + date requis")
+)
+
+// dateError : erreur de saisie (400), par opposition à une erreur DB.
+type dateError struct{ err error }
+
+func (e dateError) Error() string { return e.err.Error() }
+
+const calendarColumns = `cal.id, cal.public_id, cal.project_id, cal.name, cal.months, cal.weekdays,
+	cal.eras, cal.epoch_offset, cal.weekday_offset`
+
+func scanCalendar(row pgx.Row) (models.Calendar, error) {
+	var c models.Calendar
+	err := row.Scan(&c.ID, &c.PublicID, &c.ProjectID, &c.Name, &c.Months, &c.Weekdays,
+		&c.Eras, &c.EpochOffset, &c.WeekdayOffset)
+	return c, err
+}
+
+// loadCalendars : calendriers du projet, le premier créé faisant office de
+// calendrier par défaut.
+func loadCalendars(ctx context.Context, q db.Querier, projectID int) ([]models.Calendar, error) {
+	rows, err := q.Query(ctx, `
+		SELECT `+calendarColumns+`
+		FROM calendars cal
+		WHERE cal.project_id = $1
+		ORDER BY cal.id ASC`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Calendar{}
+	for rows.Next() {
+		c, err := scanCalendar(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+// CalendarsByProject : calendriers du projet, pour l'état enregistré d'un
+// instantané.
+func CalendarsByProject(ctx context.Context, q db.Querier, projectID int) ([]models.Calendar, error) {
+	return loadCalendars(ctx, q, projectID)
+}
+
+func findCalendar(list []models.Calendar, pub uuid.UUID) *models.Calendar {
+	for i := range list {
+		if list[i].PublicID == pub {
+			return &list[i]
+		}
+	}
+	return nil
+}
+
+// resolveDate ramène un dateInput à un jour absolu ; renvoie aussi le
+// calendrier utilisé (nil si le jour est donné directement).
+func resolveDate(in dateInput, calendars []models.Calendar) (int64, *models.Calendar, error) {
+	var cal *models.Calendar
+	if in.CalendarID != nil {
+		if cal = findCalendar(calendars, *in.CalendarID); cal == nil {
+			return 0, nil, dateError{errInvalidCalendar}
+		}
+	}
+	if in.Day != nil {
+		return *in.Day, cal, nil
+	}
+	if cal == nil || in.Date == nil {
+		return 0, nil, dateError{errMissingDate}
+	}
+	day, err := calendar.ToDay(*cal, *in.Date)
+	if err != nil {
+		return 0, nil, dateError{err}
+	}
+	return day, cal, nil
+}
+
+func writeDateError(w http.ResponseWriter, err error) {
+	var de dateError
+	if errors.As(err, &de) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+}
+
+func getCalendars(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	list, err := loadCalendars(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createCalendar(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body models.Calendar
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := calendar.Validate(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c, err := scanCalendar(db.Pool.QueryRow(ctx, `
+		INSERT INTO calendars AS cal (project_id, name, months, weekdays, eras, epoch_offset, weekday_offset)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+calendarColumns,
+		projectID, body.Name, body.Months, body.Weekdays, body.Eras, body.EpochOffset, body.WeekdayOffset))
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, c)
+}
+
+func getCalendar(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	c, err := scanCalendar(db.Pool.QueryRow(ctx, `
+		SELECT `+calendarColumns+`
+		FROM calendars cal
+		JOIN projects p ON p.id = cal.project_id
+		WHERE cal.public_id = $1 AND p.user_id = $2`, pub, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, c)
+}
+
+// updateCalendar : les dates stockées sont des jours absolus, elles ne
+// bougent pas ; seul leur affichage dans ce calendrier change.
+func updateCalendar(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body models.Calendar
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if err := calendar.Validate(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c, err := scanCalendar(db.Pool.QueryRow(ctx, `
+		UPDATE calendars AS cal
+		SET name = $3, months = $4, weekdays = $5, eras = $6, epoch_offset = $7, weekday_offset = $8
+		FROM projects p
+		WHERE p.id = cal.project_id AND cal.public_id = $1 AND p.user_id = $2
+		RETURNING `+calendarColumns,
+		pub, userID, body.Name, body.Months, body.Weekdays, body.Eras, body.EpochOffset, body.WeekdayOffset))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, c)
+}
+
+func deleteCalendar(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, pub, ok := auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	// Les événements gardent leur jour absolu (calendar_id passe à NULL)
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM calendars cal
+		USING projects p
+		WHERE p.id = cal.project_id AND cal.public_id = $1 AND p.user_id = $2
+	`, pub, userID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type calendarDate struct {
+	CalendarID   uuid.UUID        `json:"calendar_id"`
+	CalendarName string           `json:"calendar_name"`
+	Date         models.StoryDate `json:"date"`
+}
+
+// convertDate : une date (ou un jour absolu) exprimée dans tous les
+// calendriers du projet.
+func convertDate(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	projectID, _, ok := auth.RequireProject(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	var body dateInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	calendars, err := loadCalendars(ctx, db.Pool, projectID)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	day, _, err := resolveDate(body, calendars)
+	if err != nil {
+		writeDateError(w, err)
+		return
+	}
+
+	dates := make([]calendarDate, 0, len(calendars))
+	for _, c := range calendars {
+		dates = append(dates, calendarDate{
+			CalendarID:   c.PublicID,
+			CalendarName: c.Name,
+			Date:         calendar.FromDay(c, day),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"day":   day,
+		"dates": dates,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
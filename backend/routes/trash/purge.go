@@ -0,0 +1,149 @@
+package trash
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"backend/db"
+	"backend/routes/images"
+	"backend/storage"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// retention : durée de séjour en corbeille avant la purge définitive
+// (TRASH_RETENTION_DAYS, 30 jours par défaut).
+var retention = 30 * 24 * time.Hour
+
+// Fréquence de la purge planifiée
+const purgeEvery = time.Hour
+
+// Ordre de purge : les enfants avant leurs parents (scènes avant chapitres,
+// entités avant projets)
+var purgeOrder = []string{"scene", "chapter", "location", "character", "faction", "project"}
+
+// StartPurge lit la rétention et lance la purge planifiée en tâche de fond.
+func StartPurge() {
+	if v := os.Getenv("TRASH_RETENTION_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			log.Fatalf("❌ Invalid TRASH_RETENTION_DAYS %q", v)
+		}
+		retention = time.Duration(days) * 24 * time.Hour
+	}
+	log.Printf("✅ Trash retention: %s", retention)
+
+	go func() {
+		for {
+			if n, err := Purge(context.Background(), time.Now().Add(-retention)); err != nil {
+				log.Printf("❌ trash purge error: %v", err)
+			} else if n > 0 {
+				log.Printf("✅ trash purge: %d rows", n)
+			}
+			time.Sleep(purgeEvery)
+		}
+	}()
+}
+
+// Purge supprime définitivement tout ce qui est à la corbeille depuis avant
+// before ; renvoie le nombre de lignes purgées.
+func Purge(ctx context.Context, before time.Time) (int, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var total int
+	var keys []string
+	for _, name := range purgeOrder {
+		rows, err := tx.Query(ctx, `
+			SELECT id FROM `+trashTypes[name].table+` WHERE deleted_at < $1
+		`, before)
+		if err != nil {
+			return 0, err
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+		if err != nil {
+			return 0, err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		found, err := purgeIDs(ctx, tx, name, ids)
+		if err != nil {
+			return 0, err
+		}
+		keys = append(keys, found...)
+		total += len(ids)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	deleteFiles(ctx, keys)
+	return total, nil
+}
+
+// purgeIDs supprime les lignes ids (à la corbeille) du type name. Pour les
+// projets, renvoie les clés des images à effacer du stockage après le commit.
+func purgeIDs(ctx context.Context, tx pgx.Tx, name string, ids []int) ([]string, error) {
+	switch name {
+	case "chapter":
+		// Les scènes d'un chapitre à la corbeille y sont toutes aussi
+		if _, err := tx.Exec(ctx, `DELETE FROM scenes_all WHERE chapter_id = ANY ($1)`, ids); err != nil {
+			return nil, err
+		}
+	case "location":
+		// Scènes et sous-lieux qui y renvoient encore (à la corbeille depuis
+		// plus longtemps) perdent le lien, comme à la suppression d'un lieu
+		if _, err := tx.Exec(ctx, `UPDATE scenes_all SET location_id = NULL WHERE location_id = ANY ($1)`, ids); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE locations_all SET parent_id = NULL
+			WHERE parent_id = ANY ($1) AND NOT id = ANY ($1)
+		`, ids); err != nil {
+			return nil, err
+		}
+	case "project":
+		// Les copies figées des instantanés partent en cascade : leurs
+		// images aussi
+		var copies []int
+		rows, err := tx.Query(ctx, `SELECT id FROM projects_all WHERE snapshot_of = ANY ($1)`, ids)
+		if err == nil {
+			copies, err = pgx.CollectRows(rows, pgx.RowTo[int])
+		}
+		if err != nil {
+			return nil, err
+		}
+		var keys []string
+		for _, id := range append(copies, ids...) {
+			list, err := images.ByProject(ctx, tx, id)
+			if err != nil {
+				return nil, err
+			}
+			for _, img := range list {
+				keys = append(keys, img.StorageKey, img.ThumbKey)
+			}
+		}
+		_, err = tx.Exec(ctx, `DELETE FROM projects_all WHERE id = ANY ($1)`, ids)
+		return keys, err
+	}
+
+	_, err := tx.Exec(ctx, `DELETE FROM `+trashTypes[name].table+` WHERE id = ANY ($1)`, ids)
+	return nil, err
+}
+
+// deleteFiles : fichiers supprimés après le commit, au pire un orphelin,
+// jamais une ligne qui pointe vers un fichier absent.
+func deleteFiles(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := storage.Default.Delete(ctx, key); err != nil {
+			log.Printf("❌ storage delete error: %s: %v", key, err)
+		}
+	}
+}
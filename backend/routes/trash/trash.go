@@ -0,0 +1,378 @@
+package trash
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/db"
+	"backend/routes/auth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Corbeille : les suppressions de projets et d'entités posent deleted_at
+// (voir migration 020) ; d'ici on liste, restaure ou purge ces lignes.
+func Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/", getTrash)
+	r.Post("/{type}/{uuid}/restore", restoreItem)
+	r.Delete("/{type}/{uuid}", purgeItem)
+
+	return r
+}
+
+// trashType : table complète (<table>_all) d'un type et chemin jusqu'à son
+// projet p. Les entités d'un projet lui-même à la corbeille n'apparaissent
+// pas : elles suivent leur projet.
+type trashType struct {
+	table   string
+	label   string // colonne affichée
+	join    string // jointures jusqu'au projet actif p
+	project string // public_id du projet
+	owner   string // propriétaire
+	// Exclut les lignes supprimées avec un parent (même deleted_at) : elles
+	// sont restaurées et purgées avec lui
+	batched string
+}
+
+var trashTypes = map[string]trashType{
+	"project": {
+		table: "projects_all", label: "e.title",
+		project: "NULL::uuid", owner: "e.user_id",
+	},
+	"character": {
+		table: "characters_all", label: "e.name",
+		join:    "JOIN projects p ON p.id = e.project_id",
+		project: "p.public_id", owner: "p.user_id",
+	},
+	"location": {
+		table: "locations_all", label: "e.name",
+		join:    "JOIN projects p ON p.id = e.project_id",
+		project: "p.public_id", owner: "p.user_id",
+		batched: "EXISTS (SELECT 1 FROM locations_all pl WHERE pl.id = e.parent_id AND pl.deleted_at = e.deleted_at)",
+	},
+	"faction": {
+		table: "factions_all", label: "e.name",
+		join:    "JOIN projects p ON p.id = e.project_id",
+		project: "p.public_id", owner: "p.user_id",
+	},
+	"chapter": {
+		table: "chapters_all", label: "e.title",
+		join:    "JOIN projects p ON p.id = e.project_id",
+		project: "p.public_id", owner: "p.user_id",
+	},
+	"scene": {
+		table: "scenes_all", label: "e.title",
+		join:    "JOIN chapters_all c ON c.id = e.chapter_id JOIN projects p ON p.id = c.project_id",
+		project: "p.public_id", owner: "p.user_id",
+		batched: "c.deleted_at = e.deleted_at",
+	},
+}
+
+// Ordre d'affichage des types à date égale
+var typeOrder = []string{"project", "chapter", "scene", "character", "location", "faction"}
+
+var (
+	errInvalidType    = errors.New("invalid type")
+	errChapterTrashed = errors.New("chapter is in the trash: restore it first")
+	errParentTrashed  = errors.New("parent location is in the trash: restore it first")
+)
+
+func writeTrashError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, errInvalidType):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errChapterTrashed), errors.Is(err, errParentTrashed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+type trashItem struct {
+	Type      string     `json:"type"`
+	ID        uuid.UUID  `json:"id"`
+	Name      string     `json:"name"`
+	ProjectID *uuid.UUID `json:"project_id,omitempty"`
+	DeletedAt time.Time  `json:"deleted_at"`
+	PurgeAt   time.Time  `json:"purge_at"`
+}
+
+// getTrash : corbeille de l'utilisateur, suppressions les plus récentes
+// d'abord, avec la date de purge définitive.
+func getTrash(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	userID, err := auth.SessionUserID(ctx, r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	list := []trashItem{}
+	for _, name := range typeOrder {
+		t := trashTypes[name]
+		where := t.owner + ` = $1 AND e.deleted_at IS NOT NULL`
+		if t.batched != "" {
+			where += ` AND NOT (` + t.batched + `)`
+		}
+		rows, err := db.Pool.Query(ctx, `
+			SELECT e.public_id, `+t.label+`, `+t.project+`, e.deleted_at
+			FROM `+t.table+` e `+t.join+`
+			WHERE `+where, userID)
+		if err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		found, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (trashItem, error) {
+			it := trashItem{Type: name}
+			err := row.Scan(&it.ID, &it.Name, &it.ProjectID, &it.DeletedAt)
+			it.PurgeAt = it.DeletedAt.Add(retention)
+			return it, err
+		})
+		if err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		list = append(list, found...)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].DeletedAt.After(list[j].DeletedAt) })
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// trashed : ligne à la corbeille du propriétaire (id, projet, deleted_at),
+// verrouillée jusqu'à la fin de la transaction.
+func trashed(ctx context.Context, tx pgx.Tx, name string, pub uuid.UUID, userID int64) (id, projectID int, deletedAt time.Time, err error) {
+	t := trashTypes[name]
+	projectCol := "p.id"
+	if t.join == "" {
+		projectCol = "e.id"
+	}
+	err = tx.QueryRow(ctx, `
+		SELECT e.id, `+projectCol+`, e.deleted_at
+		FROM `+t.table+` e `+t.join+`
+		WHERE e.public_id = $1 AND `+t.owner+` = $2 AND e.deleted_at IS NOT NULL
+		FOR UPDATE OF e
+	`, pub, userID).Scan(&id, &projectID, &deletedAt)
+	return id, projectID, deletedAt, err
+}
+
+// itemParams : type et entité de l'URL, propriétaire de la session.
+func itemParams(ctx context.Context, w http.ResponseWriter, r *http.Request) (name string, userID int64, pub uuid.UUID, ok bool) {
+	userID, pub, ok = auth.RequireEntity(ctx, w, r)
+	if !ok {
+		return "", 0, uuid.Nil, false
+	}
+	name = strings.ToLower(chi.URLParam(r, "type"))
+	if _, known := trashTypes[name]; !known {
+		writeTrashError(w, errInvalidType)
+		return "", 0, uuid.Nil, false
+	}
+	return name, userID, pub, true
+}
+
+// restoreItem sort une ligne de la corbeille, avec celles supprimées en même
+// temps qu'elle (scènes d'un chapitre, sous-arbre d'un lieu). Un chapitre ou
+// une scène restauré passe en dernière position.
+func restoreItem(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	name, userID, pub, ok := itemParams(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	id, projectID, deletedAt, err := trashed(ctx, tx, name, pub, userID)
+	if err != nil {
+		writeTrashError(w, err)
+		return
+	}
+
+	switch name {
+	case "chapter":
+		err = restoreChapter(ctx, tx, id, projectID, deletedAt)
+	case "scene":
+		err = restoreScene(ctx, tx, id, projectID)
+	case "location":
+		err = restoreLocation(ctx, tx, id)
+	default:
+		_, err = tx.Exec(ctx, `UPDATE `+trashTypes[name].table+` SET deleted_at = NULL WHERE id = $1`, id)
+	}
+	if err != nil {
+		writeTrashError(w, err)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func restoreChapter(ctx context.Context, tx pgx.Tx, id, projectID int, deletedAt time.Time) error {
+	if err := db.LockProject(ctx, tx, projectID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE chapters_all SET deleted_at = NULL, order_index = (
+			SELECT COALESCE(MAX(order_index), 0) + 1 FROM chapters WHERE project_id = $2
+		)
+		WHERE id = $1
+	`, id, projectID); err != nil {
+		return err
+	}
+	// Les scènes supprimées avant le chapitre restent à la corbeille
+	if _, err := tx.Exec(ctx, `
+		UPDATE scenes_all SET deleted_at = NULL WHERE chapter_id = $1 AND deleted_at = $2
+	`, id, deletedAt); err != nil {
+		return err
+	}
+	return releaseLocations(ctx, tx, "s.chapter_id = $1", id, projectID)
+}
+
+func restoreScene(ctx context.Context, tx pgx.Tx, id, projectID int) error {
+	var chapterID int
+	var chapterTrashed bool
+	if err := tx.QueryRow(ctx, `
+		SELECT c.id, c.deleted_at IS NOT NULL
+		FROM scenes_all s
+		JOIN chapters_all c ON c.id = s.chapter_id
+		WHERE s.id = $1
+	`, id).Scan(&chapterID, &chapterTrashed); err != nil {
+		return err
+	}
+	if chapterTrashed {
+		return errChapterTrashed
+	}
+	if err := db.LockProject(ctx, tx, projectID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE scenes_all SET deleted_at = NULL, order_index = (
+			SELECT COALESCE(MAX(order_index), 0) + 1 FROM scenes WHERE chapter_id = $2
+		)
+		WHERE id = $1
+	`, id, chapterID); err != nil {
+		return err
+	}
+	return releaseLocations(ctx, tx, "s.id = $1", id, projectID)
+}
+
+// releaseLocations : les scènes restaurées perdent un lieu qui n'est plus
+// visible depuis le projet (à la corbeille, ou monde d'une série quittée).
+func releaseLocations(ctx context.Context, tx pgx.Tx, where string, id, projectID int) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE scenes s SET location_id = NULL
+		WHERE `+where+` AND s.location_id IS NOT NULL
+		  AND NOT EXISTS (
+			SELECT 1 FROM locations l
+			WHERE l.id = s.location_id AND l.project_id = ANY (project_scope($2))
+		  )
+	`, id, projectID)
+	return err
+}
+
+// subtree : le lieu et ses descendants supprimés en même temps que lui.
+const subtree = `
+	WITH RECURSIVE sub AS (
+		SELECT id, deleted_at FROM locations_all WHERE id = $1
+		UNION ALL
+		SELECT l.id, l.deleted_at FROM locations_all l
+		JOIN sub ON l.parent_id = sub.id AND l.deleted_at = sub.deleted_at
+	)`
+
+func restoreLocation(ctx context.Context, tx pgx.Tx, id int) error {
+	var parentTrashed bool
+	if err := tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM locations_all l
+			JOIN locations_all pl ON pl.id = l.parent_id
+			WHERE l.id = $1 AND pl.deleted_at IS NOT NULL
+		)`, id).Scan(&parentTrashed); err != nil {
+		return err
+	}
+	if parentTrashed {
+		return errParentTrashed
+	}
+	_, err := tx.Exec(ctx, subtree+`
+		UPDATE locations_all SET deleted_at = NULL WHERE id IN (SELECT id FROM sub)
+	`, id)
+	return err
+}
+
+// purgeItem supprime définitivement une ligne de la corbeille (et celles
+// supprimées avec elle) sans attendre la purge planifiée.
+func purgeItem(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	name, userID, pub, ok := itemParams(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	id, _, _, err := trashed(ctx, tx, name, pub, userID)
+	if err != nil {
+		writeTrashError(w, err)
+		return
+	}
+
+	ids := []int{id}
+	if name == "location" {
+		rows, err := tx.Query(ctx, subtree+`SELECT id FROM sub`, id)
+		if err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if ids, err = pgx.CollectRows(rows, pgx.RowTo[int]); err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	keys, err := purgeIDs(ctx, tx, name, ids)
+	if err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	deleteFiles(ctx, keys)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
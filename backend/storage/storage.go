@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// Storage : stockage des fichiers envoyés (images). Les clés sont des
+// chemins relatifs "a/b/c" générés par le backend.
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var ErrNotFound = errors.New("storage: object not found")
+
+// Default : stockage configuré par Init.
+var Default Storage
+
+// Init choisit le stockage selon STORAGE_DRIVER :
+//   - local (défaut) : fichiers sous UPLOAD_DIR (./uploads)
+//   - s3 : bucket S3 ou compatible (MinIO...), voir S3_* ci-dessous
+func Init() {
+	switch strings.ToLower(os.Getenv("STORAGE_DRIVER")) {
+	case "", "local":
+		dir := os.Getenv("UPLOAD_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		l, err := NewLocal(dir)
+		if err != nil {
+			log.Fatalf("❌ Error initializing local storage: %v", err)
+		}
+		Default = l
+		log.Println("✅ Local storage:", dir)
+	case "s3":
+		s, err := NewS3(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PathStyle: strings.ToLower(os.Getenv("S3_PATH_STYLE")) != "false",
+		})
+		if err != nil {
+			log.Fatalf("❌ Error initializing S3 storage: %v", err)
+		}
+		Default = s
+		log.Println("✅ S3 storage:", os.Getenv("S3_BUCKET"))
+	default:
+		log.Fatalf("❌ Unknown STORAGE_DRIVER %q (local or s3)", os.Getenv("STORAGE_DRIVER"))
+	}
+}
@@ -0,0 +1,159 @@
+package textutil
+
+import "strings"
+
+// Opérations d'un diff
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// DiffOp : suite de mots identiques, ajoutés ou retirés, séparés par des
+// espaces.
+type DiffOp struct {
+	Op    string `json:"op"`
+	Text  string `json:"text"`
+	Words int    `json:"words"`
+}
+
+// Au-delà de ce nombre de mots modifiés, la partie centrale (hors début et
+// fin communs) est rendue comme remplacée d'un bloc : borne le temps et la
+// mémoire de l'algorithme.
+const maxDiffEdits = 1000
+
+// DiffWords compare deux textes mot à mot (balises HTML ignorées), avec
+// l'algorithme de Myers : le plus petit ensemble d'ajouts et de retraits.
+func DiffWords(from, to string) []DiffOp {
+	a := strings.Fields(StripTags(from))
+	b := strings.Fields(StripTags(to))
+
+	// Début et fin communs, hors algorithme
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	var ops []DiffOp
+	ops = appendOp(ops, DiffEqual, a[:pre]...)
+	mid := diffMiddle(a[pre:len(a)-suf], b[pre:len(b)-suf])
+	for _, op := range mid {
+		ops = appendOp(ops, op.Op, op.Text)
+	}
+	ops = appendOp(ops, DiffEqual, a[len(a)-suf:]...)
+	if ops == nil {
+		ops = []DiffOp{}
+	}
+	return ops
+}
+
+// appendOp ajoute des mots en prolongeant la dernière opération si elle est
+// du même type.
+func appendOp(ops []DiffOp, op string, words ...string) []DiffOp {
+	if len(words) == 0 {
+		return ops
+	}
+	if n := len(ops); n > 0 && ops[n-1].Op == op {
+		ops[n-1].Text += " " + strings.Join(words, " ")
+		ops[n-1].Words += len(words)
+		return ops
+	}
+	return append(ops, DiffOp{Op: op, Text: strings.Join(words, " "), Words: len(words)})
+}
+
+// diffMiddle : un mot par opération, dans l'ordre du texte.
+func diffMiddle(a, b []string) []DiffOp {
+	n, m := len(a), len(b)
+	total := n + m
+	if total == 0 {
+		return nil
+	}
+	offset := total
+	// v[offset+k] : x le plus avancé sur la diagonale k
+	v := make([]int, 2*total+2)
+	// trace[d] : état de v avant l'étape d, pour k dans [-d, d]
+	var trace [][]int
+
+	for d := 0; d <= total; d++ {
+		if d > maxDiffEdits {
+			return replaceAll(a, b)
+		}
+		snap := make([]int, 2*d+1)
+		copy(snap, v[offset-d:offset+d+1])
+		trace = append(trace, snap)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, d)
+			}
+		}
+	}
+	return replaceAll(a, b)
+}
+
+// backtrack remonte le chemin trouvé en D étapes, de la fin vers le début.
+func backtrack(a, b []string, trace [][]int, D int) []DiffOp {
+	var rev []DiffOp
+	x, y := len(a), len(b)
+	for d := D; d > 0; d-- {
+		prev := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && prev[k-1+d] < prev[k+1+d]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := prev[prevK+d]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			rev = append(rev, DiffOp{Op: DiffEqual, Text: a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			rev = append(rev, DiffOp{Op: DiffInsert, Text: b[prevY]})
+		} else {
+			rev = append(rev, DiffOp{Op: DiffDelete, Text: a[prevX]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		rev = append(rev, DiffOp{Op: DiffEqual, Text: a[x-1]})
+		x--
+		y--
+	}
+
+	ops := make([]DiffOp, len(rev))
+	for i, op := range rev {
+		ops[len(rev)-1-i] = op
+	}
+	return ops
+}
+
+func replaceAll(a, b []string) []DiffOp {
+	ops := make([]DiffOp, 0, len(a)+len(b))
+	for _, w := range a {
+		ops = append(ops, DiffOp{Op: DiffDelete, Text: w})
+	}
+	for _, w := range b {
+		ops = append(ops, DiffOp{Op: DiffInsert, Text: w})
+	}
+	return ops
+}
@@ -0,0 +1,151 @@
+package textutil
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDiffWords(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     []DiffOp
+	}{
+		{"vides", "", "", []DiffOp{}},
+		{"identiques", "a b c", "a b c", []DiffOp{
+			{DiffEqual, "a b c", 3},
+		}},
+		{"balises ignorées", "<p>a <em>b</em></p>", "a b", []DiffOp{
+			{DiffEqual, "a b", 2},
+		}},
+		{"ajout", "a c", "a b c", []DiffOp{
+			{DiffEqual, "a", 1},
+			{DiffInsert, "b", 1},
+			{DiffEqual, "c", 1},
+		}},
+		{"retrait", "a b c", "a c", []DiffOp{
+			{DiffEqual, "a", 1},
+			{DiffDelete, "b", 1},
+			{DiffEqual, "c", 1},
+		}},
+		{"remplacement", "a b c", "a x c", []DiffOp{
+			{DiffEqual, "a", 1},
+			{DiffDelete, "b", 1},
+			{DiffInsert, "x", 1},
+			{DiffEqual, "c", 1},
+		}},
+		// Sans début ni fin communs : seul Myers trouve "c d"
+		{"sous-suite commune au milieu", "b c d", "c d e", []DiffOp{
+			{DiffDelete, "b", 1},
+			{DiffEqual, "c d", 2},
+			{DiffInsert, "e", 1},
+		}},
+		{"tout remplacé", "a", "b c", []DiffOp{
+			{DiffDelete, "a", 1},
+			{DiffInsert, "b c", 2},
+		}},
+		{"depuis vide", "", "a b", []DiffOp{
+			{DiffInsert, "a b", 2},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DiffWords(tt.from, tt.to)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffWords(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+// Le chemin remonté par backtrack doit redonner les deux textes et compter
+// le minimum d'ajouts et de retraits.
+func TestDiffMiddleBacktrack(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  string
+		edits int
+	}{
+		{"exemple de Myers", "a b c a b b a", "c b a b a c", 5},
+		{"inversion", "a b c d", "d c b a", 6},
+		{"mots répétés", "x x x y", "y x x x", 2},
+		{"entrelacé", "a b c d e f", "b a d c f e", 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := strings.Fields(tt.a), strings.Fields(tt.b)
+			ops := diffMiddle(a, b)
+
+			var from, to []string
+			edits := 0
+			for _, op := range ops {
+				switch op.Op {
+				case DiffEqual:
+					from = append(from, op.Text)
+					to = append(to, op.Text)
+				case DiffDelete:
+					from = append(from, op.Text)
+					edits++
+				case DiffInsert:
+					to = append(to, op.Text)
+					edits++
+				}
+			}
+			if !reflect.DeepEqual(from, a) || !reflect.DeepEqual(to, b) {
+				t.Fatalf("ops %v give %v -> %v, want %v -> %v", ops, from, to, a, b)
+			}
+			if edits != tt.edits {
+				t.Errorf("edits = %d, want %d", edits, tt.edits)
+			}
+		})
+	}
+}
+
+// Au-delà de maxDiffEdits, la partie centrale est remplacée d'un bloc, même
+// si des mots lui sont communs.
+func TestDiffWordsFallback(t *testing.T) {
+	words := func(prefix string, n int) []string {
+		list := make([]string, n)
+		for i := range list {
+			list[i] = prefix + strconv.Itoa(i)
+		}
+		return list
+	}
+	half := maxDiffEdits/4 + 1
+	a := append(append(words("a", half), "commun"), words("b", half)...)
+	b := append(append(words("c", half), "commun"), words("d", half)...)
+
+	tests := []struct {
+		name string
+		a, b []string
+		want []DiffOp
+	}{
+		{"au-delà de la limite", a, b, []DiffOp{
+			{DiffDelete, strings.Join(a, " "), len(a)},
+			{DiffInsert, strings.Join(b, " "), len(b)},
+		}},
+		{"début et fin communs conservés", append(append([]string{"début"}, a...), "fin"),
+			append(append([]string{"début"}, b...), "fin"), []DiffOp{
+				{DiffEqual, "début", 1},
+				{DiffDelete, strings.Join(a, " "), len(a)},
+				{DiffInsert, strings.Join(b, " "), len(b)},
+				{DiffEqual, "fin", 1},
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DiffWords(strings.Join(tt.a, " "), strings.Join(tt.b, " "))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffWords: got %d ops, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+
+	// Sous la limite, le mot commun est retrouvé
+	small := DiffWords("a commun b", "c commun d")
+	if len(small) != 5 || small[2] != (DiffOp{DiffEqual, "commun", 1}) {
+		t.Errorf("DiffWords under the limit = %v", small)
+	}
+}
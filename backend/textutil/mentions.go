@@ -0,0 +1,128 @@
+package textutil
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Pattern : texte à repérer ; Key identifie ce qu'il désigne côté appelant.
+type Pattern struct {
+	Key  int
+	Text string
+}
+
+// Match : occurrence d'un Pattern, Text tel qu'écrit dans le texte. Start et
+// End sont des positions en unités UTF-16 (celles de String.length et des
+// sélections côté navigateur), End exclu : un emoji compte pour 2.
+type Match struct {
+	Key   int
+	Text  string
+	Start int
+	End   int
+}
+
+type compiled struct {
+	key   int
+	runes []rune
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// maskMarkup remplace par des espaces les balises HTML et les entités
+// (&nbsp;, &#233;...) pour ne pas y chercher de noms, sans décaler les
+// positions.
+func maskMarkup(text []rune) {
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '<':
+			j := i
+			for j < len(text) && text[j] != '>' {
+				j++
+			}
+			if j == len(text) {
+				continue // '<' isolé : du texte
+			}
+			for k := i; k <= j; k++ {
+				text[k] = ' '
+			}
+			i = j
+		case '&':
+			j := i + 1
+			for j < len(text) && j-i <= 10 && (isWordRune(text[j]) || text[j] == '#') {
+				j++
+			}
+			if j < len(text) && text[j] == ';' && j > i+1 {
+				for k := i; k <= j; k++ {
+					text[k] = ' '
+				}
+				i = j
+			}
+		}
+	}
+}
+
+// FindMentions repère les patterns dans content, sans tenir compte de la
+// casse ni des balises HTML, et uniquement en mots entiers. Le plus long
+// pattern l'emporte ; à longueur égale, le premier de la liste. Les
+// occurrences ne se chevauchent pas.
+func FindMentions(content string, patterns []Pattern) []Match {
+	// Patterns indexés par leur premier caractère, du plus long au plus court
+	byFirst := make(map[rune][]compiled)
+	for _, p := range patterns {
+		runes := []rune(strings.ToLower(strings.TrimSpace(p.Text)))
+		if len(runes) == 0 {
+			continue
+		}
+		byFirst[runes[0]] = append(byFirst[runes[0]], compiled{p.Key, runes})
+	}
+	for _, list := range byFirst {
+		sort.SliceStable(list, func(i, j int) bool { return len(list[i].runes) > len(list[j].runes) })
+	}
+
+	original := []rune(content)
+	text := make([]rune, len(original))
+	copy(text, original)
+	maskMarkup(text)
+	for i, r := range text {
+		text[i] = unicode.ToLower(r)
+	}
+
+	// Position UTF-16 du début de chaque caractère (et de la fin du texte)
+	units := make([]int, len(original)+1)
+	for i, r := range original {
+		n := utf16.RuneLen(r)
+		if n < 1 {
+			n = 1
+		}
+		units[i+1] = units[i] + n
+	}
+
+	var matches []Match
+	for i := 0; i < len(text); i++ {
+		if i > 0 && isWordRune(text[i-1]) {
+			continue
+		}
+		for _, c := range byFirst[text[i]] {
+			end := i + len(c.runes)
+			if end > len(text) || (end < len(text) && isWordRune(text[end])) {
+				continue
+			}
+			if string(text[i:end]) != string(c.runes) {
+				continue
+			}
+			matches = append(matches, Match{
+				Key:   c.key,
+				Text:  string(original[i:end]),
+				Start: units[i],
+				End:   units[end],
+			})
+			i = end - 1
+			break
+		}
+	}
+	return matches
+}
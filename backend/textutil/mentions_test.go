@@ -0,0 +1,65 @@
+package textutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindMentions(t *testing.T) {
+	people := []Pattern{
+		{1, "Jean"},
+		{2, "Jean Valjean"},
+		{3, "Paris"},
+		{4, "Cosette"},
+	}
+	tests := []struct {
+		name     string
+		content  string
+		patterns []Pattern
+		want     []Match
+	}{
+		{"aucune", "Rien ici.", people, nil},
+		{"le plus long l'emporte", "Jean Valjean et Jean.", people, []Match{
+			{2, "Jean Valjean", 0, 12},
+			{1, "Jean", 16, 20},
+		}},
+		{"sans casse, texte d'origine", "JEAN à paris", people, []Match{
+			{1, "JEAN", 0, 4},
+			{3, "paris", 7, 12},
+		}},
+		{"mots entiers seulement", "Jeanne, Jean_ et Parisien", people, nil},
+		{"ponctuation autour", "(Cosette)!", people, []Match{
+			{4, "Cosette", 1, 8},
+		}},
+		{"balises masquées", `<p class="Jean">Paris</p>`, people, []Match{
+			{3, "Paris", 16, 21},
+		}},
+		{"balise coupant un nom", "Co<b>sette</b>", people, nil},
+		{"entités masquées", "&nbsp;Paris&amp;Cosette", people, []Match{
+			{3, "Paris", 6, 11},
+			{4, "Cosette", 16, 23},
+		}},
+		{"nom dans une entité", "&cosette;", people, nil},
+		{"chevron isolé", "a < Jean", people, []Match{
+			{1, "Jean", 4, 8},
+		}},
+		{"à égalité, le premier de la liste", "Anna", []Pattern{{1, "Anna"}, {2, " anna "}}, []Match{
+			{1, "Anna", 0, 4},
+		}},
+		{"pattern vide ignoré", "Jean", []Pattern{{1, "  "}, {2, "Jean"}}, []Match{
+			{2, "Jean", 0, 4},
+		}},
+		{"positions UTF-16", "😀 Jean é Paris", people, []Match{
+			{1, "Jean", 3, 7},
+			{3, "Paris", 10, 15},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FindMentions(tt.content, tt.patterns)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindMentions(%q) = %v, want %v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
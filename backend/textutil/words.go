@@ -0,0 +1,19 @@
+package textutil
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Le contenu des scènes peut venir de l'éditeur riche : on ignore les balises.
+var tagRe = regexp.MustCompile(`<[^>]*>`)
+
+// StripTags remplace les balises HTML par des espaces.
+func StripTags(s string) string {
+	return tagRe.ReplaceAllString(s, " ")
+}
+
+// WordCount compte les mots d'un texte (balises HTML ignorées).
+func WordCount(s string) int {
+	return len(strings.Fields(StripTags(s)))
+}
@@ -38,13 +38,13 @@ export async function fetchFullProjectsByUserID(userID) {
   return res.json()
 }
 
-export async function createProject({ title, description = '', story_model_id = null }) {
+export async function createProject({ title, description = '', story_model_id = null, scaffold_chapters = false }) {
   try {
     const res = await fetch(`/api/projects`, {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
       // Pas de user_id ici : il est déduit du cookie côté serveur
-      body: JSON.stringify({ title, description, story_model_id }),
+      body: JSON.stringify({ title, description, story_model_id, scaffold_chapters }),
     })
 
     const text = await res.text()